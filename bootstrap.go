@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"resturant/controllers"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+)
+
+// bootstrapAdminCommand creates the first admin from the command line. The
+// password is read from BOOTSTRAP_ADMIN_PASSWORD or, when unset, from stdin so
+// it does not end up in the shell history.
+func bootstrapAdminCommand(args []string) {
+	flags := flag.NewFlagSet("bootstrap-admin", flag.ExitOnError)
+	name := flags.String("name", os.Getenv("BOOTSTRAP_ADMIN_NAME"), "admin name")
+	email := flags.String("email", os.Getenv("BOOTSTRAP_ADMIN_EMAIL"), "admin email")
+	phone := flags.String("phone", os.Getenv("BOOTSTRAP_ADMIN_PHONE"), "admin phone in E.164 format")
+	flags.Parse(args)
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Print("Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		}
+		password = strings.TrimSpace(line)
+	}
+
+	user, err := controllers.BootstrapAdmin(models.SignupRequest{
+		Username: *name,
+		Email:    *email,
+		Phone:    *phone,
+		Password: password,
+	})
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	fmt.Printf("Admin %s created\n", user.Email)
+}
+
+// bootstrapAdminFromEnv creates the first admin from the BOOTSTRAP_ADMIN_*
+// variables, it does nothing once an admin exists
+func bootstrapAdminFromEnv() {
+	user, err := controllers.BootstrapAdmin(models.SignupRequest{
+		Username: os.Getenv("BOOTSTRAP_ADMIN_NAME"),
+		Email:    os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		Phone:    os.Getenv("BOOTSTRAP_ADMIN_PHONE"),
+		Password: os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"),
+	})
+	if errors.Is(err, controllers.ErrAdminExists) {
+		return
+	}
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	log.Printf("bootstrap: admin %s created", user.Email)
+}
@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxAddresses caps the address book of a customer
+const maxAddresses = 20
+
+var addressColumns = []string{
+	"id", "user_id", "label", "address", "latitude", "longitude", "instructions", "is_default", "created_at", "updated_at",
+}
+
+// customerAddress loads one of the user's addresses
+func customerAddress(q sqlx.Queryer, userID uuid.UUID, id string) (models.CustomerAddress, error) {
+	var address models.CustomerAddress
+	addressID, err := uuid.Parse(id)
+	if err != nil {
+		return address, sql.ErrNoRows
+	}
+	query, args, err := QB.Select(addressColumns...).
+		From("customer_addresses").
+		Where(squirrel.Eq{"id": addressID, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return address, err
+	}
+	err = sqlx.Get(q, &address, query, args...)
+	return address, err
+}
+
+// defaultAddress loads the user's default address, sql.ErrNoRows when there is none
+func defaultAddress(q sqlx.Queryer, userID uuid.UUID) (models.CustomerAddress, error) {
+	var address models.CustomerAddress
+	query, args, err := QB.Select(addressColumns...).
+		From("customer_addresses").
+		Where(squirrel.Eq{"user_id": userID, "is_default": true}).
+		ToSql()
+	if err != nil {
+		return address, err
+	}
+	err = sqlx.Get(q, &address, query, args...)
+	return address, err
+}
+
+// setDefaultAddress makes the address the only default one of the user
+func setDefaultAddress(tx *sqlx.Tx, userID, addressID uuid.UUID) error {
+	if _, err := tx.Exec("UPDATE customer_addresses SET is_default = false WHERE user_id = $1 AND is_default AND id <> $2", userID, addressID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE customer_addresses SET is_default = true, updated_at = NOW() WHERE id = $1", addressID)
+	return err
+}
+
+// lockAddressBook serializes changes to the default address of a user
+func lockAddressBook(tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID)
+	return err
+}
+
+func GetAddresses(w http.ResponseWriter, r *http.Request) {
+	addresses := []models.CustomerAddress{}
+	query, args, err := QB.Select(addressColumns...).
+		From("customer_addresses").
+		Where(squirrel.Eq{"user_id": currentSession(r).UserID}).
+		OrderBy("is_default DESC", "label").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&addresses, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get addresses")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, addresses)
+}
+
+// CreateAddress adds an address to the address book, the first one becomes the default
+func CreateAddress(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.AddressRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		utils.HandleValidationError(w, utils.FieldErrors{"location": "latitude and longitude must be sent together"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockAddressBook(tx, session.UserID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to lock address book")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM customer_addresses WHERE user_id = $1", session.UserID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to count addresses")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if count >= maxAddresses {
+		utils.HandleError(w, http.StatusConflict, fmt.Sprintf("You can save up to %d addresses", maxAddresses))
+		return
+	}
+
+	address := models.CustomerAddress{
+		ID:           uuid.New(),
+		UserID:       session.UserID,
+		Label:        req.Label,
+		Address:      req.Address,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Instructions: req.Instructions,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	query, args, err := QB.Insert("customer_addresses").
+		Columns(addressColumns...).
+		Values(address.ID, address.UserID, address.Label, address.Address, address.Latitude, address.Longitude,
+			address.Instructions, false, address.CreatedAt, address.UpdatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if req.IsDefault || count == 0 {
+		if err := setDefaultAddress(tx, session.UserID, address.ID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to set default address")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		address.IsDefault = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, address)
+}
+
+// UpdateAddress replaces an address, orders placed with it keep the old text
+func UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.AddressRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		utils.HandleValidationError(w, utils.FieldErrors{"location": "latitude and longitude must be sent together"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockAddressBook(tx, session.UserID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to lock address book")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	address, err := customerAddress(tx, session.UserID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Address not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	address.Label = req.Label
+	address.Address = req.Address
+	address.Latitude, address.Longitude = req.Latitude, req.Longitude
+	address.Instructions = req.Instructions
+	address.UpdatedAt = time.Now()
+	query, args, err := QB.Update("customer_addresses").
+		Set("label", address.Label).
+		Set("address", address.Address).
+		Set("latitude", address.Latitude).
+		Set("longitude", address.Longitude).
+		Set("instructions", address.Instructions).
+		Set("updated_at", address.UpdatedAt).
+		Where(squirrel.Eq{"id": address.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The default is moved by making another address the default, not by unsetting it
+	if req.IsDefault && !address.IsDefault {
+		if err := setDefaultAddress(tx, session.UserID, address.ID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to set default address")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		address.IsDefault = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, address)
+}
+
+func SetDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockAddressBook(tx, session.UserID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to lock address book")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	address, err := customerAddress(tx, session.UserID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Address not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := setDefaultAddress(tx, session.UserID, address.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to set default address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	address.IsDefault = true
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to set default address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, address)
+}
+
+// DeleteAddress removes an address, the most recently added remaining one
+// becomes the default when the default is removed
+func DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockAddressBook(tx, session.UserID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to lock address book")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	address, err := customerAddress(tx, session.UserID, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Address not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM customer_addresses WHERE id = $1", address.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if address.IsDefault {
+		_, err := tx.Exec(`UPDATE customer_addresses SET is_default = true
+			WHERE id = (SELECT id FROM customer_addresses WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1)`, session.UserID)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to set default address")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Address deleted successfully"})
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/mailer"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const adminInvitationTTL = 72 * time.Hour
+
+// adminsLockID is the advisory lock taken while the set of admins changes, so
+// two bootstraps cannot both run and two revocations cannot remove the last admin
+const adminsLockID = 3201
+
+// ErrAdminExists is returned by BootstrapAdmin once the database has an admin
+var ErrAdminExists = errors.New("an admin account already exists")
+
+// createAdmin inserts the user and gives it the admin role
+func createAdmin(q sqlx.Ext, user models.User) (models.User, error) {
+	query, args, err := QB.Insert("users").
+		Columns("id", "name", "email", "phone", "password", "img", "created_at", "updated_at", "email_verified", "email_verified_at").
+		Values(user.ID, user.Name, user.Email, user.Phone, user.Password, user.Img, user.CreatedAt, user.UpdatedAt, user.EmailVerified, user.EmailVerifiedAt).
+		Suffix(fmt.Sprintf("RETURNING %s", strings.Join(userColumns, ", "))).
+		ToSql()
+	if err != nil {
+		return user, err
+	}
+	if err := q.QueryRowx(query, args...).StructScan(&user); err != nil {
+		return user, err
+	}
+
+	query, args, err = QB.Insert("user_roles").
+		Columns("user_id", "role_id").
+		Values(user.ID, adminRoleID).
+		ToSql()
+	if err != nil {
+		return user, err
+	}
+	_, err = q.Exec(query, args...)
+	return user, err
+}
+
+// emailTaken reports whether a user already uses the email
+func emailTaken(q sqlx.Ext, email string) (bool, error) {
+	var taken bool
+	err := sqlx.Get(q, &taken, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", email)
+	return taken, err
+}
+
+// BootstrapAdmin creates the first admin account. It only works on a database
+// without admins, every other admin is invited by an existing one.
+func BootstrapAdmin(req models.SignupRequest) (models.User, error) {
+	if errs := utils.Validate(req); errs != nil {
+		return models.User{}, errs
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", adminsLockID); err != nil {
+		return models.User{}, err
+	}
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM user_roles WHERE role_id = $1)", adminRoleID); err != nil {
+		return models.User{}, err
+	}
+	if exists {
+		return models.User{}, ErrAdminExists
+	}
+	if taken, err := emailTaken(tx, req.Email); err != nil {
+		return models.User{}, err
+	} else if taken {
+		return models.User{}, fmt.Errorf("a user with the email %s already exists", req.Email)
+	}
+
+	now := time.Now()
+	user, err := createAdmin(tx, models.User{
+		ID:              uuid.New(),
+		Name:            req.Username,
+		Email:           req.Email,
+		Phone:           req.Phone,
+		Password:        hashedPassword,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+// InviteAdmin emails a single-use invitation to become an admin
+func InviteAdmin(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.InviteAdminRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	if taken, err := emailTaken(db, req.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate invitation token")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	invitation := models.AdminInvitation{
+		ID:        uuid.New(),
+		Email:     req.Email,
+		TokenHash: hash,
+		InvitedBy: &session.UserID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(adminInvitationTTL),
+	}
+	query, args, err := QB.Insert("admin_invitations").
+		Columns("id", "email", "token_hash", "invited_by", "created_at", "expires_at").
+		Values(invitation.ID, invitation.Email, invitation.TokenHash, invitation.InvitedBy, invitation.CreatedAt, invitation.ExpiresAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store invitation")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	err = mail.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to become an admin",
+		Body: fmt.Sprintf(
+			"Hello,\n\nYou have been invited to administer the restaurant platform. Use the following token to create your admin account, it expires in %s:\n\n%s\n\nOr open %s/accept-invitation?token=%s",
+			adminInvitationTTL, token, os.Getenv("DOMAIN"), token,
+		),
+	})
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to send invitation email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.AdminInvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		CreatedAt: invitation.CreatedAt,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// AcceptAdminInvitation creates the invited admin account
+func AcceptAdminInvitation(w http.ResponseWriter, r *http.Request) {
+	var req models.AcceptInvitationRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the invitation so it cannot be accepted twice
+	var invitation models.AdminInvitation
+	query, args, err := QB.Select("id", "email", "token_hash", "invited_by", "created_at", "expires_at", "accepted_at").
+		From("admin_invitations").
+		Where(squirrel.Eq{"token_hash": utils.HashToken(req.Token), "accepted_at": nil}).
+		Where(squirrel.Gt{"expires_at": time.Now()}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&invitation, query, args...); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid or expired invitation token")
+		return
+	}
+
+	if taken, err := emailTaken(tx, invitation.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+
+	query, args, err = QB.Update("admin_invitations").Set("accepted_at", time.Now()).Where(squirrel.Eq{"id": invitation.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to accept invitation")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The invitation token was delivered to the email, so it is verified
+	now := time.Now()
+	user, err := createAdmin(tx, models.User{
+		ID:              uuid.New(),
+		Name:            req.Username,
+		Email:           invitation.Email,
+		Phone:           req.Phone,
+		Password:        hashedPassword,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create admin")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create admin")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewAdminResponse(user))
+}
+
+func GetAllAdmins(w http.ResponseWriter, r *http.Request) {
+	var admins []models.User
+	query, args, err := QB.Select("users.id", "users.name", "users.email", "users.phone", "users.created_at", "users.updated_at").
+		From("users").
+		Join("user_roles ON user_roles.user_id = users.id").
+		Where(squirrel.Eq{"user_roles.role_id": adminRoleID}).
+		OrderBy("users.created_at").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&admins, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get admins")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewAdminResponses(admins))
+}
+
+// RevokeAdmin removes the admin role from a user and ends their sessions, the
+// account itself is kept. The last admin cannot be revoked.
+func RevokeAdmin(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if userID == session.UserID {
+		utils.HandleError(w, http.StatusConflict, "You cannot revoke your own admin role")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", adminsLockID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to lock admins")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Delete("user_roles").Where(squirrel.Eq{"user_id": userID, "role_id": adminRoleID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to revoke admin role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if revoked, _ := result.RowsAffected(); revoked == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Admin not found")
+		return
+	}
+
+	var remaining int
+	if err := tx.Get(&remaining, "SELECT COUNT(*) FROM user_roles WHERE role_id = $1", adminRoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to count admins")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if remaining == 0 {
+		utils.HandleError(w, http.StatusConflict, "The last admin cannot be revoked")
+		return
+	}
+
+	if err := revokeSessions(tx, userID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to revoke admin role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Admin role revoked successfully",
+	})
+}
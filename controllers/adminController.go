@@ -18,31 +18,27 @@ const adminRoleID = 1
 const vendorRoleID = 2
 
 func AdminSignup(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20) // Limit to 10 MB for file upload
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	// Decode the JSON or multipart body
+	var req models.SignupRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Extract form data
-	username := r.FormValue("username")
-	email := r.FormValue("email")
-	password := r.FormValue("password")
-	phone := r.FormValue("phone")
-
-	// Validate required fields
-	if username == "" || email == "" || password == "" || phone == "" {
-		fmt.Printf("username: %v, email: %v, password: %v phone: %v", username, email, password, phone)
-		utils.HandleError(w, http.StatusBadRequest, "make sure you fill all fields")
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
+	username := req.Username
+	email := req.Email
+	password := req.Password
+	phone := req.Phone
+
 	// Check if the admin already exists
 	query, args, err := QB.Select("id", "email").From("users").Where(squirrel.Eq{"email": email}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "enternal server error")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -94,68 +90,36 @@ func AdminSignup(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: time.Now(),
 	}
 
-	// Insert the new admin into the users table
-	query, args, err = QB.Insert("users").
-		Columns("id", "name", "email", "phone", "password", "img", "created_at", "updated_at").
-		Values(user.ID, user.Name, user.Email, user.Phone, user.Password, user.Img, user.CreatedAt, user.UpdatedAt).
-		Suffix(fmt.Sprintf("RETURNING %s", strings.Join(userColumns, ", "))).
-		ToSql()
+	// Insert the new admin and assign the 'admin' role
+	user, err = createAdmin(db, user)
 	if err != nil {
-		utils.HandleError(w, http.StatusInternalServerError, "Failed to create admin")
-		utils.ErrorWithTrace(err, err.Error())
-		return
-	}
-
-	// Execute the query and scan the result into the user struct
-	if err := db.QueryRowx(query, args...).StructScan(&user); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Error creating admin: "+err.Error())
 		utils.ErrorWithTrace(err, err.Error())
 		return
 	}
 
-	// Assign the 'admin' role to the user in the user_roles table
-	query, args, err = QB.Insert("user_roles").
-		Columns("user_id", "role_id").
-		Values(user.ID, adminRoleID).
-		ToSql()
-	if err != nil {
-		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign admin role")
-		utils.ErrorWithTrace(err, err.Error())
-		return
-	}
-
-	if _, err := db.Exec(query, args...); err != nil {
-		utils.HandleError(w, http.StatusInternalServerError, "Error assigning admin role: "+err.Error())
-		utils.ErrorWithTrace(err, err.Error())
-		return
-	}
-
 	// Return the newly created admin details
-	utils.SendJSONResponse(w, http.StatusCreated, user)
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewAdminResponse(user))
 }
 
 func AdminLogin(w http.ResponseWriter, r *http.Request) {
-	// Parse form data
-	err := r.ParseForm()
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		utils.ErrorWithTrace(err, err.Error())
+	// Decode the JSON or form body
+	var req models.LoginRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Get email and password from form fields
-	email := r.FormValue("email")
-	password := r.FormValue("password")
-
-	// Validate input fields
-	if email == "" || password == "" {
-		utils.HandleError(w, http.StatusBadRequest, "make sure you fill all fields")
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
+	email := req.Email
+	password := req.Password
+
 	// Query to check if the user exists
 	var user models.User
-	query, args, err := QB.Select("id", "name", "email", "password", "img", "phone", "updated_at").From("users").Where(squirrel.Eq{"email": email}).ToSql()
+	query, args, err := QB.Select("id", "name", "email", "password", "img", "phone", "created_at", "updated_at", "totp_enabled", "totp_required").From("users").Where(squirrel.Eq{"email": email}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Internal server error")
 		utils.ErrorWithTrace(err, err.Error())
@@ -188,39 +152,45 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Successful login: return the admin's details (excluding password)
-	responseAdmin := map[string]interface{}{
-		"id":        user.ID,
-		"name":      user.Name,
-		"email":     user.Email,
-		"phone":     user.Phone,
-		"updatedAt": user.UpdatedAt,
-		"image":     user.Img,
+	// With 2FA enabled the session is only created once the code is verified
+	if user.TOTPEnabled {
+		sendLoginChallenge(w, user.ID)
+		return
 	}
 
-	utils.SendJSONResponse(w, http.StatusOK, responseAdmin)
-}
-
-func AddVendor(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20) // Limit to 10 MB for file upload
+	// Start a new session for the admin
+	session, err := createSession(db, user.ID, false)
 	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		utils.ErrorWithTrace(err, err.Error())
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
-	// Extract form data
-	username := r.FormValue("username")
-	email := r.FormValue("email")
-	phone := r.FormValue("phone")
-	description := r.FormValue("description")
+	// Successful login: return the admin's details (excluding password) and the session token
+	utils.SendJSONResponse(w, http.StatusOK, models.AdminLoginResponse{
+		AdminResponse:               models.NewAdminResponse(user),
+		SessionResponse:             session,
+		TwoFactorEnrollmentRequired: user.TOTPRequired,
+	})
+}
 
-	// Validate required fields
-	if username == "" || email == "" || phone == "" || description == "" {
-		utils.HandleError(w, http.StatusBadRequest, "Username, email, phone, and description are required")
+func AddVendor(w http.ResponseWriter, r *http.Request) {
+	// Decode the JSON or multipart body
+	var req models.AddVendorRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
+	username := req.Username
+	email := req.Email
+	phone := req.Phone
+	description := req.Description
+
 	// Check if the user already exists
 	query, args, err := QB.Select("id", "email").From("users").Where(squirrel.Eq{"email": email}).ToSql()
 	if err != nil {
@@ -245,7 +215,7 @@ func AddVendor(w http.ResponseWriter, r *http.Request) {
 		imgPath, err = utils.SaveImageFile(file, "vendors", fileHeader.Filename)
 		if err != nil {
 			utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
-			log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
 			return
 		}
 		// Convert backslashes to forward slashes for URI compatibility
@@ -323,15 +293,26 @@ func AddVendor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return the newly created vendor's details
-	utils.SendJSONResponse(w, http.StatusCreated, user)
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewVendorResponse(models.Vendor{
+		ID:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Phone:       user.Phone,
+		Img:         user.Img,
+		Description: description,
+		CreatedAt:   user.CreatedAt,
+	}))
 }
 
 func UpdateVendor(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form data (for file uploads)
-	err := r.ParseMultipartForm(10 << 20) // Limit to 10 MB for file upload
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		utils.ErrorWithTrace(err, err.Error())
+	// Decode the JSON or multipart body (the image can only be sent as multipart)
+	var req models.UpdateVendorRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
@@ -344,7 +325,7 @@ func UpdateVendor(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch the current vendor data
 	var vendor models.User
-	query, args, err := QB.Select("id", "name", "img").From("users").Where(squirrel.Eq{"id": vendorID}).ToSql()
+	query, args, err := QB.Select("id", "name", "email", "img", "created_at").From("users").Where(squirrel.Eq{"id": vendorID}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
 		utils.ErrorWithTrace(err, err.Error())
@@ -357,9 +338,9 @@ func UpdateVendor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract the new name and description from the form data
-	newName := r.FormValue("name")
-	newDescription := r.FormValue("description")
-	newPhone := r.FormValue("phone")
+	newName := req.Name
+	newDescription := req.Description
+	newPhone := req.Phone
 
 	// Handle image upload (optional)
 	var newImgPath string
@@ -433,14 +414,15 @@ func UpdateVendor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return the updated vendor details
-	updatedVendor := map[string]interface{}{
-		"id":          vendor.ID,
-		"name":        newName,
-		"img":         newImgURI,
-		"description": newDescription,
-	}
-
-	utils.SendJSONResponse(w, http.StatusOK, updatedVendor)
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorResponse(models.Vendor{
+		ID:          vendor.ID,
+		Name:        newName,
+		Email:       vendor.Email,
+		Phone:       newPhone,
+		Img:         newImgURI,
+		Description: newDescription,
+		CreatedAt:   vendor.CreatedAt,
+	}))
 }
 
 func DeleteVendor(w http.ResponseWriter, r *http.Request) {
@@ -525,10 +507,7 @@ func DeleteVendor(w http.ResponseWriter, r *http.Request) {
 
 func GetAllVendors(w http.ResponseWriter, r *http.Request) {
 	// Query to fetch all vendors by joining the users and vendors table
-	query, args, err := QB.Select("users.id", "users.name", "users.email", "users.phone", "users.img", "users.created_at", "vendors.description").
-		From("users").
-		Join("vendors ON users.id = vendors.vendor_id").
-		ToSql()
+	query, args, err := selectVendors().ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Internal Server Error")
 		utils.ErrorWithTrace(err, err.Error())
@@ -546,7 +525,7 @@ func GetAllVendors(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return the list of vendors
-	utils.SendJSONResponse(w, http.StatusOK, vendors)
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorResponses(vendors))
 }
 
 func GetVendorById(w http.ResponseWriter, r *http.Request) {
@@ -554,16 +533,7 @@ func GetVendorById(w http.ResponseWriter, r *http.Request) {
 	vendorId := r.PathValue("id")
 
 	// Query to fetch the vendor by joining the users and vendors table
-	query, args, err := QB.Select(
-		"users.id",
-		"users.name",
-		"users.email",
-		"users.phone",
-		"users.img",
-		"users.created_at",
-		"vendors.description").
-		From("users").
-		Join("vendors ON users.id = vendors.vendor_id").
+	query, args, err := selectVendors().
 		Where(squirrel.Eq{"users.id": vendorId}).
 		ToSql()
 
@@ -584,5 +554,5 @@ func GetVendorById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return the vendor data as JSON
-	utils.SendJSONResponse(w, http.StatusOK, vendor)
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorResponse(vendor))
 }
@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/mailer"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	sessionTTL       = 24 * time.Hour
+	passwordResetTTL = time.Hour
+)
+
+type contextKey string
+
+const (
+	sessionContextKey contextKey = "session"
+	vendorContextKey  contextKey = "vendor"
+)
+
+var mail mailer.Mailer
+
+func SetMailer(m mailer.Mailer) {
+	mail = m
+}
+
+// createSession stores a new session for the user and returns its bearer
+// token. twoFactorVerified tells whether a second factor was checked, sessions
+// of accounts with 2FA enabled are refused without it.
+func createSession(q sqlx.Ext, userID uuid.UUID, twoFactorVerified bool) (models.SessionResponse, error) {
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+
+	session := models.Session{
+		ID:                uuid.New(),
+		UserID:            userID,
+		TokenHash:         hash,
+		CreatedAt:         time.Now(),
+		ExpiresAt:         time.Now().Add(sessionTTL),
+		TwoFactorVerified: twoFactorVerified,
+	}
+	query, args, err := QB.Insert("sessions").
+		Columns("id", "user_id", "token_hash", "created_at", "expires_at", "two_factor_verified").
+		Values(session.ID, session.UserID, session.TokenHash, session.CreatedAt, session.ExpiresAt, session.TwoFactorVerified).
+		ToSql()
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+	if _, err := q.Exec(query, args...); err != nil {
+		return models.SessionResponse{}, err
+	}
+
+	return models.SessionResponse{Token: token, ExpiresAt: session.ExpiresAt}, nil
+}
+
+// revokeSessions revokes every active session of the user
+func revokeSessions(q sqlx.Ext, userID uuid.UUID) error {
+	query, args, err := QB.Update("sessions").
+		Set("revoked_at", time.Now()).
+		Where(squirrel.Eq{"user_id": userID, "revoked_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer <token>"
+// header and makes the session available to handlers through currentSession.
+// Sessions of accounts with 2FA enabled must have passed the second factor,
+// whichever login created them.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			utils.HandleError(w, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		var session struct {
+			models.Session
+			TOTPEnabled bool `db:"totp_enabled"`
+		}
+		query, args, err := QB.Select("sessions.id", "sessions.user_id", "sessions.token_hash", "sessions.created_at",
+			"sessions.expires_at", "sessions.revoked_at", "sessions.two_factor_verified", "users.totp_enabled").
+			From("sessions").
+			Join("users ON users.id = sessions.user_id").
+			Where(squirrel.Eq{"sessions.token_hash": utils.HashToken(token), "sessions.revoked_at": nil}).
+			Where(squirrel.Gt{"sessions.expires_at": time.Now()}).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Internal server error")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := db.Get(&session, query, args...); err != nil {
+			utils.HandleError(w, http.StatusUnauthorized, "Invalid or expired session")
+			return
+		}
+		if session.TOTPEnabled && !session.TwoFactorVerified {
+			utils.HandleError(w, http.StatusUnauthorized, "Two-factor authentication is enabled on this account, please log in again")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, session.Session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Role middlewares used by main.go, they must run after RequireAuth
+var (
+	RequireAdmin    = requireRole(adminRoleID)
+	RequireVendor   = requireRole(vendorRoleID)
+	RequireCustomer = requireRole(customerRoleID)
+)
+
+// requireRole only lets through users holding the role
+func requireRole(roleID int) func(http.Handler) http.Handler {
+	return requireAccess(squirrel.Expr("EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id AND user_roles.role_id = ?)", roleID))
+}
+
+// requireAccess only lets through users for which the hasAccess SQL condition
+// (evaluated against the users row) holds. Accounts on which an admin enforced
+// 2FA are refused until they enroll, the /auth/2fa endpoints only need
+// RequireAuth so enrollment stays possible.
+func requireAccess(hasAccess squirrel.Sqlizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var access struct {
+				HasAccess    bool `db:"has_access"`
+				TOTPRequired bool `db:"totp_required"`
+				TOTPEnabled  bool `db:"totp_enabled"`
+			}
+			query, args, err := QB.Select().
+				Column(squirrel.Alias(hasAccess, "has_access")).
+				Columns("totp_required", "totp_enabled").
+				From("users").
+				Where(squirrel.Eq{"id": currentSession(r).UserID}).
+				ToSql()
+			if err != nil {
+				utils.HandleError(w, http.StatusInternalServerError, "Internal server error")
+				log.Println(utils.ErrorWithTrace(err, err.Error()))
+				return
+			}
+			if err := db.Get(&access, query, args...); err != nil {
+				utils.HandleError(w, http.StatusInternalServerError, "Failed to check user access")
+				log.Println(utils.ErrorWithTrace(err, err.Error()))
+				return
+			}
+			if !access.HasAccess {
+				utils.HandleError(w, http.StatusForbidden, "You are not allowed to access this resource")
+				return
+			}
+			if access.TOTPRequired && !access.TOTPEnabled {
+				utils.HandleError(w, http.StatusForbidden, "Two-factor authentication must be enabled on this account, enroll at /auth/2fa/enroll")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// currentSession returns the session authenticated by RequireAuth
+func currentSession(r *http.Request) models.Session {
+	session, _ := r.Context().Value(sessionContextKey).(models.Session)
+	return session
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	query, args, err := QB.Update("sessions").
+		Set("revoked_at", time.Now()).
+		Where(squirrel.Eq{"id": session.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to revoke session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Logged out successfully",
+	})
+}
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	// The same answer is sent whether the email exists or not so the endpoint
+	// cannot be used to discover accounts
+	response := map[string]string{
+		"message": "If an account exists for this email, a reset link has been sent",
+	}
+
+	var user models.User
+	query, args, err := QB.Select("id", "name", "email").From("users").Where(squirrel.Eq{"email": req.Email}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&user, query, args...); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+		}
+		utils.SendJSONResponse(w, http.StatusOK, response)
+		return
+	}
+
+	// Failures are only logged, answering differently would tell that the
+	// account exists
+	if err := sendPasswordReset(user); err != nil {
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
+
+// sendPasswordReset mails the user a new reset token, the tokens issued before
+// it stop working
+func sendPasswordReset(user models.User) error {
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Delete("password_resets").Where(squirrel.Eq{"user_id": user.ID, "used_at": nil}).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	reset := models.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	query, args, err = QB.Insert("password_resets").
+		Columns("id", "user_id", "token_hash", "created_at", "expires_at").
+		Values(reset.ID, reset.UserID, reset.TokenHash, reset.CreatedAt, reset.ExpiresAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the following token to reset your password, it expires in %s:\n\n%s\n\nOr open %s/reset-password?token=%s\n\nIf you did not ask for a reset you can ignore this email.",
+			user.Name, passwordResetTTL, token, os.Getenv("DOMAIN"), token,
+		),
+	})
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the token so two concurrent resets cannot both use it
+	var reset models.PasswordReset
+	query, args, err := QB.Select("id", "user_id", "token_hash", "created_at", "expires_at", "used_at").
+		From("password_resets").
+		Where(squirrel.Eq{"token_hash": utils.HashToken(req.Token), "used_at": nil}).
+		Where(squirrel.Gt{"expires_at": time.Now()}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&reset, query, args...); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	query, args, err = QB.Update("password_resets").Set("used_at", time.Now()).Where(squirrel.Eq{"id": reset.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to use reset token")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := updatePassword(tx, reset.UserID, hashedPassword); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to reset password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Password reset successfully, please log in again",
+	})
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.ChangePasswordRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	var user models.User
+	query, args, err := QB.Select("id", "password").From("users").Where(squirrel.Eq{"id": session.UserID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&user, query, args...); err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := utils.CheckPassword(user.Password, req.OldPassword); err != nil {
+		utils.HandleError(w, http.StatusUnauthorized, "Old password is not correct")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if err := updatePassword(tx, user.ID, hashedPassword); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Every session was revoked with the old password, hand out a fresh one
+	// so the caller stays logged in
+	newSession, err := createSession(tx, user.ID, session.TwoFactorVerified)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to change password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, newSession)
+}
+
+// updatePassword stores the new password hash and revokes the user's sessions
+func updatePassword(tx *sqlx.Tx, userID uuid.UUID, hashedPassword string) error {
+	query, args, err := QB.Update("users").
+		Set("password", hashedPassword).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	return revokeSessions(tx, userID)
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// baseCurrency is the currency reports are converted to
+var baseCurrency = models.DefaultCurrency
+
+// SetBaseCurrency sets the currency of reports, the default one when empty
+func SetBaseCurrency(currency string) error {
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if errs := utils.Validate(struct {
+		Currency string `validate:"currency"`
+	}{currency}); errs != nil {
+		return fmt.Errorf("base currency %q is not an ISO 4217 currency code", currency)
+	}
+	baseCurrency = currency
+	return nil
+}
+
+// itemCurrency is the currency of the vendor of the items row
+const itemCurrency = "(SELECT vendors.currency FROM vendors WHERE vendors.vendor_id = items.vendor_id)"
+
+// moneyColumn selects an amount followed by its currency ("12.50 USD"), which
+// models.Money scans in the minor unit of that currency
+func moneyColumn(amount, currency, alias string) string {
+	return fmt.Sprintf("%s::text || ' ' || %s AS %s", amount, currency, alias)
+}
+
+// amountIn places an amount read from a request in the currency it is
+// charged in, the message tells what is wrong when it has too many decimals
+func amountIn(amount models.Money, currency string) (models.Money, string) {
+	placed, err := amount.In(currency)
+	if err != nil {
+		return placed, fmt.Sprintf("must have at most %d decimals in %s", models.CurrencyExponent(currency), currency)
+	}
+	return placed, ""
+}
+
+func vendorCurrency(q sqlx.Queryer, vendorID uuid.UUID) (string, error) {
+	var currency string
+	err := sqlx.Get(q, &currency, "SELECT currency FROM vendors WHERE vendor_id = $1", vendorID)
+	return currency, err
+}
+
+// SetVendorCurrency changes the currency of a vendor. Menu prices and
+// delivery fees keep their value in the new currency, which is why only admins
+// can change it and why they must fit its decimals. A fixed commission fee
+// must be cleared first, it is set by admins and would be worth something
+// else in the new currency. Orders keep the currency they were placed in.
+func SetVendorCurrency(w http.ResponseWriter, r *http.Request) {
+	vendorID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	}
+
+	var req models.VendorCurrencyRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// The vendor row stays locked so the amounts checked can't change before
+	// the currency does
+	var vendor struct {
+		Currency string       `db:"currency"`
+		FixedFee models.Money `db:"fixed_fee"`
+	}
+	query, args, err := QB.Select("currency", moneyColumn("commission_fee", "currency", "fixed_fee")).
+		From("vendors").
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&vendor, query, args...); errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if req.Currency != vendor.Currency {
+		if !vendor.FixedFee.IsZero() {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("The vendor pays a fixed commission fee of %s %s, clear it before changing the currency and set it again in %s", vendor.FixedFee, vendor.Currency, req.Currency))
+			return
+		}
+
+		var misfit bool
+		err := tx.Get(&misfit, `SELECT EXISTS (SELECT 1 FROM items WHERE vendor_id = $1 AND deleted_at IS NULL AND price <> ROUND(price, $2))
+			OR EXISTS (SELECT 1 FROM delivery_zones WHERE vendor_id = $1 AND (fee <> ROUND(fee, $2) OR min_order <> ROUND(min_order, $2)))`,
+			vendorID, models.CurrencyExponent(req.Currency))
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to check prices")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if misfit {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("Some prices or delivery fees have more decimals than %s allows, update them first", req.Currency))
+			return
+		}
+
+		query, args, err := QB.Update("vendors").
+			Set("currency", req.Currency).
+			Set("updated_at", time.Now()).
+			Where(squirrel.Eq{"vendor_id": vendorID}).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": fmt.Sprintf("The vendor now prices its menu in %s", req.Currency)})
+}
+
+// ratePattern matches the rates that fit the decimal(20, 10) rate column
+var ratePattern = regexp.MustCompile(`^[0-9]{1,10}(\.[0-9]{1,10})?$`)
+
+// exchangeRateColumns selects rates without the padding zeros of the column
+var exchangeRateColumns = []string{"currency", "base_currency", "trim_scale(rate)::text AS rate", "updated_at"}
+
+// exchangeRateList lists the rates to the base currency
+func exchangeRateList(q sqlx.Queryer) ([]models.ExchangeRateResponse, error) {
+	rates := []models.ExchangeRateResponse{}
+	query, args, err := QB.Select(exchangeRateColumns...).
+		From("exchange_rates").
+		Where(squirrel.Eq{"base_currency": baseCurrency}).
+		OrderBy("currency").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	err = sqlx.Select(q, &rates, query, args...)
+	return rates, err
+}
+
+// exchangeRates maps currencies to their rate to the base currency
+func exchangeRates(q sqlx.Queryer) (map[string]string, error) {
+	rates, err := exchangeRateList(q)
+	if err != nil {
+		return nil, err
+	}
+
+	byCurrency := map[string]string{baseCurrency: "1"}
+	for _, rate := range rates {
+		byCurrency[rate.Currency] = rate.Rate
+	}
+	return byCurrency, nil
+}
+
+// GetExchangeRates lists the rates to the base currency
+func GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := exchangeRateList(db)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get exchange rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, rates)
+}
+
+// SetExchangeRate creates or replaces the rate of a currency to the base currency
+func SetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency := r.PathValue("currency")
+	if errs := utils.Validate(struct {
+		Currency string `json:"currency" validate:"currency"`
+	}{currency}); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if currency == baseCurrency {
+		utils.HandleValidationError(w, utils.FieldErrors{"currency": "is the base currency"})
+		return
+	}
+
+	var req models.ExchangeRateRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if rate, ok := new(big.Rat).SetString(req.Rate.String()); !ok || rate.Sign() <= 0 || !ratePattern.MatchString(req.Rate.String()) {
+		utils.HandleValidationError(w, utils.FieldErrors{"rate": "must be a positive decimal with at most 10 decimals"})
+		return
+	}
+
+	var rate models.ExchangeRateResponse
+	query, args, err := QB.Insert("exchange_rates").
+		Columns("currency", "base_currency", "rate", "updated_by", "updated_at").
+		Values(currency, baseCurrency, req.Rate.String(), currentSession(r).UserID, time.Now()).
+		Suffix("ON CONFLICT (base_currency, currency) DO UPDATE SET rate = EXCLUDED.rate, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at").
+		Suffix("RETURNING " + strings.Join(exchangeRateColumns, ", ")).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&rate, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save exchange rate")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, rate)
+}
+
+func DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	query, args, err := QB.Delete("exchange_rates").
+		Where(squirrel.Eq{"currency": r.PathValue("currency"), "base_currency": baseCurrency}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete exchange rate")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Exchange rate not found")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Exchange rate deleted successfully"})
+}
+
+// queryDate reads a YYYY-MM-DD query parameter, it is nil when missing
+func queryDate(r *http.Request, name string) (*time.Time, string) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, ""
+	}
+	date, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, "must be a date in YYYY-MM-DD format"
+	}
+	return &date, ""
+}
+
+// GetSalesReport sums the orders placed from ?from= to ?to= (both included,
+// everything by default) per currency, cancelled orders left out, and
+// converts the sums to the base currency at the current exchange rates
+func GetSalesReport(w http.ResponseWriter, r *http.Request) {
+	errs := utils.FieldErrors{}
+	from, message := queryDate(r, "from")
+	if message != "" {
+		errs["from"] = message
+	}
+	to, message := queryDate(r, "to")
+	if message != "" {
+		errs["to"] = message
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	selectTotals := QB.Select("currency", "COUNT(*) AS orders", moneyColumn("SUM(order_total_cost)", "currency", "total")).
+		From("orders").
+		Where(squirrel.NotEq{"status": append([]string{models.OrderStatusCancelled}, models.UnplacedOrderStatuses...)}).
+		GroupBy("currency").
+		OrderBy("currency")
+	if from != nil {
+		selectTotals = selectTotals.Where(squirrel.GtOrEq{"created_at": *from})
+	}
+	if to != nil {
+		selectTotals = selectTotals.Where(squirrel.Lt{"created_at": to.AddDate(0, 0, 1)})
+	}
+	query, args, err := selectTotals.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	var totals []struct {
+		Currency string       `db:"currency"`
+		Orders   int          `db:"orders"`
+		Total    models.Money `db:"total"`
+	}
+	if err := db.Select(&totals, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get sales")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	rates, err := exchangeRates(db)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get exchange rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	report := models.SalesReportResponse{
+		From:         from,
+		To:           to,
+		BaseCurrency: baseCurrency,
+		Currencies:   []models.CurrencySalesReport{},
+		Total:        models.NewMoney(0, baseCurrency),
+		Unconverted:  []string{},
+	}
+	for _, total := range totals {
+		line := models.CurrencySalesReport{Currency: total.Currency, Orders: total.Orders, Total: total.Total}
+		if rate, ok := rates[total.Currency]; ok {
+			ratio, _ := new(big.Rat).SetString(rate)
+			converted, err := total.Total.CheckedExchange(baseCurrency, ratio)
+			if err == nil {
+				report.Total, err = report.Total.CheckedAdd(converted)
+			}
+			if err != nil {
+				utils.HandleError(w, http.StatusInternalServerError, "Failed to convert sales")
+				log.Println(utils.ErrorWithTrace(err, err.Error()))
+				return
+			}
+			line.Rate, line.BaseTotal = &rate, &converted
+		} else {
+			report.Unconverted = append(report.Unconverted, total.Currency)
+		}
+		report.Currencies = append(report.Currencies, line)
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, report)
+}
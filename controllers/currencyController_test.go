@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSetVendorCurrency(t *testing.T) {
+	vendorColumns := []string{"currency", "fixed_fee"}
+
+	tests := []struct {
+		name   string
+		script func(f *fakeDB)
+		status int
+	}{
+		{"fixed commission fee", func(f *fakeDB) {
+			f.expect("FROM vendors").returns(vendorColumns, []driver.Value{"USD", "0.50 USD"})
+		}, http.StatusConflict},
+		{"prices with too many decimals", func(f *fakeDB) {
+			f.expect("FROM vendors").returns(vendorColumns, []driver.Value{"USD", "0.00 USD"})
+			f.expect("SELECT EXISTS").returns([]string{"exists"}, []driver.Value{true})
+		}, http.StatusConflict},
+		{"same currency", func(f *fakeDB) {
+			f.expect("FROM vendors").returns(vendorColumns, []driver.Value{"JPY", "5 JPY"})
+		}, http.StatusOK},
+		{"changed", func(f *fakeDB) {
+			f.expect("FROM vendors").returns(vendorColumns, []driver.Value{"USD", "0.00 USD"})
+			f.expect("SELECT EXISTS").returns([]string{"exists"}, []driver.Value{false})
+			f.expect("UPDATE vendors SET currency")
+		}, http.StatusOK},
+		{"unknown vendor", func(f *fakeDB) {
+			f.expect("FROM vendors").returns(vendorColumns)
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t)
+			tt.script(f)
+
+			r := jsonRequest(http.MethodPut, "/admin/vendors/id/currency", `{"currency":"JPY"}`)
+			r.SetPathValue("id", uuid.NewString())
+			w := httptest.NewRecorder()
+			SetVendorCurrency(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ import (
 var (
 	db          *sqlx.DB
 	QB          = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
-	userColumns = []string{"id", "name", "email", "phone", "password", "created_at", "updated_at"}
+	userColumns = []string{"id", "name", "email", "phone", "password", "created_at", "updated_at", "email_verified"}
 )
 
 const customerRoleID = 3
@@ -29,28 +29,27 @@ func SetDB(database *sqlx.DB) {
 }
 
 func Signup(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20) // Limit to 10 MB
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	// Decode the JSON or multipart body
+	var req models.SignupRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	username := r.FormValue("username")
-	email := r.FormValue("email")
-	phone := r.FormValue("phone")
-	password := r.FormValue("password")
-
-	if username == "" || password == "" || email == "" || phone == "" {
-		utils.HandleError(w, http.StatusBadRequest, "Make sure you fill all fields")
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
+	username := req.Username
+	email := req.Email
+	phone := req.Phone
+	password := req.Password
+
 	// Check if the user is already signed up
 	query, args, err := QB.Select("id", "email").From("users").Where(squirrel.Eq{"email": email}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to select user")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -64,7 +63,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -77,7 +76,7 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		imgPath, err = utils.SaveImageFile(file, "users", handler.Filename)
 		if err != nil {
 			utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
-			log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
 			return
 		}
 	} else {
@@ -108,14 +107,14 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to insert user")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	// Execute the query and scan the result into the user struct
 	if err := db.QueryRowx(query, args...).StructScan(&user); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Error creating user: "+err.Error())
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -125,46 +124,48 @@ func Signup(w http.ResponseWriter, r *http.Request) {
 		Values(user.ID, customerRoleID).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign role to user")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	// Execute the role assignment
 	if _, err := db.Exec(query, args...); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Error assigning role: "+err.Error())
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
+	// Ask the user to confirm their email, the account is created either way
+	// and the email can be sent again through /auth/resend-verification
+	if err := sendEmailVerification(user); err != nil {
+		log.Println(utils.ErrorWithTrace(err, "failed to send verification email"))
+	}
+
 	// Send a JSON response with the created user information
-	utils.SendJSONResponse(w, http.StatusCreated, user)
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewUserResponse(user))
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	// Parse form data
-	err := r.ParseForm()
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	// Decode the JSON or form body
+	var req models.LoginRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Get email and password from form fields
-	email := r.FormValue("email")
-	password := r.FormValue("password")
-
-	// Check if both fields are filled
-	if email == "" || password == "" {
-		utils.HandleError(w, http.StatusBadRequest, "Email and password are required")
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
+	email := req.Email
+	password := req.Password
+
 	// Query to check if the user exists
 	var user models.User
-	query, args, err := QB.Select("id", "name", "email", "password", "img").From("users").Where(squirrel.Eq{"email": email}).ToSql()
+	query, args, err := QB.Select("id", "name", "email", "password", "img", "phone", "created_at", "updated_at", "email_verified", "totp_enabled").From("users").Where(squirrel.Eq{"email": email}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -180,15 +181,45 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Successful login: return the user's details (excluding password)
-	responseUser := map[string]interface{}{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-		"img":   user.Img,
+	// Any account can log in here, admins and vendors included, so 2FA is
+	// checked the same way as in AdminLogin and VendorLogin
+	if user.TOTPEnabled {
+		sendLoginChallenge(w, user.ID)
+		return
+	}
+
+	// Start a new session for the user
+	session, err := createSession(db, user.ID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
 	}
 
-	utils.SendJSONResponse(w, http.StatusOK, responseUser)
+	// Successful login: return the user's details (excluding password) and the session token
+	utils.SendJSONResponse(w, http.StatusOK, models.UserLoginResponse{
+		UserResponse:    models.NewUserResponse(user),
+		SessionResponse: session,
+	})
+}
+
+// canManageUser is true when the caller is the user in the path or holds
+// users:manage
+func canManageUser(w http.ResponseWriter, r *http.Request, userID string) bool {
+	session := currentSession(r)
+	if id, err := uuid.Parse(userID); err == nil && id == session.UserID {
+		return true
+	}
+	granted, err := hasPermission(db, session.UserID, "users:manage")
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return false
+	}
+	if !granted {
+		utils.HandleError(w, http.StatusForbidden, "You can only change your own account")
+	}
+	return granted
 }
 
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -198,21 +229,27 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		utils.HandleError(w, http.StatusBadRequest, "User ID is required")
 		return
 	}
+	if !canManageUser(w, r, userID) {
+		return
+	}
 
-	// Parse form data
-	err := r.ParseMultipartForm(10 << 20) // Limit to 10 MB for file upload
-	if err != nil {
-		utils.HandleError(w, http.StatusBadRequest, "Invalid form data")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	// Decode the JSON or multipart body
+	var req models.UpdateUserRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
 		return
 	}
 
 	// Fetch the current user from the database
 	var user models.User
-	query, args, err := QB.Select("id", "name", "img").From("users").Where(squirrel.Eq{"id": userID}).ToSql()
+	query, args, err := QB.Select("id", "name", "email", "img", "phone", "created_at", "updated_at", "email_verified").From("users").Where(squirrel.Eq{"id": userID}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -222,7 +259,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the new username and image
-	newUsername := r.FormValue("username")
+	newUsername := req.Username
 	file, handler, err := r.FormFile("img") // New image file
 
 	var newImgPath string
@@ -244,7 +281,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		newImgPath, err = utils.SaveImageFile(file, "users", handler.Filename)
 		if err != nil {
 			utils.HandleError(w, http.StatusInternalServerError, "Failed to save new image")
-			log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
 			return
 		}
 
@@ -256,33 +293,31 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the user data in the database
+	user.Name = newUsername
+	user.Img = newImgPath
+	user.UpdatedAt = time.Now()
 	updateQuery, args, err := QB.Update("users").
-		Set("name", newUsername).
-		Set("img", newImgPath).
+		Set("name", user.Name).
+		Set("img", user.Img).
+		Set("updated_at", user.UpdatedAt).
 		Where(squirrel.Eq{"id": userID}).
 		ToSql()
 
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create update query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	// Execute the update query
 	if _, err := db.Exec(updateQuery, args...); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to update user")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	// Return the updated user details
-	updatedUser := map[string]interface{}{
-		"id":   user.ID,
-		"name": newUsername,
-		"img":  newImgPath,
-	}
-
-	utils.SendJSONResponse(w, http.StatusOK, updatedUser)
+	utils.SendJSONResponse(w, http.StatusOK, models.NewUserResponse(user))
 }
 
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -292,13 +327,16 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		utils.HandleError(w, http.StatusBadRequest, "User ID is required")
 		return
 	}
+	if !canManageUser(w, r, userID) {
+		return
+	}
 
 	// Fetch the user's details (including image path) before deletion
 	var user models.User
 	query, args, err := QB.Select("id", "img").From("users").Where(squirrel.Eq{"id": userID}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -313,7 +351,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		imgPath := strings.ReplaceAll(user.Img, "http://localhost:8000/", "") // Strip the base URL
 		if err := os.Remove(imgPath); err != nil {
 			utils.HandleError(w, http.StatusInternalServerError, "Failed to delete user image")
-			log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
 			return
 		}
 	}
@@ -322,13 +360,13 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	query, args, err = QB.Delete("user_roles").Where(squirrel.Eq{"user_id": userID}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create role deletion query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	if _, err := db.Exec(query, args...); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete user roles")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -336,13 +374,13 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	query, args, err = QB.Delete("users").Where(squirrel.Eq{"id": userID}).ToSql()
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create user deletion query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	if _, err := db.Exec(query, args...); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete user")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
@@ -355,19 +393,19 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	var users []models.User
 
-	query, args, err := QB.Select("id", "name", "email", "phone", "img", "created_at", "updated_at").From("users").ToSql()
+	query, args, err := QB.Select("id", "name", "email", "phone", "img", "created_at", "updated_at", "email_verified").From("users").ToSql()
 
 	if err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
 	if err := db.Select(&users, query, args...); err != nil {
 		utils.HandleError(w, http.StatusInternalServerError, "Failed to fetch users")
-		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
 		return
 	}
 
-	utils.SendJSONResponse(w, http.StatusOK, users)
+	utils.SendJSONResponse(w, http.StatusOK, models.NewUserResponses(users))
 }
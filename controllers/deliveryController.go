@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// zoneCurrency is the currency of the vendor of the delivery_zones row
+const zoneCurrency = "(SELECT vendors.currency FROM vendors WHERE vendors.vendor_id = delivery_zones.vendor_id)"
+
+var deliveryZoneColumns = []string{
+	"id", "vendor_id", "name", "kind", "center_latitude", "center_longitude", "radius_km", "polygon",
+	moneyColumn("fee", zoneCurrency, "fee"), moneyColumn("min_order", zoneCurrency, "min_order"), "created_at", "updated_at",
+}
+
+func deliveryZones(q sqlx.Queryer, vendorID uuid.UUID) ([]models.DeliveryZone, error) {
+	zones := []models.DeliveryZone{}
+	query, args, err := QB.Select(deliveryZoneColumns...).
+		From("delivery_zones").
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		OrderBy("fee", "name").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	err = sqlx.Select(q, &zones, query, args...)
+	return zones, err
+}
+
+// zoneContains reports whether the point is inside the delivery zone
+func zoneContains(zone models.DeliveryZone, lat, lng float64) bool {
+	switch zone.Kind {
+	case models.DeliveryZoneRadius:
+		return zone.CenterLatitude != nil && zone.CenterLongitude != nil && zone.RadiusKm != nil &&
+			utils.DistanceKm(*zone.CenterLatitude, *zone.CenterLongitude, lat, lng) <= *zone.RadiusKm
+	case models.DeliveryZonePolygon:
+		return utils.PointInPolygon(lat, lng, zone.Polygon)
+	}
+	return false
+}
+
+// matchDeliveryZone picks the cheapest zone covering the point whose minimum
+// order the subtotal reaches. covered tells whether any zone covers the point,
+// so a nil zone with covered set means the subtotal is too low.
+func matchDeliveryZone(zones []models.DeliveryZone, lat, lng float64, subtotal models.Money) (zone *models.DeliveryZone, covered bool, minOrder models.Money) {
+	for i := range zones {
+		if !zoneContains(zones[i], lat, lng) {
+			continue
+		}
+		if !covered || zones[i].MinOrder.Cmp(minOrder) < 0 {
+			minOrder = zones[i].MinOrder
+		}
+		covered = true
+		if zones[i].MinOrder.Cmp(subtotal) > 0 {
+			continue
+		}
+		if zone == nil || zones[i].Fee.Cmp(zone.Fee) < 0 {
+			zone = &zones[i]
+		}
+	}
+	return zone, covered, minOrder
+}
+
+// deliveryZoneFromRequest validates the request against the zone kind and
+// builds the zone, radius zones default to the vendor's location
+func deliveryZoneFromRequest(q sqlx.Queryer, vendorID uuid.UUID, req models.DeliveryZoneRequest) (models.DeliveryZone, utils.FieldErrors, error) {
+	zone := models.DeliveryZone{
+		VendorID: vendorID,
+		Name:     req.Name,
+		Kind:     req.Kind,
+	}
+
+	// Fees are charged in the vendor's currency
+	currency, err := vendorCurrency(q, vendorID)
+	if err != nil {
+		return zone, nil, err
+	}
+	errs := utils.FieldErrors{}
+	var message string
+	if zone.Fee, message = amountIn(req.Fee, currency); message != "" {
+		errs["fee"] = message
+	}
+	if zone.MinOrder, message = amountIn(req.MinOrder, currency); message != "" {
+		errs["min_order"] = message
+	}
+	if len(errs) > 0 {
+		return zone, errs, nil
+	}
+
+	switch req.Kind {
+	case models.DeliveryZoneRadius:
+		if req.RadiusKm == nil {
+			return zone, utils.FieldErrors{"radius_km": "is required for radius zones"}, nil
+		}
+		if (req.CenterLatitude == nil) != (req.CenterLongitude == nil) {
+			return zone, utils.FieldErrors{"center": "center_latitude and center_longitude must be sent together"}, nil
+		}
+		zone.RadiusKm = req.RadiusKm
+		zone.CenterLatitude, zone.CenterLongitude = req.CenterLatitude, req.CenterLongitude
+		if zone.CenterLatitude == nil {
+			var location struct {
+				Latitude  *float64 `db:"latitude"`
+				Longitude *float64 `db:"longitude"`
+			}
+			if err := sqlx.Get(q, &location, "SELECT latitude, longitude FROM vendors WHERE vendor_id = $1", vendorID); err != nil {
+				return zone, nil, err
+			}
+			if location.Latitude == nil {
+				return zone, utils.FieldErrors{"center": "is required until the vendor's location is set"}, nil
+			}
+			zone.CenterLatitude, zone.CenterLongitude = location.Latitude, location.Longitude
+		}
+	case models.DeliveryZonePolygon:
+		if len(req.Polygon) < 3 {
+			return zone, utils.FieldErrors{"polygon": "must have at least 3 points"}, nil
+		}
+		for i, point := range req.Polygon {
+			if math.Abs(point[0]) > 90 || math.Abs(point[1]) > 180 {
+				return zone, utils.FieldErrors{fmt.Sprintf("polygon[%d]", i): "must be a [latitude, longitude] pair"}, nil
+			}
+		}
+		zone.Polygon = req.Polygon
+	}
+	return zone, nil, nil
+}
+
+// GetDeliveryZones lists the delivery zones of the vendor the user works for
+func GetDeliveryZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := deliveryZones(db, currentVendorID(r))
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get delivery zones")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, zones)
+}
+
+func CreateDeliveryZone(w http.ResponseWriter, r *http.Request) {
+	var req models.DeliveryZoneRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	zone, errs, err := deliveryZoneFromRequest(db, currentVendorID(r), req)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	zone.ID = uuid.New()
+	zone.CreatedAt = time.Now()
+	zone.UpdatedAt = time.Now()
+	query, args, err := QB.Insert("delivery_zones").
+		Columns("id", "vendor_id", "name", "kind", "center_latitude", "center_longitude", "radius_km",
+			"polygon", "fee", "min_order", "created_at", "updated_at").
+		Values(zone.ID, zone.VendorID, zone.Name, zone.Kind, zone.CenterLatitude, zone.CenterLongitude, zone.RadiusKm,
+			zone.Polygon, zone.Fee, zone.MinOrder, zone.CreatedAt, zone.UpdatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create delivery zone")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, zone)
+}
+
+// UpdateDeliveryZone replaces one of the vendor's delivery zones
+func UpdateDeliveryZone(w http.ResponseWriter, r *http.Request) {
+	vendorID := currentVendorID(r)
+	zoneID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Delivery zone not found")
+		return
+	}
+
+	var req models.DeliveryZoneRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	zone, errs, err := deliveryZoneFromRequest(db, vendorID, req)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	query, args, err := QB.Update("delivery_zones").
+		Set("name", zone.Name).
+		Set("kind", zone.Kind).
+		Set("center_latitude", zone.CenterLatitude).
+		Set("center_longitude", zone.CenterLongitude).
+		Set("radius_km", zone.RadiusKm).
+		Set("polygon", zone.Polygon).
+		Set("fee", zone.Fee).
+		Set("min_order", zone.MinOrder).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": zoneID, "vendor_id": vendorID}).
+		Suffix(fmt.Sprintf("RETURNING %s", strings.Join(deliveryZoneColumns, ", "))).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&zone, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Delivery zone not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update delivery zone")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, zone)
+}
+
+func DeleteDeliveryZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Delivery zone not found")
+		return
+	}
+
+	var id uuid.UUID
+	err = db.Get(&id, "DELETE FROM delivery_zones WHERE id = $1 AND vendor_id = $2 RETURNING id", zoneID, currentVendorID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Delivery zone not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete delivery zone")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Delivery zone deleted successfully"})
+}
+
+// GetDeliveryQuote tells whether the vendor delivers to ?lat= and ?lng= and
+// the fee it charges there. With ?subtotal= only zones whose minimum order it
+// reaches are considered.
+func GetDeliveryQuote(w http.ResponseWriter, r *http.Request) {
+	errs := utils.FieldErrors{}
+	lat, message := queryFloat(r, "lat", nil, -90, 90)
+	if message != "" {
+		errs["lat"] = message
+	}
+	lng, message := queryFloat(r, "lng", nil, -180, 180)
+	if message != "" {
+		errs["lng"] = message
+	}
+	subtotal, message := queryMoney(r, "subtotal")
+	if message != "" {
+		errs["subtotal"] = message
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	vendorID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	}
+	currency, err := vendorCurrency(db, vendorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	// Without a subtotal every minimum order is taken as reached
+	limit := models.NewMoney(math.MaxInt64, currency)
+	if subtotal != nil {
+		if limit, message = amountIn(*subtotal, currency); message != "" {
+			utils.HandleValidationError(w, utils.FieldErrors{"subtotal": message})
+			return
+		}
+	}
+
+	zones, err := deliveryZones(db, vendorID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get delivery zones")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Vendors without zones deliver everywhere for free
+	quote := models.DeliveryQuoteResponse{
+		Delivers: len(zones) == 0,
+		Fee:      models.NewMoney(0, currency),
+		MinOrder: models.NewMoney(0, currency),
+		Currency: currency,
+	}
+	if zone, _, _ := matchDeliveryZone(zones, lat, lng, limit); zone != nil {
+		quote = models.DeliveryQuoteResponse{
+			Delivers: true,
+			ZoneID:   &zone.ID,
+			ZoneName: zone.Name,
+			Fee:      zone.Fee,
+			MinOrder: zone.MinOrder,
+			Currency: currency,
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, quote)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB is a database/sql driver that answers statements from a script so
+// handlers can be tested without Postgres. Each statement must contain the
+// SQL of the next expectation, anything else fails the test.
+type fakeDB struct {
+	t        *testing.T
+	mu       sync.Mutex
+	expected []*expectation
+	commits  int
+}
+
+type expectation struct {
+	sql      string
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+	// args holds the arguments the statement was run with
+	args []driver.Value
+	done bool
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// useFakeDB points the controllers at a new scripted database for the test
+func useFakeDB(t *testing.T) *fakeDB {
+	t.Helper()
+	f := &fakeDB{t: t}
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeDBsMu.Unlock()
+
+	conn, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	db = sqlx.NewDb(conn, "postgres")
+	t.Cleanup(func() {
+		db = previous
+		conn.Close()
+		fakeDBsMu.Lock()
+		delete(fakeDBs, t.Name())
+		fakeDBsMu.Unlock()
+		for _, e := range f.expected {
+			if !e.done {
+				t.Errorf("statement containing %q was never run", e.sql)
+			}
+		}
+	})
+	return f
+}
+
+// expect adds the next statement, matched by a part of its SQL
+func (f *fakeDB) expect(sql string) *expectation {
+	e := &expectation{sql: sql}
+	f.mu.Lock()
+	f.expected = append(f.expected, e)
+	f.mu.Unlock()
+	return e
+}
+
+// returns sets the rows a query answers with
+func (e *expectation) returns(columns []string, rows ...[]driver.Value) *expectation {
+	e.columns, e.rows = columns, rows
+	return e
+}
+
+// affects sets the number of rows a statement changes
+func (e *expectation) affects(n int64) *expectation {
+	e.affected = n
+	return e
+}
+
+// fails makes the statement return err
+func (e *expectation) fails(err error) *expectation {
+	e.err = err
+	return e
+}
+
+// next returns the expectation the statement has to match
+func (f *fakeDB) next(query string, args []driver.NamedValue) (*expectation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.expected {
+		if e.done {
+			continue
+		}
+		if !strings.Contains(query, e.sql) {
+			f.t.Errorf("unexpected statement %q, want one containing %q", query, e.sql)
+			return nil, fmt.Errorf("unexpected statement %q", query)
+		}
+		e.done = true
+		for _, arg := range args {
+			e.args = append(e.args, arg.Value)
+		}
+		return e, e.err
+	}
+	f.t.Errorf("unexpected statement %q after the script ended", query)
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	f, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return &fakeConn{db: f}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{c.db}, nil }
+
+// CheckNamedValue passes every argument to the script as it is
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: e.columns, rows: e.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(e.affected), nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	tx.db.commits++
+	tx.db.mu.Unlock()
+	return nil
+}
+
+func (tx fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
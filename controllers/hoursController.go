@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"resturant/models"
+	"resturant/utils"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// vendorOpenNow is true when the current time in the vendor's time zone falls
+// in one of its opening intervals that is not shut by a closure. The part of
+// an overnight interval after midnight belongs to the previous day, closures
+// included. Vendors without opening hours are open unless closed for the day.
+// It expects the vendors table in the query.
+const vendorOpenNow = `(
+	SELECT CASE WHEN NOT EXISTS (SELECT 1 FROM vendor_opening_hours h WHERE h.vendor_id = vendors.vendor_id)
+		THEN NOT EXISTS (SELECT 1 FROM vendor_closures c WHERE c.vendor_id = vendors.vendor_id AND c.date = l.at::date)
+		ELSE EXISTS (
+			SELECT 1 FROM vendor_opening_hours h
+			WHERE h.vendor_id = vendors.vendor_id AND (
+				(h.weekday = EXTRACT(DOW FROM l.at) AND l.at::time >= h.opens_at
+					AND (h.opens_at >= h.closes_at OR l.at::time < h.closes_at)
+					AND NOT EXISTS (SELECT 1 FROM vendor_closures c WHERE c.vendor_id = h.vendor_id AND c.date = l.at::date))
+				OR (h.opens_at >= h.closes_at AND h.weekday = EXTRACT(DOW FROM l.at - INTERVAL '1 day') AND l.at::time < h.closes_at
+					AND NOT EXISTS (SELECT 1 FROM vendor_closures c WHERE c.vendor_id = h.vendor_id AND c.date = l.at::date - 1))
+			))
+		END
+	FROM (SELECT NOW() AT TIME ZONE vendors.time_zone AS at) l
+)`
+
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+const minutesPerWeek = 7 * 24 * 60
+
+// vendorIsOpen reports whether the vendor takes orders right now
+func vendorIsOpen(q sqlx.Queryer, vendorID uuid.UUID) (bool, error) {
+	var open bool
+	err := sqlx.Get(q, &open, "SELECT "+vendorOpenNow+" FROM vendors WHERE vendor_id = $1", vendorID)
+	return open, err
+}
+
+// validTimeZone checks the time zone against the names Postgres knows, which
+// is what the opening hours are evaluated with
+func validTimeZone(q sqlx.Queryer, name string) (bool, error) {
+	var valid bool
+	err := sqlx.Get(q, &valid, "SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = $1)", name)
+	return valid, err
+}
+
+// clockMinutes converts a validated HH:MM time to minutes after midnight
+func clockMinutes(clock string) int {
+	hours, _ := strconv.Atoi(clock[:2])
+	minutes, _ := strconv.Atoi(clock[3:])
+	return hours*60 + minutes
+}
+
+// validateOpeningHours checks the times of every interval, whose fields
+// utils.Validate already checked, and that no two of them overlap over the
+// week, overnight intervals included
+func validateOpeningHours(hours []models.OpeningInterval) utils.FieldErrors {
+	errs := utils.FieldErrors{}
+	type span struct{ start, end int }
+	spans := make([]span, len(hours))
+	for i, interval := range hours {
+		field := fmt.Sprintf("hours[%d]", i)
+		if !clockPattern.MatchString(interval.OpensAt) {
+			errs[field+".opens_at"] = "must be a time in HH:MM format"
+			continue
+		}
+		if !clockPattern.MatchString(interval.ClosesAt) {
+			errs[field+".closes_at"] = "must be a time in HH:MM format"
+			continue
+		}
+
+		opens, closes := clockMinutes(interval.OpensAt), clockMinutes(interval.ClosesAt)
+		if closes <= opens {
+			closes += 24 * 60
+		}
+		start := interval.Weekday*24*60 + opens
+		spans[i] = span{start, start + closes - opens}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i := range spans {
+		for j := 0; j < i; j++ {
+			// Compare shifted by a week as well so Saturday night meets Sunday
+			for _, shift := range []int{-minutesPerWeek, 0, minutesPerWeek} {
+				if spans[i].start < spans[j].end+shift && spans[j].start+shift < spans[i].end {
+					errs[fmt.Sprintf("hours[%d]", i)] = fmt.Sprintf("overlaps hours[%d]", j)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func openingHours(q sqlx.Queryer, vendorID uuid.UUID) (models.OpeningHoursResponse, error) {
+	var response models.OpeningHoursResponse
+	err := sqlx.Get(q, &response,
+		"SELECT time_zone, "+vendorOpenNow+" AS is_open_now FROM vendors WHERE vendor_id = $1", vendorID)
+	if err != nil {
+		return response, err
+	}
+
+	response.Hours = []models.OpeningInterval{}
+	query, args, err := QB.Select("weekday", "to_char(opens_at, 'HH24:MI') AS opens_at", "to_char(closes_at, 'HH24:MI') AS closes_at").
+		From("vendor_opening_hours").
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		OrderBy("weekday", "opens_at").
+		ToSql()
+	if err != nil {
+		return response, err
+	}
+	err = sqlx.Select(q, &response.Hours, query, args...)
+	return response, err
+}
+
+// GetOpeningHours returns the weekly schedule of the vendor the user works for
+func GetOpeningHours(w http.ResponseWriter, r *http.Request) {
+	response, err := openingHours(db, currentVendorID(r))
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get opening hours")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
+
+// UpdateOpeningHours replaces the time zone and the weekly schedule of the vendor
+func UpdateOpeningHours(w http.ResponseWriter, r *http.Request) {
+	vendorID := currentVendorID(r)
+
+	var req models.OpeningHoursRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if errs := validateOpeningHours(req.Hours); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if valid, err := validTimeZone(db, req.TimeZone); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check time zone")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !valid {
+		utils.HandleValidationError(w, utils.FieldErrors{"time_zone": "must be an IANA time zone, e.g. Africa/Tripoli"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Update("vendors").
+		Set("time_zone", req.TimeZone).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update time zone")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM vendor_opening_hours WHERE vendor_id = $1", vendorID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update opening hours")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if len(req.Hours) > 0 {
+		insert := QB.Insert("vendor_opening_hours").Columns("vendor_id", "weekday", "opens_at", "closes_at")
+		for _, interval := range req.Hours {
+			insert = insert.Values(vendorID, interval.Weekday, interval.OpensAt, interval.ClosesAt)
+		}
+		query, args, err := insert.ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update opening hours")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	response, err := openingHours(tx, vendorID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get opening hours")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update opening hours")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
+
+var closureColumns = []string{"id", "vendor_id", "to_char(date, 'YYYY-MM-DD') AS date", "reason", "created_at"}
+
+// GetClosures lists the closures of the vendor from today on, in its time zone
+func GetClosures(w http.ResponseWriter, r *http.Request) {
+	closures := []models.VendorClosure{}
+	query, args, err := QB.Select(closureColumns...).
+		From("vendor_closures").
+		Where(squirrel.Eq{"vendor_id": currentVendorID(r)}).
+		Where("date >= (SELECT (NOW() AT TIME ZONE time_zone)::date FROM vendors WHERE vendors.vendor_id = vendor_closures.vendor_id)").
+		OrderBy("date").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&closures, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get closures")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, closures)
+}
+
+// CreateClosure closes the vendor for a whole local date, e.g. a holiday
+func CreateClosure(w http.ResponseWriter, r *http.Request) {
+	var req models.ClosureRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		utils.HandleValidationError(w, utils.FieldErrors{"date": "must be a date in YYYY-MM-DD format"})
+		return
+	}
+
+	closure := models.VendorClosure{
+		ID:        uuid.New(),
+		VendorID:  currentVendorID(r),
+		Date:      req.Date,
+		Reason:    req.Reason,
+		CreatedAt: time.Now(),
+	}
+	query, args, err := QB.Insert("vendor_closures").
+		Columns("id", "vendor_id", "date", "reason", "created_at").
+		Values(closure.ID, closure.VendorID, closure.Date, closure.Reason, closure.CreatedAt).
+		Suffix("ON CONFLICT (vendor_id, date) DO NOTHING").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create closure")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusConflict, "The vendor is already closed on this date")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, closure)
+}
+
+func DeleteClosure(w http.ResponseWriter, r *http.Request) {
+	closureID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Closure not found")
+		return
+	}
+
+	var id uuid.UUID
+	err = db.Get(&id, "DELETE FROM vendor_closures WHERE id = $1 AND vendor_id = $2 RETURNING id", closureID, currentVendorID(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Closure not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete closure")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Closure deleted successfully"})
+}
@@ -0,0 +1,543 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// commissionPercent is the percentage of every payment the platform keeps
+// from vendors without their own, 0 unless set
+var commissionPercent = "0"
+
+// SetCommissionRate sets the commission of the platform as a percentage such
+// as "12.5", none when empty
+func SetCommissionRate(percent string) error {
+	if percent == "" {
+		percent = "0"
+	}
+	rate, ok := new(big.Rat).SetString(percent)
+	if !ok || !percentPattern.MatchString(percent) || rate.Cmp(big.NewRat(100, 1)) > 0 {
+		return fmt.Errorf("commission %q is not a percentage between 0 and 100 with at most 2 decimals", percent)
+	}
+	commissionPercent = percent
+	return nil
+}
+
+// errUnbalancedEntry is returned when the postings of an entry don't add up to zero
+var errUnbalancedEntry = errors.New("journal entry does not balance")
+
+// accountKinds is the kind of every account an owner can have
+var accountKinds = map[string]map[string]string{
+	models.LedgerOwnerPlatform: {
+		models.AccountCash:       models.AccountAsset,
+		models.AccountCommission: models.AccountRevenue,
+		models.AccountPromotions: models.AccountExpense,
+	},
+	models.LedgerOwnerVendor:   {models.AccountCash: models.AccountAsset, models.AccountPayable: models.AccountLiability},
+	models.LedgerOwnerCustomer: {models.AccountWallet: models.AccountLiability},
+}
+
+// posting debits (a positive amount) or credits (a negative one) an account
+// of an owner, the account is created on first use
+type posting struct {
+	ownerType string
+	ownerID   uuid.UUID
+	name      string
+	amount    models.Money
+}
+
+// ledgerAccount returns the ID of an owner's account in a currency, creating it when needed
+func ledgerAccount(q sqlx.Ext, ownerType string, ownerID uuid.UUID, name, currency string) (uuid.UUID, error) {
+	var id uuid.UUID
+	kind, ok := accountKinds[ownerType][name]
+	if !ok {
+		return id, fmt.Errorf("unknown ledger account %s:%s", ownerType, name)
+	}
+
+	// A concurrent entry may create the account first, the unique constraint
+	// makes this insert a no-op in that case
+	query, args, err := QB.Insert("ledger_accounts").
+		Columns("id", "owner_type", "owner_id", "name", "kind", "currency", "created_at").
+		Values(uuid.New(), ownerType, ownerID, name, kind, currency, time.Now()).
+		Suffix("ON CONFLICT (owner_type, owner_id, name, currency) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return id, err
+	}
+	if _, err := q.Exec(query, args...); err != nil {
+		return id, err
+	}
+
+	query, args, err = QB.Select("id").
+		From("ledger_accounts").
+		Where(squirrel.Eq{"owner_type": ownerType, "owner_id": ownerID, "name": name, "currency": currency}).
+		ToSql()
+	if err != nil {
+		return id, err
+	}
+	err = sqlx.Get(q, &id, query, args...)
+	return id, err
+}
+
+// postEntry records a journal entry, its postings must add up to zero in
+// every currency. Zero postings are left out, an entry left without postings
+// is not recorded.
+func postEntry(q sqlx.Ext, kind string, orderID, referenceID *uuid.UUID, description string, postings []posting) error {
+	sums := map[string]int64{}
+	var kept []posting
+	for _, p := range postings {
+		sums[p.amount.Currency] += p.amount.Amount
+		if !p.amount.IsZero() {
+			kept = append(kept, p)
+		}
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s is off by %s", errUnbalancedEntry, description, models.NewMoney(sum, currency))
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+
+	entryID := uuid.New()
+	now := time.Now()
+	query, args, err := QB.Insert("journal_entries").
+		Columns("id", "kind", "order_id", "reference_id", "description", "created_at").
+		Values(entryID, kind, orderID, referenceID, description, now).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(query, args...); err != nil {
+		return err
+	}
+
+	insertPostings := QB.Insert("ledger_postings").Columns("id", "entry_id", "account_id", "amount", "created_at")
+	for _, p := range kept {
+		accountID, err := ledgerAccount(q, p.ownerType, p.ownerID, p.name, p.amount.Currency)
+		if err != nil {
+			return err
+		}
+		insertPostings = insertPostings.Values(uuid.New(), entryID, accountID, p.amount, now)
+	}
+	query, args, err = insertPostings.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// negate turns a debit into a credit and back
+func negate(amount models.Money) models.Money {
+	return models.NewMoney(-amount.Amount, amount.Currency)
+}
+
+// orderCommission is the platform's share of an amount paid for an order:
+// the order's percentage of it and the same share of the fixed fee, so the
+// whole fee is kept once the order is paid and given back with refunds
+func orderCommission(order models.Order, amount models.Money) models.Money {
+	percent := commissionPercent
+	if order.CommissionPercent != nil {
+		percent = *order.CommissionPercent
+	}
+	rate, _ := new(big.Rat).SetString(percent)
+	commission := amount.MulRat(rate.Quo(rate, big.NewRat(100, 1)))
+	if !order.CommissionFee.IsZero() && !order.OrderTotalCost.IsZero() {
+		commission = commission.Add(order.CommissionFee.MulRatio(amount.Amount, order.OrderTotalCost.Amount))
+	}
+	return minMoney(commission, amount)
+}
+
+// postOrderPayment records money received for an order, paid with method:
+// card payments land at the payment provider, cash in the vendor's drawer and
+// wallet payments come off what the platform owes the customer. Either way
+// the vendor earns the amount less the platform commission.
+func postOrderPayment(q sqlx.Ext, order models.Order, referenceID uuid.UUID, amount models.Money, method string) error {
+	commission := orderCommission(order, amount)
+	received := posting{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCash, amount}
+	description := "Card payment for order " + order.ID.String()
+	switch method {
+	case models.PaymentTypeCash:
+		received = posting{models.LedgerOwnerVendor, order.VendorID, models.AccountCash, amount}
+		description = "Cash payment for order " + order.ID.String()
+	case models.PaymentTypeWallet:
+		received = posting{models.LedgerOwnerCustomer, order.CustomerID, models.AccountWallet, amount}
+		description = "Wallet payment for order " + order.ID.String()
+	}
+	return postEntry(q, models.EntryOrderPayment, &order.ID, &referenceID, description, []posting{
+		received,
+		{models.LedgerOwnerVendor, order.VendorID, models.AccountPayable, negate(amount.Sub(commission))},
+		{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCommission, negate(commission)},
+	})
+}
+
+// postRefund records money given back for an order, on the card at the
+// provider, in cash by the vendor or to the customer's wallet. The vendor and
+// the platform give back their share of it.
+func postRefund(q sqlx.Ext, order models.Order, referenceID uuid.UUID, card, cash, wallet models.Money) error {
+	amount := card.Add(cash).Add(wallet)
+	commission := orderCommission(order, amount)
+	return postEntry(q, models.EntryRefund, &order.ID, &referenceID, "Refund for order "+order.ID.String(), []posting{
+		{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCash, negate(card)},
+		{models.LedgerOwnerVendor, order.VendorID, models.AccountCash, negate(cash)},
+		{models.LedgerOwnerCustomer, order.CustomerID, models.AccountWallet, negate(wallet)},
+		{models.LedgerOwnerVendor, order.VendorID, models.AccountPayable, amount.Sub(commission)},
+		{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCommission, commission},
+	})
+}
+
+// postPayout records the settlement of a statement: the vendor's earnings
+// are paid with the cash they kept and the transfer from the platform
+func postPayout(q sqlx.Ext, payout models.Payout) error {
+	return postEntry(q, models.EntryPayout, nil, &payout.ID, "Payout to vendor "+payout.VendorID.String(), []posting{
+		{models.LedgerOwnerVendor, payout.VendorID, models.AccountPayable, payout.NetPayout},
+		{models.LedgerOwnerVendor, payout.VendorID, models.AccountCash, negate(payout.CashCollected)},
+		{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCash, negate(payout.AmountDue)},
+	})
+}
+
+// ledgerAccountColumns selects accounts with their balance on their normal side
+var ledgerAccountColumns = []string{
+	"ledger_accounts.id", "owner_type", "owner_id", "name", "kind", "currency",
+	moneyColumn(fmt.Sprintf("COALESCE((SELECT SUM(amount) FROM ledger_postings WHERE ledger_postings.account_id = ledger_accounts.id), 0) * CASE WHEN kind IN ('%s', '%s') THEN 1 ELSE -1 END", models.AccountAsset, models.AccountExpense), "currency", "balance"),
+	"created_at",
+}
+
+// GetLedgerAccounts lists the ledger accounts with their balance, filtered
+// with ?owner_type=, ?owner_id= and ?currency=
+func GetLedgerAccounts(w http.ResponseWriter, r *http.Request) {
+	selectAccounts := QB.Select(ledgerAccountColumns...).
+		From("ledger_accounts").
+		OrderBy("owner_type", "owner_id", "name", "currency")
+	if ownerType := r.URL.Query().Get("owner_type"); ownerType != "" {
+		selectAccounts = selectAccounts.Where(squirrel.Eq{"owner_type": ownerType})
+	}
+	if raw := r.URL.Query().Get("owner_id"); raw != "" {
+		ownerID, err := uuid.Parse(raw)
+		if err != nil {
+			utils.HandleValidationError(w, utils.FieldErrors{"owner_id": "must be a UUID"})
+			return
+		}
+		selectAccounts = selectAccounts.Where(squirrel.Eq{"owner_id": ownerID})
+	}
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		selectAccounts = selectAccounts.Where(squirrel.Eq{"currency": currency})
+	}
+	query, args, err := selectAccounts.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	accounts := []models.LedgerAccount{}
+	if err := db.Select(&accounts, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get ledger accounts")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, accounts)
+}
+
+// GetLedgerAccountPostings lists the postings of an account with their
+// entry, newest first
+func GetLedgerAccountPostings(w http.ResponseWriter, r *http.Request) {
+	accountID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Account not found")
+		return
+	}
+	var exists bool
+	if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM ledger_accounts WHERE id = $1)", accountID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get ledger account")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !exists {
+		utils.HandleError(w, http.StatusNotFound, "Account not found")
+		return
+	}
+
+	query, args, err := QB.Select("ledger_postings.id", "entry_id", "journal_entries.kind", "journal_entries.order_id",
+		"journal_entries.reference_id", "journal_entries.description",
+		moneyColumn("ledger_postings.amount", "ledger_accounts.currency", "amount"), "ledger_postings.created_at").
+		From("ledger_postings").
+		Join("journal_entries ON journal_entries.id = ledger_postings.entry_id").
+		Join("ledger_accounts ON ledger_accounts.id = ledger_postings.account_id").
+		Where(squirrel.Eq{"ledger_postings.account_id": accountID}).
+		OrderBy("ledger_postings.created_at DESC").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	postings := []models.AccountPostingResponse{}
+	if err := db.Select(&postings, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get postings")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, postings)
+}
+
+// GetJournalEntries lists journal entries with their postings, newest first
+// and 100 at most, filtered with ?order_id= and ?kind=
+func GetJournalEntries(w http.ResponseWriter, r *http.Request) {
+	selectEntries := QB.Select("id", "kind", "order_id", "reference_id", "description", "created_at").
+		From("journal_entries").
+		OrderBy("created_at DESC").
+		Limit(100)
+	if raw := r.URL.Query().Get("order_id"); raw != "" {
+		orderID, err := uuid.Parse(raw)
+		if err != nil {
+			utils.HandleValidationError(w, utils.FieldErrors{"order_id": "must be a UUID"})
+			return
+		}
+		selectEntries = selectEntries.Where(squirrel.Eq{"order_id": orderID})
+	}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		selectEntries = selectEntries.Where(squirrel.Eq{"kind": kind})
+	}
+	query, args, err := selectEntries.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	entries := []models.JournalEntry{}
+	if err := db.Select(&entries, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get journal entries")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if len(entries) == 0 {
+		utils.SendJSONResponse(w, http.StatusOK, entries)
+		return
+	}
+
+	entryIDs := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		entryIDs = append(entryIDs, entry.ID)
+	}
+	query, args, err = QB.Select("ledger_postings.id", "entry_id", "account_id",
+		moneyColumn("amount", "ledger_accounts.currency", "amount"), "ledger_postings.created_at").
+		From("ledger_postings").
+		Join("ledger_accounts ON ledger_accounts.id = ledger_postings.account_id").
+		Where(squirrel.Eq{"entry_id": entryIDs}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	var postings []models.LedgerPosting
+	if err := db.Select(&postings, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get postings")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	for i := range entries {
+		entries[i].Postings = []models.LedgerPosting{}
+		for _, p := range postings {
+			if p.EntryID == entries[i].ID {
+				entries[i].Postings = append(entries[i].Postings, p)
+			}
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, entries)
+}
+
+// ledgerTriggers keep the ledger append-only and balanced
+var ledgerTriggers = []struct{ table, name string }{
+	{"journal_entries", "journal_entries_append_only"},
+	{"journal_entries", "journal_entries_no_truncate"},
+	{"ledger_postings", "ledger_postings_append_only"},
+	{"ledger_postings", "ledger_postings_no_truncate"},
+	{"ledger_postings", "ledger_postings_balanced"},
+	{"ledger_accounts", "ledger_accounts_append_only"},
+}
+
+// ledgerSum sums the postings on an account of the owner type for the
+// journal entries the filter keeps
+func ledgerSum(ownerType, account, filter string) string {
+	return fmt.Sprintf(`COALESCE((SELECT SUM(ledger_postings.amount) FROM journal_entries
+		JOIN ledger_postings ON ledger_postings.entry_id = journal_entries.id
+		JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+		WHERE ledger_accounts.owner_type = '%s' AND ledger_accounts.name = '%s' AND %s), 0)`, ownerType, account, filter)
+}
+
+// ledgerReconciliation compares an amount the other tables record with the
+// one the ledger does, for every row of table where they differ
+type ledgerReconciliation struct {
+	what, table, currency, recorded, ledger, where string
+}
+
+// ledgerReconciliations tie the ledger to the orders, payments, refunds,
+// wallets and payouts it accounts for. Orders from before the ledger existed
+// are left out, their payments were never recorded in it.
+func ledgerReconciliations() []ledgerReconciliation {
+	orderEntries := func(kind string) string {
+		return fmt.Sprintf("journal_entries.kind = '%s' AND journal_entries.order_id = orders.id", kind)
+	}
+	sinceLedger := "orders.created_at >= (SELECT MIN(created_at) FROM journal_entries)"
+	payoutEntries := `journal_entries.id IN (SELECT entry_id FROM payout_entries WHERE payout_id = payouts.id)
+		AND ledger_accounts.owner_id = payouts.vendor_id AND ledger_accounts.currency = payouts.currency`
+	return []ledgerReconciliation{
+		{"card payments captured for order", "orders", "orders.currency",
+			"COALESCE((SELECT SUM(captured_amount) FROM payment_intents WHERE payment_intents.order_id = orders.id), 0)",
+			ledgerSum(models.LedgerOwnerPlatform, models.AccountCash, orderEntries(models.EntryOrderPayment)), sinceLedger},
+		{"card payments refunded for order", "orders", "orders.currency",
+			"COALESCE((SELECT SUM(refunded_amount) FROM payment_intents WHERE payment_intents.order_id = orders.id), 0)",
+			"-" + ledgerSum(models.LedgerOwnerPlatform, models.AccountCash, orderEntries(models.EntryRefund)), sinceLedger},
+		{"cash collected for order", "orders", "orders.currency",
+			"COALESCE((SELECT SUM(amount) FROM cash_payments WHERE cash_payments.order_id = orders.id), 0)",
+			ledgerSum(models.LedgerOwnerVendor, models.AccountCash, orderEntries(models.EntryOrderPayment)), sinceLedger},
+		{"cash handed back for order", "orders", "orders.currency",
+			"COALESCE((SELECT SUM(cash_amount) FROM refunds WHERE refunds.order_id = orders.id), 0)",
+			"-" + ledgerSum(models.LedgerOwnerVendor, models.AccountCash, orderEntries(models.EntryRefund)), sinceLedger},
+		{"wallet payment of order", "orders", "orders.currency", "orders.wallet_paid",
+			ledgerSum(models.LedgerOwnerCustomer, models.AccountWallet, orderEntries(models.EntryOrderPayment)), sinceLedger},
+		{"wallet refunds of order", "orders", "orders.currency", "orders.wallet_refunded",
+			"-" + ledgerSum(models.LedgerOwnerCustomer, models.AccountWallet, orderEntries(models.EntryRefund)), sinceLedger},
+		{"refunded total of order", "orders", "orders.currency", "orders.refunded_total",
+			"COALESCE((SELECT SUM(amount) FROM refunds WHERE refunds.order_id = orders.id), 0)", "true"},
+		{"refund", "refunds", "(SELECT currency FROM orders WHERE orders.id = refunds.order_id)",
+			fmt.Sprintf("CASE WHEN refunds.status = '%s' THEN refunds.card_amount ELSE 0 END + refunds.cash_amount + refunds.wallet_amount", models.RefundRefunded),
+			fmt.Sprintf("-(%s + %s + %s)",
+				ledgerSum(models.LedgerOwnerPlatform, models.AccountCash, "journal_entries.reference_id = refunds.id"),
+				ledgerSum(models.LedgerOwnerVendor, models.AccountCash, "journal_entries.reference_id = refunds.id"),
+				ledgerSum(models.LedgerOwnerCustomer, models.AccountWallet, "journal_entries.reference_id = refunds.id")),
+			"refunds.created_at >= (SELECT MIN(created_at) FROM journal_entries)"},
+		{"balance of wallet", "wallets", "wallets.currency", "wallets.balance",
+			"-" + ledgerSum(models.LedgerOwnerCustomer, models.AccountWallet,
+				"ledger_accounts.owner_id = wallets.customer_id AND ledger_accounts.currency = wallets.currency"), "true"},
+		{"transactions of wallet", "wallets", "wallets.currency", "wallets.balance",
+			"COALESCE((SELECT SUM(amount) FROM wallet_transactions WHERE wallet_transactions.wallet_id = wallets.id), 0)", "true"},
+		{"net payout of statement", "payouts", "payouts.currency", "payouts.net_payout",
+			"-" + ledgerSum(models.LedgerOwnerVendor, models.AccountPayable, payoutEntries), "true"},
+		{"cash collected of statement", "payouts", "payouts.currency", "payouts.cash_collected",
+			ledgerSum(models.LedgerOwnerVendor, models.AccountCash, payoutEntries), "true"},
+		{"payout of statement", "payouts", "payouts.currency",
+			fmt.Sprintf("CASE WHEN payouts.status = '%s' THEN payouts.net_payout ELSE 0 END", models.PayoutPaid),
+			ledgerSum(models.LedgerOwnerVendor, models.AccountPayable,
+				fmt.Sprintf("journal_entries.kind = '%s' AND journal_entries.reference_id = payouts.id", models.EntryPayout)), "true"},
+	}
+}
+
+// CheckLedger verifies the invariants of the ledger: every entry has
+// postings that add up to zero in each currency, and so do all the accounts
+// together. The triggers that keep it append-only must be in place, and the
+// orders, payments, refunds, wallets and payouts must match what the ledger
+// recorded for them.
+func CheckLedger() (models.LedgerCheckResponse, error) {
+	check := models.LedgerCheckResponse{Problems: []string{}}
+	if err := db.Get(&check.Entries, "SELECT COUNT(*) FROM journal_entries"); err != nil {
+		return check, err
+	}
+	if err := db.Get(&check.Postings, "SELECT COUNT(*) FROM ledger_postings"); err != nil {
+		return check, err
+	}
+
+	var unbalanced []struct {
+		EntryID uuid.UUID    `db:"entry_id"`
+		Sum     models.Money `db:"sum"`
+	}
+	if err := db.Select(&unbalanced, `
+		SELECT ledger_postings.entry_id, SUM(ledger_postings.amount)::text || ' ' || ledger_accounts.currency AS sum
+		FROM ledger_postings
+		JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+		GROUP BY ledger_postings.entry_id, ledger_accounts.currency
+		HAVING SUM(ledger_postings.amount) <> 0
+		ORDER BY ledger_postings.entry_id`); err != nil {
+		return check, err
+	}
+	for _, entry := range unbalanced {
+		check.Problems = append(check.Problems, fmt.Sprintf("entry %s is off by %s", entry.EntryID, entry.Sum))
+	}
+
+	var empty []uuid.UUID
+	if err := db.Select(&empty, `
+		SELECT id FROM journal_entries
+		WHERE NOT EXISTS (SELECT 1 FROM ledger_postings WHERE ledger_postings.entry_id = journal_entries.id)
+		ORDER BY id`); err != nil {
+		return check, err
+	}
+	for _, id := range empty {
+		check.Problems = append(check.Problems, fmt.Sprintf("entry %s has no postings", id))
+	}
+
+	var totals []models.Money
+	if err := db.Select(&totals, `
+		SELECT SUM(ledger_postings.amount)::text || ' ' || ledger_accounts.currency
+		FROM ledger_postings
+		JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+		GROUP BY ledger_accounts.currency
+		HAVING SUM(ledger_postings.amount) <> 0
+		ORDER BY ledger_accounts.currency`); err != nil {
+		return check, err
+	}
+	for _, total := range totals {
+		check.Problems = append(check.Problems, fmt.Sprintf("the %s accounts are off by %s", total.Currency, total))
+	}
+
+	for _, trigger := range ledgerTriggers {
+		var enabled bool
+		if err := db.Get(&enabled, "SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgrelid = $1::regclass AND tgname = $2 AND tgenabled <> 'D')",
+			trigger.table, trigger.name); err != nil {
+			return check, err
+		}
+		if !enabled {
+			check.Problems = append(check.Problems, fmt.Sprintf("trigger %s on %s is missing or disabled", trigger.name, trigger.table))
+		}
+	}
+
+	for _, reconciliation := range ledgerReconciliations() {
+		var mismatches []struct {
+			ID       uuid.UUID    `db:"id"`
+			Recorded models.Money `db:"recorded"`
+			Ledger   models.Money `db:"ledger"`
+		}
+		recorded, ledger := "("+reconciliation.recorded+")", "("+reconciliation.ledger+")"
+		query := fmt.Sprintf("SELECT %s.id, %s, %s FROM %s WHERE %s AND %s <> %s ORDER BY %s.id",
+			reconciliation.table,
+			moneyColumn(recorded, reconciliation.currency, "recorded"), moneyColumn(ledger, reconciliation.currency, "ledger"),
+			reconciliation.table, reconciliation.where, recorded, ledger, reconciliation.table)
+		if err := db.Select(&mismatches, query); err != nil {
+			return check, err
+		}
+		for _, mismatch := range mismatches {
+			check.Problems = append(check.Problems, fmt.Sprintf("%s %s is %s, the ledger has %s %s",
+				reconciliation.what, mismatch.ID, mismatch.Recorded, mismatch.Ledger, mismatch.Ledger.Currency))
+		}
+	}
+
+	return check, nil
+}
+
+// GetLedgerCheck runs the ledger invariant check, problems are listed in the response
+func GetLedgerCheck(w http.ResponseWriter, r *http.Request) {
+	check, err := CheckLedger()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check ledger")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, check)
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckLedgerReconcilesWithTheOtherTables(t *testing.T) {
+	f := useFakeDB(t)
+	orderID := uuid.New()
+	f.expect("SELECT COUNT(*) FROM journal_entries").returns([]string{"count"}, []driver.Value{int64(4)})
+	f.expect("SELECT COUNT(*) FROM ledger_postings").returns([]string{"count"}, []driver.Value{int64(12)})
+	f.expect("HAVING SUM(ledger_postings.amount) <> 0").returns([]string{"entry_id", "sum"})
+	f.expect("NOT EXISTS").returns([]string{"id"})
+	f.expect("GROUP BY ledger_accounts.currency").returns([]string{"sum"})
+	for _, trigger := range ledgerTriggers {
+		// Someone disabled the trigger that refuses truncating the postings
+		enabled := trigger.name != "ledger_postings_no_truncate"
+		f.expect("FROM pg_trigger").returns([]string{"exists"}, []driver.Value{enabled})
+	}
+	for _, reconciliation := range ledgerReconciliations() {
+		e := f.expect("FROM " + reconciliation.table + " WHERE").returns([]string{"id", "recorded", "ledger"})
+		if reconciliation.what == "card payments captured for order" {
+			e.returns([]string{"id", "recorded", "ledger"}, []driver.Value{orderID.String(), "12.50 USD", "0.000 USD"})
+		}
+	}
+
+	check, err := CheckLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Entries != 4 || check.Postings != 12 {
+		t.Errorf("checked %d entries and %d postings, want 4 and 12", check.Entries, check.Postings)
+	}
+	want := []string{
+		"trigger ledger_postings_no_truncate on ledger_postings is missing or disabled",
+		"card payments captured for order " + orderID.String() + " is 12.50, the ledger has 0.00 USD",
+	}
+	if strings.Join(check.Problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems = %q, want %q", check.Problems, want)
+	}
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var itemColumns = []string{
+	"id", "name", "description", "COALESCE(img, '') AS img", moneyColumn("price", itemCurrency, "price"),
+	"tax_category", "vendor_id", "created_at", "updated_at",
+}
+
+// saveItemImage stores the uploaded "img" file, if any, and returns its URI
+func saveItemImage(r *http.Request) (string, error) {
+	file, fileHeader, err := r.FormFile("img")
+	if err != nil {
+		return "", nil
+	}
+	defer file.Close()
+
+	imgPath, err := utils.SaveImageFile(file, "items", fileHeader.Filename)
+	if err != nil {
+		return "", err
+	}
+	// Convert backslashes to forward slashes for URI compatibility
+	return fmt.Sprintf("http://localhost:8000/%s", strings.ReplaceAll(imgPath, "\\", "/")), nil
+}
+
+// vendorItem loads one of the vendor's menu items that was not deleted
+func vendorItem(q sqlx.Queryer, vendorID uuid.UUID, id string) (models.Item, error) {
+	var item models.Item
+	itemID, err := uuid.Parse(id)
+	if err != nil {
+		return item, sql.ErrNoRows
+	}
+	query, args, err := QB.Select(itemColumns...).
+		From("items").
+		Where(squirrel.Eq{"id": itemID, "vendor_id": vendorID, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return item, err
+	}
+	err = sqlx.Get(q, &item, query, args...)
+	return item, err
+}
+
+// GetVendorItems lists the menu of the vendor the user works for
+func GetVendorItems(w http.ResponseWriter, r *http.Request) {
+	items := []models.Item{}
+	query, args, err := QB.Select(itemColumns...).
+		From("items").
+		Where(squirrel.Eq{"vendor_id": currentVendorID(r), "deleted_at": nil}).
+		OrderBy("name").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&items, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, items)
+}
+
+func CreateItem(w http.ResponseWriter, r *http.Request) {
+	var req models.ItemRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	// Items are priced in the vendor's currency
+	currency, err := vendorCurrency(db, currentVendorID(r))
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor currency")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	price, message := amountIn(req.Price, currency)
+	if message != "" {
+		utils.HandleValidationError(w, utils.FieldErrors{"price": message})
+		return
+	}
+
+	imgURI, err := saveItemImage(r)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if req.TaxCategory == "" {
+		req.TaxCategory = models.TaxCategoryFood
+	}
+
+	item := models.Item{
+		ID:          uuid.New(),
+		Name:        req.Name,
+		Description: req.Description,
+		Img:         imgURI,
+		Price:       price,
+		TaxCategory: req.TaxCategory,
+		VendorID:    currentVendorID(r),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	query, args, err := QB.Insert("items").
+		Columns("id", "name", "description", "img", "price", "tax_category", "vendor_id", "created_at", "updated_at").
+		Values(item.ID, item.Name, item.Description, item.Img, item.Price, item.TaxCategory, item.VendorID, item.CreatedAt, item.UpdatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create item")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, item)
+}
+
+func UpdateItem(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateItemRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	item, err := vendorItem(db, currentVendorID(r), r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+	if req.Price != nil {
+		price, message := amountIn(*req.Price, item.Price.Currency)
+		if message != "" {
+			utils.HandleValidationError(w, utils.FieldErrors{"price": message})
+			return
+		}
+		req.Price = &price
+	}
+
+	imgURI, err := saveItemImage(r)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if imgURI != "" {
+		// Delete the old image from the uploads directory (if present)
+		if item.Img != "" {
+			oldImagePath := strings.ReplaceAll(item.Img, "http://localhost:8000/", "") // Strip base URL
+			if err := os.Remove(oldImagePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Println(utils.ErrorWithTrace(err, err.Error()))
+			}
+		}
+		item.Img = imgURI
+	}
+	if req.Name != "" {
+		item.Name = req.Name
+	}
+	if req.Description != nil {
+		item.Description = *req.Description
+	}
+	if req.Price != nil {
+		item.Price = *req.Price
+	}
+	if req.TaxCategory != "" {
+		item.TaxCategory = req.TaxCategory
+	}
+	item.UpdatedAt = time.Now()
+
+	query, args, err := QB.Update("items").
+		Set("name", item.Name).
+		Set("description", item.Description).
+		Set("img", item.Img).
+		Set("price", item.Price).
+		Set("tax_category", item.TaxCategory).
+		Set("updated_at", item.UpdatedAt).
+		Where(squirrel.Eq{"id": item.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update item")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, item)
+}
+
+// DeleteItem archives a menu item: it disappears from the menu and from open
+// carts, past orders keep their lines
+func DeleteItem(w http.ResponseWriter, r *http.Request) {
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	item, err := vendorItem(tx, currentVendorID(r), r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Item not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get item")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Update("items").Set("deleted_at", time.Now()).Where(squirrel.Eq{"id": item.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete item")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	var cartIDs []uuid.UUID
+	query, args, err = QB.Delete("cart_item").
+		Where(squirrel.Eq{"item_id": item.ID}).
+		Where("cart_id IN (SELECT id FROM carts WHERE checked_out_at IS NULL)").
+		Suffix("RETURNING cart_id").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Select(&cartIDs, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove item from carts")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	for _, cartID := range cartIDs {
+		if err := refreshCartTotals(tx, cartID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart totals")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete item")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Item deleted successfully",
+	})
+}
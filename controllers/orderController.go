@@ -0,0 +1,957 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// An empty cart has no currency, its zero total is shown in the default one
+var cartColumns = []string{
+	"id", "user_id", moneyColumn("total_price", fmt.Sprintf("COALESCE(currency, '%s')", models.DefaultCurrency), "total_price"),
+	"currency", "quantity", "promotion_id", "created_at", "updated_at", "checked_out_at",
+}
+
+// activeCart returns the user's cart that was not checked out yet, creating it
+// when needed. With lock set the cart row is locked until the transaction ends.
+func activeCart(q sqlx.Ext, userID uuid.UUID, lock bool) (models.Cart, error) {
+	var cart models.Cart
+	selectCart := QB.Select(cartColumns...).From("carts").Where(squirrel.Eq{"user_id": userID, "checked_out_at": nil})
+	if lock {
+		selectCart = selectCart.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectCart.ToSql()
+	if err != nil {
+		return cart, err
+	}
+
+	err = sqlx.Get(q, &cart, query, args...)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return cart, err
+	}
+
+	// A concurrent request may create the cart first, the partial unique index
+	// on user_id makes this insert a no-op in that case
+	insert, insertArgs, err := QB.Insert("carts").
+		Columns("id", "user_id", "total_price", "quantity", "created_at", "updated_at").
+		Values(uuid.New(), userID, 0, 0, time.Now(), time.Now()).
+		Suffix("ON CONFLICT DO NOTHING").
+		ToSql()
+	if err != nil {
+		return cart, err
+	}
+	if _, err := q.Exec(insert, insertArgs...); err != nil {
+		return cart, err
+	}
+
+	err = sqlx.Get(q, &cart, query, args...)
+	return cart, err
+}
+
+// cartItems lists the items of a cart with their current price
+func cartItems(q sqlx.Ext, cartID uuid.UUID) ([]models.CartItemResponse, error) {
+	query, args, err := QB.Select(
+		"cart_item.item_id",
+		"items.name",
+		"COALESCE(items.img, '') AS img",
+		"items.vendor_id",
+		"items.tax_category",
+		moneyColumn("items.price", "vendors.currency", "price"),
+		"cart_item.quantity",
+		moneyColumn("items.price * cart_item.quantity", "vendors.currency", "line_total")).
+		From("cart_item").
+		Join("items ON items.id = cart_item.item_id").
+		Join("vendors ON vendors.vendor_id = items.vendor_id").
+		Where(squirrel.Eq{"cart_item.cart_id": cartID}).
+		OrderBy("items.name").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []models.CartItemResponse{}
+	if err := sqlx.Select(q, &items, query, args...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// refreshCartTotals recomputes the cached quantity, total price and currency of a cart
+func refreshCartTotals(q sqlx.Ext, cartID uuid.UUID) error {
+	query, args, err := QB.Update("carts").
+		Set("total_price", squirrel.Expr("COALESCE((SELECT SUM(items.price * cart_item.quantity) FROM cart_item JOIN items ON items.id = cart_item.item_id WHERE cart_item.cart_id = carts.id), 0)")).
+		Set("quantity", squirrel.Expr("COALESCE((SELECT SUM(cart_item.quantity) FROM cart_item WHERE cart_item.cart_id = carts.id), 0)")).
+		Set("currency", squirrel.Expr("(SELECT "+itemCurrency+" FROM cart_item JOIN items ON items.id = cart_item.item_id WHERE cart_item.cart_id = carts.id LIMIT 1)")).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": cartID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// sendCart responds with the cart and its items
+func sendCart(w http.ResponseWriter, userID uuid.UUID) {
+	cart, err := activeCart(db, userID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	items, err := cartItems(db, cart.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	coupon, err := cartCoupon(db, cart, items)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.CartResponse{
+		ID:         cart.ID,
+		Items:      items,
+		Quantity:   cart.Quantity,
+		TotalPrice: cart.TotalPrice,
+		Currency:   cart.Currency,
+		Coupon:     coupon,
+		UpdatedAt:  cart.UpdatedAt,
+	})
+}
+
+func GetCart(w http.ResponseWriter, r *http.Request) {
+	sendCart(w, currentSession(r).UserID)
+}
+
+func SetCartItem(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.CartItemRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	// Make sure the item exists
+	var item models.Item
+	query, args, err := QB.Select("id", "vendor_id", moneyColumn("price", itemCurrency, "price")).
+		From("items").
+		Where(squirrel.Eq{"id": req.ItemID, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&item, query, args...); err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	cart, err := activeCart(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if req.Quantity == 0 {
+		query, args, err = QB.Delete("cart_item").Where(squirrel.Eq{"cart_id": cart.ID, "item_id": item.ID}).ToSql()
+	} else {
+		// An order goes to a single vendor, so a cart only holds items of one vendor
+		var otherVendors int
+		query, args, err = QB.Select("COUNT(*)").
+			From("cart_item").
+			Join("items ON items.id = cart_item.item_id").
+			Where(squirrel.Eq{"cart_item.cart_id": cart.ID}).
+			Where(squirrel.NotEq{"items.vendor_id": item.VendorID}).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := tx.Get(&otherVendors, query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to check cart vendor")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if otherVendors > 0 {
+			utils.HandleError(w, http.StatusConflict, "Your cart holds items from another vendor, remove them first")
+			return
+		}
+		// Carts never mix currencies, even when the vendor changed its currency
+		if cart.Currency != nil && *cart.Currency != item.Price.Currency {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("Your cart holds items priced in %s and this item is priced in %s, remove them first", *cart.Currency, item.Price.Currency))
+			return
+		}
+
+		query, args, err = QB.Insert("cart_item").
+			Columns("cart_id", "item_id", "quantity").
+			Values(cart.ID, item.ID, req.Quantity).
+			Suffix("ON CONFLICT (cart_id, item_id) DO UPDATE SET quantity = EXCLUDED.quantity").
+			ToSql()
+	}
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := refreshCartTotals(tx, cart.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart totals")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	sendCart(w, session.UserID)
+}
+
+func RemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	itemID, err := uuid.Parse(r.PathValue("item_id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+
+	cart, err := activeCart(db, session.UserID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Delete("cart_item").Where(squirrel.Eq{"cart_id": cart.ID, "item_id": itemID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove item from cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := refreshCartTotals(db, cart.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart totals")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	sendCart(w, session.UserID)
+}
+
+func Checkout(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.CheckoutRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		utils.HandleValidationError(w, utils.FieldErrors{"location": "latitude and longitude must be sent together"})
+		return
+	}
+	if req.AddressID != nil && req.Latitude != nil {
+		utils.HandleValidationError(w, utils.FieldErrors{"location": "send either address_id or latitude and longitude"})
+		return
+	}
+	if req.PaymentType == "" {
+		req.PaymentType = models.PaymentTypeCard
+	}
+	if req.PaymentType != models.PaymentTypeCash && req.PaymentType != models.PaymentTypeWallet && req.PaymentMethod == "" {
+		utils.HandleValidationError(w, utils.FieldErrors{"payment_method": "is required to pay by card"})
+		return
+	}
+	if req.PaymentType == models.PaymentTypeWallet && !req.WalletAmount.IsZero() {
+		utils.HandleValidationError(w, utils.FieldErrors{"wallet_amount": "is not sent with wallet payments, they take the whole total"})
+		return
+	}
+	if req.PaymentType == models.PaymentTypeSplit && req.CardAmount.IsZero() {
+		utils.HandleValidationError(w, utils.FieldErrors{"card_amount": "is required for split payments"})
+		return
+	}
+	if req.PaymentType != models.PaymentTypeSplit && !req.CardAmount.IsZero() {
+		utils.HandleValidationError(w, utils.FieldErrors{"card_amount": "is only sent with split payments"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the cart so it cannot change while it is turned into an order
+	cart, err := activeCart(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	items, err := cartItems(tx, cart.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if len(items) == 0 {
+		utils.HandleError(w, http.StatusBadRequest, "Your cart is empty")
+		return
+	}
+
+	if open, err := vendorIsOpen(tx, items[0].VendorID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check opening hours")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !open {
+		utils.HandleError(w, http.StatusConflict, "The vendor is closed right now")
+		return
+	}
+
+	// The vendor changed its currency since the cart was last updated, the
+	// customer sees the new prices before ordering
+	if cart.Currency != nil && *cart.Currency != items[0].Price.Currency {
+		if err := refreshCartTotals(tx, cart.ID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart totals")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update cart")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		utils.HandleError(w, http.StatusConflict, fmt.Sprintf("The vendor now prices its menu in %s, review your cart before checking out", items[0].Price.Currency))
+		return
+	}
+
+	taxes, err := loadVendorTaxes(tx, items[0].VendorID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	commission, err := vendorCommission(tx, items[0].VendorID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load commission")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	percent := commissionPercent
+	if commission.Percent != nil {
+		percent = *commission.Percent
+	}
+
+	zero := models.NewMoney(0, items[0].Price.Currency)
+	order := models.Order{
+		ID:                uuid.New(),
+		CartID:            cart.ID,
+		CustomerID:        session.UserID,
+		VendorID:          items[0].VendorID,
+		Currency:          items[0].Price.Currency,
+		OrderTotalCost:    zero,
+		Status:            models.OrderStatusPlaced,
+		DeliveryFee:       zero,
+		PricesIncludeTax:  taxes.inclusive,
+		DeliveryTaxRate:   "0",
+		DeliveryTax:       zero,
+		TaxTotal:          zero,
+		DiscountTotal:     zero,
+		DeliveryDiscount:  zero,
+		PaymentType:       req.PaymentType,
+		CashDue:           zero,
+		CommissionPercent: &percent,
+		CommissionFee:     commission.FixedFee,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+
+	// The coupon of the cart is checked again, its row stays locked so that
+	// concurrent orders can't go over its usage limits
+	discount := newCouponDiscount(items)
+	if cart.PromotionID != nil {
+		promotion, err := loadPromotion(tx, squirrel.Eq{"id": *cart.PromotionID}, true)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get coupon")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		var message string
+		discount, message, err = evaluatePromotion(tx, promotion, session.UserID, items)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to check coupon")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if message != "" {
+			utils.HandleError(w, http.StatusConflict, message+", remove the coupon to check out")
+			return
+		}
+		order.PromotionID, order.CouponCode = &promotion.ID, &promotion.Code
+	}
+
+	// Every line is discounted, taxed and rounded on its own, the order sums the lines
+	orderItems := make([]models.OrderItemResponse, 0, len(items))
+	for i, item := range items {
+		lineTotal := item.LineTotal.Sub(discount.lines[i])
+		tax, rate := taxes.tax(item.TaxCategory, lineTotal)
+		order.OrderTotalCost = order.OrderTotalCost.Add(lineTotal)
+		order.DiscountTotal = order.DiscountTotal.Add(discount.lines[i])
+		order.TaxTotal = order.TaxTotal.Add(tax)
+		orderItems = append(orderItems, models.OrderItemResponse{
+			ItemID:      item.ItemID,
+			Name:        item.Name,
+			Quantity:    item.Quantity,
+			Price:       item.Price,
+			Discount:    discount.lines[i],
+			TaxCategory: item.TaxCategory,
+			TaxRate:     rate,
+			TaxAmount:   tax,
+		})
+	}
+
+	// A saved address (the default one unless another is picked or a point is
+	// sent) is copied on the order so later edits don't change it
+	latitude, longitude := req.Latitude, req.Longitude
+	var address models.CustomerAddress
+	if req.AddressID != nil {
+		address, err = customerAddress(tx, session.UserID, req.AddressID.String())
+	} else if req.Latitude == nil {
+		address, err = defaultAddress(tx, session.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleValidationError(w, utils.FieldErrors{"address_id": "is not one of your addresses"})
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load address")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if address.ID != uuid.Nil {
+		order.AddressID = &address.ID
+		order.DeliveryAddress = address.Address
+		order.DeliveryInstructions = address.Instructions
+		latitude, longitude = address.Latitude, address.Longitude
+	}
+
+	// Vendors with delivery zones only deliver inside them, for the fee of the zone
+	zones, err := deliveryZones(tx, order.VendorID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load delivery zones")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if len(zones) > 0 {
+		if latitude == nil {
+			utils.HandleValidationError(w, utils.FieldErrors{"location": "the delivery address needs a latitude and longitude"})
+			return
+		}
+		zone, covered, minOrder := matchDeliveryZone(zones, *latitude, *longitude, order.OrderTotalCost)
+		if !covered {
+			utils.HandleError(w, http.StatusConflict, "The vendor does not deliver to this address")
+			return
+		}
+		if zone == nil {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("The minimum order for delivery to this address is %s", minOrder))
+			return
+		}
+		order.DeliveryZoneID = &zone.ID
+		order.DeliveryFee = zone.Fee
+		if discount.freeDelivery {
+			order.DeliveryDiscount = zone.Fee
+			order.DiscountTotal = order.DiscountTotal.Add(zone.Fee)
+		}
+		charged := zone.Fee.Sub(order.DeliveryDiscount)
+		order.OrderTotalCost = order.OrderTotalCost.Add(charged)
+		order.DeliveryTax, order.DeliveryTaxRate = taxes.tax(models.TaxCategoryDelivery, charged)
+		order.TaxTotal = order.TaxTotal.Add(order.DeliveryTax)
+	}
+	order.DeliveryLatitude, order.DeliveryLongitude = latitude, longitude
+
+	// Tax-inclusive prices already hold the tax, otherwise it is added on top
+	if !order.PricesIncludeTax {
+		order.OrderTotalCost = order.OrderTotalCost.Add(order.TaxTotal)
+	}
+
+	// Wallet orders take the whole total from the customer's wallet, the other
+	// ones can take part of it and pay the rest as usual
+	walletAmount := zero
+	switch {
+	case order.PaymentType == models.PaymentTypeWallet:
+		walletAmount = order.OrderTotalCost
+	case !req.WalletAmount.IsZero():
+		var message string
+		if walletAmount, message = amountIn(req.WalletAmount, order.Currency); message != "" {
+			utils.HandleValidationError(w, utils.FieldErrors{"wallet_amount": message})
+			return
+		}
+		if walletAmount.Cmp(order.OrderTotalCost) >= 0 {
+			utils.HandleValidationError(w, utils.FieldErrors{"wallet_amount": fmt.Sprintf("must be less than the order total of %s, pay it all with the wallet instead", order.OrderTotalCost)})
+			return
+		}
+	}
+	due := order.OrderTotalCost.Sub(walletAmount)
+
+	// Cash orders are paid on delivery, split ones charge part of what is due
+	// to the card and collect the rest in cash
+	cardAmount := due
+	switch order.PaymentType {
+	case models.PaymentTypeCash, models.PaymentTypeWallet:
+		cardAmount = zero
+	case models.PaymentTypeSplit:
+		var message string
+		if cardAmount, message = amountIn(req.CardAmount, order.Currency); message != "" {
+			utils.HandleValidationError(w, utils.FieldErrors{"card_amount": message})
+			return
+		}
+		if cardAmount.Cmp(due) >= 0 {
+			utils.HandleValidationError(w, utils.FieldErrors{"card_amount": fmt.Sprintf("must be less than the %s left to pay", due)})
+			return
+		}
+	}
+	order.CashDue = due.Sub(cardAmount)
+	order.WalletPaid = walletAmount
+	order.WalletRefunded = zero
+	if !cardAmount.IsZero() {
+		order.Status = models.OrderStatusPendingPayment
+	}
+
+	query, args, err := QB.Insert("orders").
+		Columns("id", "order_total_cost", "currency", "cart_id", "customer_id", "vendor_id", "status",
+			"delivery_fee", "delivery_zone_id", "delivery_latitude", "delivery_longitude",
+			"prices_include_tax", "delivery_tax_rate", "delivery_tax", "tax_total",
+			"promotion_id", "coupon_code", "discount_total", "delivery_discount",
+			"address_id", "delivery_address", "delivery_instructions", "payment_type", "cash_due", "wallet_paid",
+			"commission_percent", "commission_fee", "created_at", "updated_at").
+		Values(order.ID, order.OrderTotalCost, order.Currency, order.CartID, order.CustomerID, order.VendorID, order.Status,
+			order.DeliveryFee, order.DeliveryZoneID, order.DeliveryLatitude, order.DeliveryLongitude,
+			order.PricesIncludeTax, order.DeliveryTaxRate, order.DeliveryTax, order.TaxTotal,
+			order.PromotionID, order.CouponCode, order.DiscountTotal, order.DeliveryDiscount,
+			order.AddressID, order.DeliveryAddress, order.DeliveryInstructions, order.PaymentType, order.CashDue, order.WalletPaid,
+			order.CommissionPercent, order.CommissionFee, order.CreatedAt, order.UpdatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Snapshot the price and tax of every item so later menu changes don't alter the order
+	insertItems := QB.Insert("order_item").Columns("order_id", "item_id", "quantity", "price", "discount", "tax_category", "tax_rate", "tax_amount")
+	for _, item := range orderItems {
+		insertItems = insertItems.Values(order.ID, item.ItemID, item.Quantity, item.Price, item.Discount, item.TaxCategory, item.TaxRate, item.TaxAmount)
+	}
+	query, args, err = insertItems.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store order items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Update("carts").Set("checked_out_at", time.Now()).Where(squirrel.Eq{"id": cart.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to close cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The wallet row stays locked until the order is stored so parallel
+	// checkouts can't spend the same balance
+	if !walletAmount.IsZero() {
+		wallet, err := lockWallet(tx, session.UserID, order.Currency)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallet")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		transaction, err := debitWallet(tx, &wallet, order, walletAmount)
+		if errors.Is(err, errInsufficientBalance) {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("Your wallet balance of %s does not cover %s", wallet.Balance, walletAmount))
+			return
+		}
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to pay from wallet")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := postOrderPayment(tx, order, transaction.ID, walletAmount, models.PaymentTypeWallet); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to record payment in the ledger")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	// The card payment is stored pending and only authorized once the order
+	// is committed, so the provider is never waited for with the cart, the
+	// coupon and the wallet locked
+	intents := []models.PaymentIntent{}
+	if !cardAmount.IsZero() {
+		intent := models.PaymentIntent{
+			ID:             uuid.New(),
+			OrderID:        order.ID,
+			Provider:       paymentProvider.Name(),
+			PaymentMethod:  req.PaymentMethod,
+			Amount:         cardAmount,
+			CapturedAmount: zero,
+			RefundedAmount: zero,
+			Status:         models.PaymentPending,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}
+		if err := insertPaymentIntent(tx, intent); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to store payment")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		intents = append(intents, intent)
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to place order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The order is only placed once the provider authorized the card amount
+	if len(intents) > 0 {
+		var message string
+		if order, message, err = authorizeCheckout(order, intents[0]); err != nil {
+			if errors.Is(err, errPaymentProvider) {
+				utils.HandleError(w, http.StatusBadGateway, "The payment provider is unavailable, try again later")
+			} else {
+				utils.HandleError(w, http.StatusInternalServerError, "Failed to place order")
+			}
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if message != "" {
+			utils.HandleError(w, http.StatusPaymentRequired, message)
+			return
+		}
+		if intents, err = orderPayments(db, order.ID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewOrderResponse(order, orderItems, intents))
+}
+
+var orderColumns = []string{
+	"id", moneyColumn("order_total_cost", "currency", "order_total_cost"), "currency",
+	"cart_id", "customer_id", "vendor_id", "status", moneyColumn("delivery_fee", "currency", "delivery_fee"),
+	"delivery_zone_id", "delivery_latitude", "delivery_longitude", "address_id", "delivery_address", "delivery_instructions",
+	"prices_include_tax", "trim_scale(delivery_tax_rate)::text AS delivery_tax_rate",
+	moneyColumn("delivery_tax", "currency", "delivery_tax"), moneyColumn("tax_total", "currency", "tax_total"),
+	"promotion_id", "coupon_code", moneyColumn("discount_total", "currency", "discount_total"),
+	moneyColumn("delivery_discount", "currency", "delivery_discount"), "payment_type",
+	moneyColumn("cash_due", "currency", "cash_due"), moneyColumn("refunded_total", "currency", "refunded_total"),
+	moneyColumn("wallet_paid", "currency", "wallet_paid"), moneyColumn("wallet_refunded", "currency", "wallet_refunded"),
+	"trim_scale(commission_percent)::text AS commission_percent", moneyColumn("commission_fee", "currency", "commission_fee"),
+	"created_at", "updated_at",
+}
+
+// orderItems lists the lines of an order with the price paid
+func orderItems(q sqlx.Queryer, orderID uuid.UUID) ([]models.OrderItemResponse, error) {
+	query, args, err := QB.Select("order_item.item_id", "items.name", "order_item.quantity", moneyColumn("order_item.price", "orders.currency", "price"),
+		moneyColumn("order_item.discount", "orders.currency", "discount"), "order_item.tax_category", "trim_scale(order_item.tax_rate)::text AS tax_rate", moneyColumn("order_item.tax_amount", "orders.currency", "tax_amount"),
+		"order_item.refunded_quantity").
+		From("order_item").
+		Join("items ON items.id = order_item.item_id").
+		Join("orders ON orders.id = order_item.order_id").
+		Where(squirrel.Eq{"order_item.order_id": orderID}).
+		OrderBy("items.name").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []models.OrderItemResponse{}
+	if err := sqlx.Select(q, &items, query, args...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// vendorOrder loads one of the vendor's placed orders, with lock set the row
+// stays locked until the transaction ends
+func vendorOrder(q sqlx.Queryer, vendorID uuid.UUID, id string, lock bool) (models.Order, error) {
+	var order models.Order
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		return order, sql.ErrNoRows
+	}
+	selectOrder := QB.Select(orderColumns...).
+		From("orders").
+		Where(squirrel.Eq{"id": orderID, "vendor_id": vendorID}).
+		Where(squirrel.NotEq{"status": models.UnplacedOrderStatuses})
+	if lock {
+		selectOrder = selectOrder.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectOrder.ToSql()
+	if err != nil {
+		return order, err
+	}
+	err = sqlx.Get(q, &order, query, args...)
+	return order, err
+}
+
+// GetVendorOrders lists the placed orders of the vendor the user works for,
+// newest first, optionally filtered with ?status=
+func GetVendorOrders(w http.ResponseWriter, r *http.Request) {
+	selectOrders := QB.Select(orderColumns...).
+		From("orders").
+		Where(squirrel.Eq{"vendor_id": currentVendorID(r)}).
+		Where(squirrel.NotEq{"status": models.UnplacedOrderStatuses}).
+		OrderBy("created_at DESC")
+	if status := r.URL.Query().Get("status"); status != "" {
+		selectOrders = selectOrders.Where(squirrel.Eq{"status": status})
+	}
+	query, args, err := selectOrders.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	var orders []models.Order
+	if err := db.Select(&orders, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get orders")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	responses := make([]models.OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		items, err := orderItems(db, order.ID)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get order items")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		intents, err := orderPayments(db, order.ID)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		responses = append(responses, models.NewOrderResponse(order, items, intents))
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, responses)
+}
+
+func GetVendorOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := vendorOrder(db, currentVendorID(r), r.PathValue("id"), false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	items, err := orderItems(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	intents, err := orderPayments(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewOrderResponse(order, items, intents))
+}
+
+// UpdateOrderStatus moves an order along models.OrderStatusTransitions
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var req models.OrderStatusRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	order, err := vendorOrder(tx, currentVendorID(r), r.PathValue("id"), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	allowed := false
+	for _, next := range models.OrderStatusTransitions[order.Status] {
+		allowed = allowed || next == req.Status
+	}
+	if !allowed {
+		utils.HandleError(w, http.StatusConflict, "An order cannot go from "+order.Status+" to "+req.Status)
+		return
+	}
+
+	// The cash of an order is collected before it is handed over
+	if req.Status == models.OrderStatusCompleted && !order.CashDue.IsZero() {
+		balance, err := orderBalance(tx, order.ID)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balance")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if outstanding := balance.CashOutstanding(); !outstanding.IsZero() && !outstanding.IsNegative() {
+			utils.HandleError(w, http.StatusConflict, fmt.Sprintf("Collect the %s %s still due in cash before completing the order", outstanding, order.Currency))
+			return
+		}
+	}
+
+	order.Status = req.Status
+	order.UpdatedAt = time.Now()
+	if err := updateOrderStatus(tx, order); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Accepting the order charges the customer, cancelling it releases the
+	// money. The provider is asked once the new status is committed.
+	operations, message, err := recordPaymentOperations(tx, order)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if message != "" {
+		utils.HandleError(w, http.StatusConflict, message)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// A provider that can't be reached is asked again by settle-payments
+	status := http.StatusOK
+	if message, err := runPaymentOperations(operations); errors.Is(err, errPaymentProvider) {
+		status = http.StatusAccepted
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if message != "" {
+		utils.HandleError(w, http.StatusConflict, message)
+		return
+	}
+
+	order, err = scopedOrder(db, nil, order.ID.String(), false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	items, err := orderItems(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	intents, err := orderPayments(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, status, models.NewOrderResponse(order, items, intents))
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"resturant/models"
+	"resturant/payments"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	checkoutCartColumns       = []string{"id", "user_id", "total_price", "currency", "quantity", "promotion_id", "created_at", "updated_at", "checked_out_at"}
+	checkoutItemColumns       = []string{"item_id", "name", "img", "vendor_id", "tax_category", "price", "quantity", "line_total"}
+	checkoutOrderColumns      = []string{"id", "order_total_cost", "currency", "cart_id", "customer_id", "vendor_id", "status", "payment_type", "cash_due", "wallet_paid", "wallet_refunded", "created_at", "updated_at"}
+	checkoutAddressColumns    = []string{"id", "user_id", "label", "address", "latitude", "longitude", "instructions", "is_default", "created_at", "updated_at"}
+	checkoutZoneColumns       = []string{"id", "vendor_id", "name", "kind", "center_latitude", "center_longitude", "radius_km", "polygon", "fee", "min_order", "created_at", "updated_at"}
+	checkoutCommissionColumns = []string{"vendor_id", "percent", "fixed_fee"}
+)
+
+// expectCardCheckout scripts a checkout of one item paid by card up to the
+// commit of the pending order
+func expectCardCheckout(f *fakeDB, customerID, cartID, vendorID uuid.UUID) {
+	f.expect("FROM carts").returns(checkoutCartColumns, []driver.Value{
+		cartID.String(), customerID.String(), "12.50 USD", "USD", int64(1), nil, time.Now(), time.Now(), nil,
+	})
+	f.expect("FROM cart_item").returns(checkoutItemColumns, []driver.Value{
+		uuid.NewString(), "Pizza", "", vendorID.String(), "food", "12.50 USD", int64(1), "12.50 USD",
+	})
+	f.expect("FROM vendors").returns([]string{"open"}, []driver.Value{true})
+	f.expect("SELECT prices_include_tax").returns([]string{"prices_include_tax"}, []driver.Value{true})
+	f.expect("FROM tax_rates").returns([]string{"category", "rate"})
+	f.expect("commission_percent").returns(checkoutCommissionColumns, []driver.Value{vendorID.String(), nil, "0.00 USD"})
+	f.expect("FROM customer_addresses").returns(checkoutAddressColumns)
+	f.expect("FROM delivery_zones").returns(checkoutZoneColumns)
+	f.expect("INSERT INTO orders")
+	f.expect("INSERT INTO order_item")
+	f.expect("UPDATE carts")
+	f.expect("INSERT INTO payment_intents")
+}
+
+func checkoutRequest(customerID uuid.UUID, paymentMethod string) *http.Request {
+	r := jsonRequest(http.MethodPost, "/customer/checkout", `{"payment_type":"card","payment_method":"`+paymentMethod+`"}`)
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey, models.Session{UserID: customerID}))
+}
+
+func pendingOrderRow(orderID, cartID, customerID, vendorID uuid.UUID) []driver.Value {
+	return []driver.Value{
+		orderID.String(), "12.50 USD", "USD", cartID.String(), customerID.String(), vendorID.String(),
+		models.OrderStatusPendingPayment, models.PaymentTypeCard, "0.00 USD", "0.00 USD", "0.00 USD", time.Now(), time.Now(),
+	}
+}
+
+func TestCheckoutPlacesTheOrderOnceTheCardIsAuthorized(t *testing.T) {
+	useFakeProvider(t)
+	f := useFakeDB(t)
+	customerID, cartID, vendorID, orderID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	expectCardCheckout(f, customerID, cartID, vendorID)
+	f.expect("FROM orders").returns(checkoutOrderColumns, pendingOrderRow(orderID, cartID, customerID, vendorID))
+	placed := f.expect("UPDATE orders SET status")
+	authorized := f.expect("UPDATE payment_intents")
+	f.expect("FROM payment_intents").returns(paymentIntentRowColumns, []driver.Value{
+		uuid.NewString(), orderID.String(), "fake", "fake_1", "", "12.50 USD", "0.00 USD", "0.00 USD",
+		models.PaymentAuthorized, time.Now(), time.Now(),
+	})
+
+	w := httptest.NewRecorder()
+	Checkout(w, checkoutRequest(customerID, "tok_visa"))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	// The provider is only asked once the pending order is committed
+	if f.commits != 2 {
+		t.Errorf("commits = %d, want 2", f.commits)
+	}
+	if !containsArg(placed.args, models.OrderStatusPlaced) {
+		t.Errorf("order not placed, args %v", placed.args)
+	}
+	if !containsArg(authorized.args, models.PaymentAuthorized) {
+		t.Errorf("payment not authorized, args %v", authorized.args)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["status"] != models.OrderStatusPlaced {
+		t.Errorf("order status = %v, want %s", body["status"], models.OrderStatusPlaced)
+	}
+}
+
+func TestCheckoutFailsTheOrderWhenTheCardIsDeclined(t *testing.T) {
+	tests := []struct {
+		method       string
+		status       int
+		intentFailed bool
+	}{
+		{payments.FakeMethodDeclined, http.StatusPaymentRequired, true},
+		{payments.FakeMethodInsufficientFunds, http.StatusPaymentRequired, true},
+		// The intent stays pending for settle-payments to void
+		{payments.FakeMethodUnavailable, http.StatusBadGateway, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			useFakeProvider(t)
+			f := useFakeDB(t)
+			customerID, cartID, vendorID, orderID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+			expectCardCheckout(f, customerID, cartID, vendorID)
+			f.expect("FROM orders").returns(checkoutOrderColumns, pendingOrderRow(orderID, cartID, customerID, vendorID))
+			failed := f.expect("UPDATE orders SET status")
+			f.expect("DELETE FROM carts")
+			reopened := f.expect("UPDATE carts SET checked_out_at = NULL")
+			var declined *expectation
+			if tt.intentFailed {
+				declined = f.expect("UPDATE payment_intents")
+			}
+
+			w := httptest.NewRecorder()
+			Checkout(w, checkoutRequest(customerID, tt.method))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if f.commits != 2 {
+				t.Errorf("commits = %d, want 2", f.commits)
+			}
+			if !containsArg(failed.args, models.OrderStatusPaymentFailed) {
+				t.Errorf("order not failed, args %v", failed.args)
+			}
+			if !containsArg(reopened.args, cartID) {
+				t.Errorf("cart %s not reopened, args %v", cartID, reopened.args)
+			}
+			if declined != nil && !containsArg(declined.args, models.PaymentFailed) {
+				t.Errorf("payment not failed, args %v", declined.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,1049 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/payments"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+var paymentProvider payments.PaymentProvider
+
+func SetPaymentProvider(p payments.PaymentProvider) {
+	paymentProvider = p
+}
+
+// errPaymentProvider wraps the errors of the provider, which mean it could not
+// be reached rather than that it refused
+var errPaymentProvider = errors.New("payment provider error")
+
+// paymentCurrency is the currency of the order of the payment_intents row
+const paymentCurrency = "(SELECT orders.currency FROM orders WHERE orders.id = payment_intents.order_id)"
+
+var paymentIntentColumns = []string{
+	"id", "order_id", "provider", "provider_payment_id", "COALESCE(payment_method, '') AS payment_method", moneyColumn("amount", paymentCurrency, "amount"),
+	moneyColumn("captured_amount", paymentCurrency, "captured_amount"), moneyColumn("refunded_amount", paymentCurrency, "refunded_amount"),
+	"status", "created_at", "updated_at",
+}
+
+// orderPayments lists the payment intents of an order, oldest first
+func orderPayments(q sqlx.Queryer, orderID uuid.UUID) ([]models.PaymentIntent, error) {
+	intents := []models.PaymentIntent{}
+	query, args, err := QB.Select(paymentIntentColumns...).
+		From("payment_intents").
+		Where(squirrel.Eq{"order_id": orderID}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	err = sqlx.Select(q, &intents, query, args...)
+	return intents, err
+}
+
+func insertPaymentIntent(q sqlx.Execer, intent models.PaymentIntent) error {
+	query, args, err := QB.Insert("payment_intents").
+		Columns("id", "order_id", "provider", "provider_payment_id", "payment_method", "amount", "captured_amount", "refunded_amount",
+			"status", "created_at", "updated_at").
+		Values(intent.ID, intent.OrderID, intent.Provider, intent.ProviderPaymentID, intent.PaymentMethod, intent.Amount, intent.CapturedAmount,
+			intent.RefundedAmount, intent.Status, intent.CreatedAt, intent.UpdatedAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// updatePaymentIntent saves the status and amounts of an intent. The card
+// token is dropped once the authorization is settled, it is not needed anymore.
+func updatePaymentIntent(q sqlx.Execer, intent models.PaymentIntent) error {
+	updateIntent := QB.Update("payment_intents").
+		Set("status", intent.Status).
+		Set("provider_payment_id", intent.ProviderPaymentID).
+		Set("captured_amount", intent.CapturedAmount).
+		Set("refunded_amount", intent.RefundedAmount).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": intent.ID})
+	if intent.Status != models.PaymentPending {
+		updateIntent = updateIntent.Set("payment_method", nil)
+	}
+	query, args, err := updateIntent.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// lockPaymentIntent loads an intent and locks its row until the transaction ends
+func lockPaymentIntent(tx *sqlx.Tx, id uuid.UUID) (models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	query, args, err := QB.Select(paymentIntentColumns...).
+		From("payment_intents").
+		Where(squirrel.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return intent, err
+	}
+	err = tx.Get(&intent, query, args...)
+	return intent, err
+}
+
+// paymentRetryDelay is how long settle-payments leaves a pending checkout or
+// operation to the request that started it
+const paymentRetryDelay = 5 * time.Minute
+
+// pendingOperation is a payment operation with the order and the payment at
+// the provider it is made on
+type pendingOperation struct {
+	models.PaymentOperation
+	OrderID           uuid.UUID `db:"order_id"`
+	ProviderPaymentID string    `db:"provider_payment_id"`
+}
+
+var paymentOperationColumns = []string{
+	"payment_operations.id", "payment_operations.payment_intent_id", "payment_operations.refund_id", "payment_operations.kind",
+	moneyColumn("payment_operations.amount", paymentCurrency, "amount"), "payment_operations.status",
+	"payment_operations.decline_reason", "payment_operations.created_at", "payment_operations.settled_at",
+	"payment_intents.order_id", "payment_intents.provider_payment_id",
+}
+
+// recordPaymentOperations stores what the provider has to do for the payments
+// of an order that moved to its current status: capture them once it is
+// accepted, void them once it is cancelled or refund them when they were
+// captured already. What the wallet paid for a cancelled order goes back to
+// it at once. The operations are asked for by runPaymentOperations once the
+// transaction committed. The message tells why the payments can't follow
+// the order yet.
+func recordPaymentOperations(tx *sqlx.Tx, order models.Order) ([]pendingOperation, string, error) {
+	intents, err := orderPayments(tx, order.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	operations := []pendingOperation{}
+	for _, intent := range intents {
+		operation := pendingOperation{
+			PaymentOperation: models.PaymentOperation{
+				ID:              uuid.New(),
+				PaymentIntentID: intent.ID,
+				Amount:          models.NewMoney(0, order.Currency),
+				Status:          models.PaymentOperationPending,
+				CreatedAt:       time.Now(),
+			},
+			OrderID: order.ID,
+		}
+		switch {
+		case order.Status == models.OrderStatusAccepted && intent.Status == models.PaymentAuthorized:
+			operation.Kind, operation.Amount = models.PaymentOperationCapture, intent.Amount
+		case order.Status == models.OrderStatusCancelled && intent.Status == models.PaymentAuthorized:
+			operation.Kind = models.PaymentOperationVoid
+		case order.Status == models.OrderStatusCancelled && intent.Status == models.PaymentCaptured &&
+			intent.CapturedAmount.Cmp(intent.RefundedAmount) > 0:
+			operation.Kind, operation.Amount = models.PaymentOperationRefund, intent.CapturedAmount.Sub(intent.RefundedAmount)
+		default:
+			continue
+		}
+		operation.ProviderPaymentID = *intent.ProviderPaymentID
+
+		if message, err := insertPaymentOperation(tx, operation); err != nil || message != "" {
+			return nil, message, err
+		}
+		operations = append(operations, operation)
+	}
+
+	if order.Status == models.OrderStatusCancelled {
+		if err := returnWalletPayment(tx, order); err != nil {
+			return nil, "", err
+		}
+	}
+	return operations, "", nil
+}
+
+// insertPaymentOperation stores an operation to ask the provider for. An
+// intent has one pending operation at most so that amounts are always worked
+// out from settled ones, the message tells when another is still pending.
+func insertPaymentOperation(tx *sqlx.Tx, operation pendingOperation) (string, error) {
+	var pending bool
+	if err := tx.Get(&pending, "SELECT EXISTS (SELECT 1 FROM payment_operations WHERE payment_intent_id = $1 AND status = $2)",
+		operation.PaymentIntentID, models.PaymentOperationPending); err != nil {
+		return "", err
+	} else if pending {
+		return "A payment of this order is still being processed by the payment provider, try again in a few minutes", nil
+	}
+
+	query, args, err := QB.Insert("payment_operations").
+		Columns("id", "payment_intent_id", "refund_id", "kind", "amount", "status", "created_at").
+		Values(operation.ID, operation.PaymentIntentID, operation.RefundID, operation.Kind, operation.Amount, operation.Status, operation.CreatedAt).
+		ToSql()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(query, args...)
+	return "", err
+}
+
+// requestPaymentOperation asks the provider for an operation. The idempotency
+// key is the ID of the refund the operation makes, or else its own.
+func requestPaymentOperation(operation pendingOperation) (payments.Result, error) {
+	key := operation.ID.String()
+	if operation.RefundID != nil {
+		key = operation.RefundID.String()
+	}
+	switch operation.Kind {
+	case models.PaymentOperationCapture:
+		return paymentProvider.Capture(operation.ProviderPaymentID, operation.Amount, key)
+	case models.PaymentOperationVoid:
+		return paymentProvider.Void(operation.ProviderPaymentID, key)
+	default:
+		return paymentProvider.Refund(operation.ProviderPaymentID, operation.Amount, key)
+	}
+}
+
+// runPaymentOperations asks the provider for operations whose transaction
+// committed and settles each in a transaction of its own. Operations the
+// provider could not be asked for stay pending for settle-payments, the error
+// wraps errPaymentProvider then. The message tells what the provider refused.
+func runPaymentOperations(operations []pendingOperation) (string, error) {
+	var message string
+	var unreachable error
+	for _, operation := range operations {
+		result, err := requestPaymentOperation(operation)
+		if err != nil {
+			unreachable = fmt.Errorf("%w: %v", errPaymentProvider, err)
+			continue
+		}
+		refused, err := settlePaymentOperation(operation.ID, result.Status == payments.StatusDeclined, result.DeclineReason)
+		if err != nil {
+			return message, err
+		}
+		if refused != "" {
+			message = refused
+		}
+	}
+	return message, unreachable
+}
+
+// settlePaymentOperation records the answer of the provider to an operation
+func settlePaymentOperation(id uuid.UUID, declined bool, reason string) (string, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	message, err := applyPaymentOperation(tx, id, declined, reason)
+	if err != nil {
+		return "", err
+	}
+	return message, tx.Commit()
+}
+
+// applyPaymentOperation settles a pending operation with the answer of the
+// provider, an operation settled already is left alone so the request, the
+// webhook and settle-payments can all report the same answer. The money
+// moved is recorded in the ledger. A capture that is declined cancels the
+// order and a refund that is declined goes to the customer's wallet instead,
+// the message tells.
+func applyPaymentOperation(tx *sqlx.Tx, id uuid.UUID, declined bool, reason string) (string, error) {
+	// The order is locked first, as everywhere else, then the operation
+	var orderID uuid.UUID
+	if err := tx.Get(&orderID, `SELECT payment_intents.order_id FROM payment_operations
+		JOIN payment_intents ON payment_intents.id = payment_operations.payment_intent_id
+		WHERE payment_operations.id = $1`, id); err != nil {
+		return "", err
+	}
+	order, err := scopedOrder(tx, nil, orderID.String(), true)
+	if err != nil {
+		return "", err
+	}
+	query, args, err := QB.Select(paymentOperationColumns...).
+		From("payment_operations").
+		Join("payment_intents ON payment_intents.id = payment_operations.payment_intent_id").
+		Where(squirrel.Eq{"payment_operations.id": id}).
+		Suffix("FOR UPDATE OF payment_operations").
+		ToSql()
+	if err != nil {
+		return "", err
+	}
+	var operation pendingOperation
+	if err := tx.Get(&operation, query, args...); err != nil {
+		return "", err
+	}
+	if operation.Status != models.PaymentOperationPending {
+		return "", nil
+	}
+	intent, err := lockPaymentIntent(tx, operation.PaymentIntentID)
+	if err != nil {
+		return "", err
+	}
+
+	var declineReason *string
+	operation.Status = models.PaymentOperationSucceeded
+	if declined {
+		operation.Status, declineReason = models.PaymentOperationDeclined, &reason
+	}
+	query, args, err = QB.Update("payment_operations").
+		Set("status", operation.Status).
+		Set("decline_reason", declineReason).
+		Set("settled_at", time.Now()).
+		Where(squirrel.Eq{"id": operation.ID}).
+		ToSql()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return "", err
+	}
+
+	zero := models.NewMoney(0, order.Currency)
+	message := ""
+	switch {
+	case declined && operation.Kind == models.PaymentOperationCapture:
+		// An order that can't be charged is not prepared
+		intent.Status = models.PaymentFailed
+		message = "The payment provider refused to capture the payment, the order was cancelled: " + reason
+		if order.Status != models.OrderStatusCancelled {
+			order.Status = models.OrderStatusCancelled
+			if err := updateOrderStatus(tx, order); err != nil {
+				return "", err
+			}
+			if err := returnWalletPayment(tx, order); err != nil {
+				return "", err
+			}
+		}
+	case declined && operation.Kind == models.PaymentOperationRefund:
+		// What can't go back on the card goes to the customer's wallet
+		message = "The payment provider refused the refund, it went to the customer's wallet: " + reason
+		referenceID := operation.ID
+		if operation.RefundID != nil {
+			referenceID = *operation.RefundID
+		}
+		transaction, err := refundToWallet(tx, order, operation.Amount, referenceID)
+		if err != nil {
+			return "", err
+		}
+		if operation.RefundID == nil {
+			referenceID = transaction.ID
+		}
+		if err := postRefund(tx, order, referenceID, zero, zero, operation.Amount); err != nil {
+			return "", err
+		}
+		query, args, err := QB.Update("orders").
+			Set("wallet_refunded", order.WalletRefunded.Add(operation.Amount)).
+			Where(squirrel.Eq{"id": order.ID}).
+			ToSql()
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return "", err
+		}
+		return message, settleRefund(tx, operation.RefundID, operation.Amount)
+	case declined:
+		return "The payment provider refused to void the payment: " + reason, nil
+	case operation.Kind == models.PaymentOperationCapture && intent.Status == models.PaymentAuthorized:
+		intent.Status, intent.CapturedAmount = models.PaymentCaptured, operation.Amount
+		if err := postOrderPayment(tx, order, intent.ID, operation.Amount, models.PaymentTypeCard); err != nil {
+			return "", err
+		}
+	case operation.Kind == models.PaymentOperationVoid && intent.Status == models.PaymentAuthorized:
+		intent.Status = models.PaymentVoided
+	case operation.Kind == models.PaymentOperationRefund:
+		intent.RefundedAmount = intent.RefundedAmount.Add(operation.Amount)
+		if intent.RefundedAmount.Cmp(intent.CapturedAmount) == 0 {
+			intent.Status = models.PaymentRefunded
+		}
+		referenceID := operation.ID
+		if operation.RefundID != nil {
+			referenceID = *operation.RefundID
+		}
+		if err := postRefund(tx, order, referenceID, operation.Amount, zero, zero); err != nil {
+			return "", err
+		}
+		if err := settleRefund(tx, operation.RefundID, zero); err != nil {
+			return "", err
+		}
+	default:
+		// The provider's own webhook got there first
+		return "", nil
+	}
+	return message, updatePaymentIntent(tx, intent)
+}
+
+// settleRefund marks the refund of a card refund operation refunded once the
+// provider answered, with the part it declined moved to the wallet. Refund
+// operations of cancelled orders have no refund.
+func settleRefund(tx *sqlx.Tx, refundID *uuid.UUID, toWallet models.Money) error {
+	if refundID == nil {
+		return nil
+	}
+	query, args, err := QB.Update("refunds").
+		Set("status", models.RefundRefunded).
+		Set("card_amount", squirrel.Expr("card_amount - ?", toWallet)).
+		Set("wallet_amount", squirrel.Expr("wallet_amount + ?", toWallet)).
+		Where(squirrel.Eq{"id": *refundID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// updateOrderStatus saves the status of an order
+func updateOrderStatus(q sqlx.Execer, order models.Order) error {
+	query, args, err := QB.Update("orders").
+		Set("status", order.Status).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": order.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(query, args...)
+	return err
+}
+
+// returnWalletPayment gives back to the wallet what it paid for an order
+// that was cancelled or not placed
+func returnWalletPayment(tx *sqlx.Tx, order models.Order) error {
+	walletPaid := order.WalletPaid.Sub(order.WalletRefunded)
+	if walletPaid.Cmp(models.NewMoney(0, order.Currency)) <= 0 {
+		return nil
+	}
+	transaction, err := refundToWallet(tx, order, walletPaid, order.ID)
+	if err != nil {
+		return err
+	}
+	zero := models.NewMoney(0, order.Currency)
+	if err := postRefund(tx, order, transaction.ID, zero, zero, walletPaid); err != nil {
+		return err
+	}
+	query, args, err := QB.Update("orders").
+		Set("wallet_refunded", order.WalletPaid).
+		Where(squirrel.Eq{"id": order.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// authorizationVoidKey is the idempotency key that voids the authorization
+// of an intent whose order was not placed
+func authorizationVoidKey(intentID uuid.UUID) string {
+	return intentID.String() + ":void"
+}
+
+// authorizeCheckout asks the provider to authorize the card part of an order
+// that checkout committed as pending_payment, then places the order. When the
+// card is declined, or the provider can't be reached, the order is given up
+// as payment_failed: the wallet gets back what it paid and the cart is
+// reopened. The error wraps errPaymentProvider when the provider could not be
+// reached, the message tells why the card was declined.
+func authorizeCheckout(order models.Order, intent models.PaymentIntent) (models.Order, string, error) {
+	result, authorizeErr := paymentProvider.Authorize(payments.AuthorizeRequest{
+		Amount:         intent.Amount,
+		PaymentMethod:  intent.PaymentMethod,
+		IdempotencyKey: intent.ID.String(),
+	})
+	authorized := authorizeErr == nil && result.Status == payments.StatusAuthorized
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return order, "", err
+	}
+	defer tx.Rollback()
+
+	order, err = scopedOrder(tx, nil, order.ID.String(), true)
+	if err != nil {
+		return order, "", err
+	}
+	if order.Status != models.OrderStatusPendingPayment {
+		// settle-payments gave up on the checkout in the meantime
+		if authorized {
+			voidAuthorization(result.PaymentID, authorizationVoidKey(intent.ID))
+		}
+		return order, "The payment took too long, try again", nil
+	}
+
+	message := ""
+	switch {
+	case authorized:
+		intent.Status, intent.ProviderPaymentID = models.PaymentAuthorized, &result.PaymentID
+		order.Status = models.OrderStatusPlaced
+		err = updateOrderStatus(tx, order)
+	case authorizeErr == nil:
+		intent.Status = models.PaymentFailed
+		message = "The payment was declined: " + result.DeclineReason
+		err = failCheckout(tx, &order)
+	default:
+		// The intent stays pending for settle-payments to void in case the
+		// provider authorized it after all
+		err = failCheckout(tx, &order)
+	}
+	if err == nil && intent.Status != models.PaymentPending {
+		err = updatePaymentIntent(tx, intent)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		if authorized {
+			voidAuthorization(result.PaymentID, authorizationVoidKey(intent.ID))
+		}
+		return order, "", err
+	}
+	if authorizeErr != nil {
+		return order, "", fmt.Errorf("%w: %v", errPaymentProvider, authorizeErr)
+	}
+	return order, message, nil
+}
+
+// failCheckout gives up on an order that was not paid: it becomes
+// payment_failed, its wallet payment goes back and its cart is the active one
+// again unless the customer filled another one since
+func failCheckout(tx *sqlx.Tx, order *models.Order) error {
+	order.Status = models.OrderStatusPaymentFailed
+	if err := updateOrderStatus(tx, *order); err != nil {
+		return err
+	}
+	if err := returnWalletPayment(tx, *order); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM carts WHERE user_id = $1 AND checked_out_at IS NULL AND quantity = 0", order.CustomerID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE carts SET checked_out_at = NULL WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM carts WHERE user_id = $2 AND checked_out_at IS NULL)`, order.CartID, order.CustomerID)
+	return err
+}
+
+// webhookStatuses maps the provider events to the status they move an
+// authorized payment to
+var webhookStatuses = map[string]string{
+	payments.EventCaptured: models.PaymentCaptured,
+	payments.EventVoided:   models.PaymentVoided,
+	payments.EventFailed:   models.PaymentFailed,
+}
+
+// webhookOperations maps the provider events to the operation they answer
+var webhookOperations = map[string]string{
+	payments.EventCaptured: models.PaymentOperationCapture,
+	payments.EventVoided:   models.PaymentOperationVoid,
+	payments.EventRefunded: models.PaymentOperationRefund,
+}
+
+// PaymentWebhook applies the payment changes the provider notifies: the
+// answer to an operation it was asked for, or a change it made on its own such
+// as an authorization that expired. The payload must carry the provider's
+// signature in the Payment-Signature header. The provider may send an event
+// again, its ID is stored so it is applied once.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Failed to read body")
+		return
+	}
+	event, err := paymentProvider.VerifyWebhook(payload, r.Header.Get("Payment-Signature"))
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			utils.HandleError(w, http.StatusUnauthorized, "Invalid webhook signature")
+			return
+		}
+		utils.HandleError(w, http.StatusBadRequest, "Invalid webhook payload")
+		return
+	}
+	if event.ID == "" || event.PaymentID == "" {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid webhook payload")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Insert("payment_webhook_events").
+		Columns("provider", "event_id", "type", "payment_id", "received_at").
+		Values(paymentProvider.Name(), event.ID, event.Type, event.PaymentID, time.Now()).
+		Suffix("ON CONFLICT DO NOTHING").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record webhook event")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if recorded, err := result.RowsAffected(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record webhook event")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if recorded == 0 {
+		utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Webhook already processed"})
+		return
+	}
+
+	message, err := applyWebhookEvent(tx, event)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Payment not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payment")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payment")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": message})
+}
+
+// applyWebhookEvent applies a new webhook event and tells what came of it,
+// sql.ErrNoRows when the payment is unknown
+func applyWebhookEvent(tx *sqlx.Tx, event payments.Event) (string, error) {
+	// The answer to an operation settles it, the reference is the key it was
+	// asked for with
+	if key, err := uuid.Parse(event.Reference); err == nil {
+		var operation struct {
+			ID   uuid.UUID `db:"id"`
+			Kind string    `db:"kind"`
+		}
+		err := tx.Get(&operation, `SELECT payment_operations.id, payment_operations.kind FROM payment_operations
+			JOIN payment_intents ON payment_intents.id = payment_operations.payment_intent_id
+			WHERE (payment_operations.id = $1 OR payment_operations.refund_id = $1)
+			AND payment_intents.provider = $2 AND payment_intents.provider_payment_id = $3`,
+			key, paymentProvider.Name(), event.PaymentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+		if err == nil {
+			declined := event.Type == payments.EventFailed
+			if !declined && webhookOperations[event.Type] != operation.Kind {
+				return "Webhook ignored", nil
+			}
+			if _, err := applyPaymentOperation(tx, operation.ID, declined, event.Reason); err != nil {
+				return "", err
+			}
+			return "Webhook processed successfully", nil
+		}
+	}
+
+	status, ok := webhookStatuses[event.Type]
+	if !ok {
+		return "Webhook ignored", nil
+	}
+	updateIntent := QB.Update("payment_intents").
+		Set("status", status).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"provider": paymentProvider.Name(), "provider_payment_id": event.PaymentID, "status": models.PaymentAuthorized})
+	if status == models.PaymentCaptured {
+		updateIntent = updateIntent.Set("captured_amount", squirrel.Expr("amount"))
+	}
+	query, args, err := updateIntent.Suffix("RETURNING id, order_id, " + moneyColumn("amount", paymentCurrency, "amount")).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var intent models.PaymentIntent
+	if err := tx.Get(&intent, query, args...); errors.Is(err, sql.ErrNoRows) {
+		// Either an unknown payment or one that already moved on
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM payment_intents WHERE provider = $1 AND provider_payment_id = $2)",
+			paymentProvider.Name(), event.PaymentID); err != nil {
+			return "", err
+		} else if !exists {
+			return "", sql.ErrNoRows
+		}
+	} else if err != nil {
+		return "", err
+	} else if status == models.PaymentCaptured {
+		// Captured at the provider's initiative, recorded as on acceptance
+		order, err := scopedOrder(tx, nil, intent.OrderID.String(), false)
+		if err != nil {
+			return "", err
+		}
+		if err := postOrderPayment(tx, order, intent.ID, intent.Amount, models.PaymentTypeCard); err != nil {
+			return "", err
+		}
+	}
+	return "Webhook processed successfully", nil
+}
+
+// voidAuthorization releases the hold of a payment whose order was not placed
+func voidAuthorization(paymentID, idempotencyKey string) {
+	if _, err := paymentProvider.Void(paymentID, idempotencyKey); err != nil {
+		log.Println(utils.ErrorWithTrace(err, "failed to void payment "+paymentID))
+	}
+}
+
+// SettlePayments settles what the payment provider could not be asked for
+// while a request was served, so it can run from cron. Checkouts left pending
+// are given up: their authorization is asked for again with the same key, to
+// learn whether it was made, and voided. Pending captures, voids and refunds
+// are asked for again and settled.
+func SettlePayments() (models.PaymentSettlementResponse, error) {
+	var settlement models.PaymentSettlementResponse
+	before := time.Now().Add(-paymentRetryDelay)
+
+	query, args, err := QB.Select(paymentIntentColumns...).
+		From("payment_intents").
+		Where(squirrel.Eq{"status": models.PaymentPending}).
+		Where(squirrel.Lt{"created_at": before}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return settlement, err
+	}
+	var intents []models.PaymentIntent
+	if err := db.Select(&intents, query, args...); err != nil {
+		return settlement, err
+	}
+	for _, intent := range intents {
+		abandoned, err := abandonCheckout(intent.ID)
+		if err != nil {
+			return settlement, err
+		}
+		if abandoned {
+			settlement.Abandoned++
+		} else {
+			settlement.Pending++
+		}
+	}
+
+	query, args, err = QB.Select(paymentOperationColumns...).
+		From("payment_operations").
+		Join("payment_intents ON payment_intents.id = payment_operations.payment_intent_id").
+		Where(squirrel.Eq{"payment_operations.status": models.PaymentOperationPending}).
+		Where(squirrel.Lt{"payment_operations.created_at": before}).
+		OrderBy("payment_operations.created_at").
+		ToSql()
+	if err != nil {
+		return settlement, err
+	}
+	var operations []pendingOperation
+	if err := db.Select(&operations, query, args...); err != nil {
+		return settlement, err
+	}
+	for _, operation := range operations {
+		if _, err := runPaymentOperations([]pendingOperation{operation}); errors.Is(err, errPaymentProvider) {
+			settlement.Pending++
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+		} else if err != nil {
+			return settlement, err
+		} else {
+			settlement.Settled++
+		}
+	}
+	return settlement, nil
+}
+
+// abandonCheckout gives up on a checkout whose authorization stayed pending.
+// The order is failed first so that the request that started it can't place
+// it anymore, then the authorization is voided if it was made. It returns
+// false when the checkout stays pending because the provider still can't be
+// reached.
+func abandonCheckout(intentID uuid.UUID) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The order is locked first, as everywhere else, then the intent
+	var orderID uuid.UUID
+	if err := tx.Get(&orderID, "SELECT order_id FROM payment_intents WHERE id = $1", intentID); err != nil {
+		return false, err
+	}
+	order, err := scopedOrder(tx, nil, orderID.String(), true)
+	if err != nil {
+		return false, err
+	}
+	// Settled in the meantime by the request that started it
+	intent, err := lockPaymentIntent(tx, intentID)
+	if err != nil || intent.Status != models.PaymentPending {
+		return err == nil, err
+	}
+	if order.Status == models.OrderStatusPendingPayment {
+		if err := failCheckout(tx, &order); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	result, err := paymentProvider.Authorize(payments.AuthorizeRequest{
+		Amount:         intent.Amount,
+		PaymentMethod:  intent.PaymentMethod,
+		IdempotencyKey: intent.ID.String(),
+	})
+	if err != nil {
+		log.Println(utils.ErrorWithTrace(err, "failed to check payment "+intent.ID.String()))
+		return false, nil
+	}
+	intent.Status = models.PaymentFailed
+	if result.Status == payments.StatusAuthorized {
+		if _, err := paymentProvider.Void(result.PaymentID, authorizationVoidKey(intent.ID)); err != nil {
+			log.Println(utils.ErrorWithTrace(err, "failed to void payment "+result.PaymentID))
+			return false, nil
+		}
+		intent.Status, intent.ProviderPaymentID = models.PaymentVoided, &result.PaymentID
+	}
+	return true, updatePaymentIntent(db, intent)
+}
+
+// orderBalanceColumns sums the payments of the orders row
+var orderBalanceColumns = []string{
+	"orders.id AS order_id", "orders.status", "orders.payment_type", "orders.currency",
+	moneyColumn("orders.order_total_cost", "orders.currency", "order_total_cost"),
+	moneyColumn("orders.refunded_total", "orders.currency", "refunded_total"),
+	moneyColumn("COALESCE((SELECT SUM(amount) FROM payment_intents WHERE payment_intents.order_id = orders.id AND payment_intents.status = 'authorized'), 0)", "orders.currency", "card_authorized"),
+	moneyColumn("COALESCE((SELECT SUM(captured_amount - refunded_amount) FROM payment_intents WHERE payment_intents.order_id = orders.id), 0)", "orders.currency", "card_paid"),
+	moneyColumn("orders.cash_due", "orders.currency", "cash_due"),
+	moneyColumn("COALESCE((SELECT SUM(amount) FROM cash_payments WHERE cash_payments.order_id = orders.id), 0)"+
+		" - COALESCE((SELECT SUM(cash_amount) FROM refunds WHERE refunds.order_id = orders.id), 0)", "orders.currency", "cash_received"),
+	moneyColumn("orders.wallet_paid", "orders.currency", "wallet_paid"),
+	moneyColumn("orders.wallet_refunded", "orders.currency", "wallet_refunded"),
+	"orders.created_at",
+}
+
+// orderBalance reconciles the payments of an order with its total
+func orderBalance(q sqlx.Queryer, orderID uuid.UUID) (models.OrderBalanceResponse, error) {
+	var balance models.OrderBalanceResponse
+	query, args, err := QB.Select(orderBalanceColumns...).From("orders").Where(squirrel.Eq{"orders.id": orderID}).ToSql()
+	if err != nil {
+		return balance, err
+	}
+	if err := sqlx.Get(q, &balance, query, args...); err != nil {
+		return balance, err
+	}
+	balance.Reconcile()
+
+	query, args, err = QB.Select("id", "order_id", moneyColumn("amount", "orders.currency", "amount"),
+		moneyColumn("tendered", "orders.currency", "tendered"), moneyColumn("change_given", "orders.currency", "change_given"),
+		"recorded_by", "cash_payments.created_at").
+		From("cash_payments").
+		Join("orders ON orders.id = cash_payments.order_id").
+		Where(squirrel.Eq{"cash_payments.order_id": orderID}).
+		OrderBy("cash_payments.created_at").
+		ToSql()
+	if err != nil {
+		return balance, err
+	}
+	balance.CashPayments = []models.CashPayment{}
+	err = sqlx.Select(q, &balance.CashPayments, query, args...)
+	return balance, err
+}
+
+// GetOrderBalance tells what one of the vendor's orders was paid by card and
+// in cash and what it still owes
+func GetOrderBalance(w http.ResponseWriter, r *http.Request) {
+	order, err := vendorOrder(db, currentVendorID(r), r.PathValue("id"), false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	balance, err := orderBalance(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balance")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, balance)
+}
+
+// RecordCashPayment records the cash a cashier received for an order. Only
+// the cash the order still owes is applied, the rest is given back as change.
+func RecordCashPayment(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.CashPaymentRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// The order row stays locked so two cashiers can't both collect the same cash
+	order, err := vendorOrder(tx, currentVendorID(r), r.PathValue("id"), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if order.Status == models.OrderStatusCancelled {
+		utils.HandleError(w, http.StatusConflict, "The order was cancelled")
+		return
+	}
+
+	tendered, message := amountIn(req.Tendered, order.Currency)
+	if message != "" {
+		utils.HandleValidationError(w, utils.FieldErrors{"tendered": message})
+		return
+	}
+
+	balance, err := orderBalance(tx, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balance")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	outstanding := balance.CashOutstanding()
+	if outstanding.IsNegative() || outstanding.IsZero() {
+		utils.HandleError(w, http.StatusConflict, "The order has no cash left to collect")
+		return
+	}
+
+	payment := models.CashPayment{
+		ID:          uuid.New(),
+		OrderID:     order.ID,
+		Amount:      tendered,
+		Tendered:    tendered,
+		ChangeGiven: models.NewMoney(0, order.Currency),
+		RecordedBy:  &session.UserID,
+		CreatedAt:   time.Now(),
+	}
+	if tendered.Cmp(outstanding) > 0 {
+		payment.Amount = outstanding
+		payment.ChangeGiven = tendered.Sub(outstanding)
+	}
+
+	query, args, err := QB.Insert("cash_payments").
+		Columns("id", "order_id", "amount", "tendered", "change_given", "recorded_by", "created_at").
+		Values(payment.ID, payment.OrderID, payment.Amount, payment.Tendered, payment.ChangeGiven, payment.RecordedBy, payment.CreatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record cash payment")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := postOrderPayment(tx, order, payment.ID, payment.Amount, models.PaymentTypeCash); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record cash payment in the ledger")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	balance, err = orderBalance(tx, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balance")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record cash payment")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.CashPaymentResponse{Payment: payment, Balance: balance})
+}
+
+// GetReconciliationReport lists the orders completed, cancelled or whose
+// payment failed from ?from= to ?to= (both included, everything by default)
+// whose payments don't add up to what they owe
+func GetReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	errs := utils.FieldErrors{}
+	from, message := queryDate(r, "from")
+	if message != "" {
+		errs["from"] = message
+	}
+	to, message := queryDate(r, "to")
+	if message != "" {
+		errs["to"] = message
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	selectBalances := QB.Select(orderBalanceColumns...).
+		From("orders").
+		Where(squirrel.Eq{"orders.status": []string{models.OrderStatusCompleted, models.OrderStatusCancelled, models.OrderStatusPaymentFailed}}).
+		OrderBy("orders.created_at")
+	if from != nil {
+		selectBalances = selectBalances.Where(squirrel.GtOrEq{"orders.created_at": *from})
+	}
+	if to != nil {
+		selectBalances = selectBalances.Where(squirrel.Lt{"orders.created_at": to.AddDate(0, 0, 1)})
+	}
+	query, args, err := selectBalances.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	var balances []models.OrderBalanceResponse
+	if err := db.Select(&balances, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balances")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	report := models.ReconciliationReportResponse{From: from, To: to, Orders: len(balances), Mismatches: []models.OrderBalanceResponse{}}
+	for _, balance := range balances {
+		balance.Reconcile()
+		// Authorizations still held on a closed order are a mismatch too
+		if !balance.Balance.IsZero() || !balance.CardAuthorized.IsZero() {
+			report.Mismatches = append(report.Mismatches, balance)
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, report)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"resturant/payments"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var paymentIntentRowColumns = []string{
+	"id", "order_id", "provider", "provider_payment_id", "payment_method", "amount", "captured_amount", "refunded_amount",
+	"status", "created_at", "updated_at",
+}
+
+// useFakeProvider points the controllers at the fake payment provider for the test
+func useFakeProvider(t *testing.T) *payments.FakeProvider {
+	provider := &payments.FakeProvider{WebhookSecret: "test-webhook-secret"}
+	previous := paymentProvider
+	SetPaymentProvider(provider)
+	t.Cleanup(func() { SetPaymentProvider(previous) })
+	return provider
+}
+
+func webhookRequest(payload, signature string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/payments/webhook", strings.NewReader(payload))
+	r.Header.Set("Payment-Signature", signature)
+	return r
+}
+
+func TestPaymentWebhookChecksTheSignature(t *testing.T) {
+	provider := useFakeProvider(t)
+	useFakeDB(t)
+	payload := `{"id":"evt_1","type":"payment.voided","payment_id":"fake_1"}`
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"no signature", ""},
+		{"other secret", (&payments.FakeProvider{WebhookSecret: "other-secret"}).Sign([]byte(payload))},
+		{"other payload", provider.Sign([]byte(`{"id":"evt_1","type":"payment.captured","payment_id":"fake_1"}`))},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		PaymentWebhook(w, webhookRequest(payload, tt.signature))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, http.StatusUnauthorized, w.Body)
+		}
+	}
+}
+
+func TestPaymentWebhookAppliesEventsOnce(t *testing.T) {
+	intentID, orderID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		script  func(f *fakeDB)
+		status  int
+		message string
+		commits int
+	}{
+		{"new event", func(f *fakeDB) {
+			f.expect("INSERT INTO payment_webhook_events").affects(1)
+			f.expect("UPDATE payment_intents").returns([]string{"id", "order_id", "amount"},
+				[]driver.Value{intentID.String(), orderID.String(), "12.50 USD"})
+		}, http.StatusOK, "Webhook processed successfully", 1},
+		{"event sent again", func(f *fakeDB) {
+			f.expect("INSERT INTO payment_webhook_events").affects(0)
+		}, http.StatusOK, "Webhook already processed", 0},
+		{"unknown payment", func(f *fakeDB) {
+			f.expect("INSERT INTO payment_webhook_events").affects(1)
+			f.expect("UPDATE payment_intents").returns([]string{"id", "order_id", "amount"})
+			f.expect("SELECT EXISTS").returns([]string{"exists"}, []driver.Value{false})
+		}, http.StatusNotFound, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := useFakeProvider(t)
+			f := useFakeDB(t)
+			tt.script(f)
+
+			payload := `{"id":"evt_1","type":"payment.voided","payment_id":"fake_1"}`
+			w := httptest.NewRecorder()
+			PaymentWebhook(w, webhookRequest(payload, provider.Sign([]byte(payload))))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.message != "" && body["message"] != tt.message {
+				t.Errorf("message = %v, want %q", body["message"], tt.message)
+			}
+			if f.commits != tt.commits {
+				t.Errorf("commits = %d, want %d", f.commits, tt.commits)
+			}
+			if !containsArg(f.expected[0].args, "evt_1") {
+				t.Errorf("event ID not stored, args %v", f.expected[0].args)
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookRefusesEventsWithoutID(t *testing.T) {
+	provider := useFakeProvider(t)
+	useFakeDB(t)
+
+	payload := `{"type":"payment.voided","payment_id":"fake_1"}`
+	w := httptest.NewRecorder()
+	PaymentWebhook(w, webhookRequest(payload, provider.Sign([]byte(payload))))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
@@ -0,0 +1,561 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// payoutsLockID is the advisory lock taken while statements are generated, so
+// two runs cannot both pay out the same ledger entries
+const payoutsLockID = 3202
+
+// ErrPayoutPeriod is returned by GeneratePayouts for a day that has not ended
+var ErrPayoutPeriod = errors.New("payouts can only be generated up to yesterday")
+
+// vendorCommission reads the commission of a vendor, in the vendor's currency
+func vendorCommission(q sqlx.Queryer, vendorID uuid.UUID) (models.VendorCommissionResponse, error) {
+	commission := models.VendorCommissionResponse{PlatformPercent: commissionPercent}
+	query, args, err := QB.Select("vendor_id", "trim_scale(commission_percent)::text AS percent",
+		moneyColumn("commission_fee", "currency", "fixed_fee")).
+		From("vendors").
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		return commission, err
+	}
+	err = sqlx.Get(q, &commission, query, args...)
+	return commission, err
+}
+
+// GetVendorCommission returns the commission of a vendor, the vendor of the
+// session on vendor routes
+func GetVendorCommission(w http.ResponseWriter, r *http.Request) {
+	vendorID := currentVendorID(r)
+	if vendorID == uuid.Nil {
+		var err error
+		if vendorID, err = uuid.Parse(r.PathValue("id")); err != nil {
+			utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+			return
+		}
+	}
+
+	commission, err := vendorCommission(db, vendorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get commission")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, commission)
+}
+
+// SetVendorCommission sets the percentage and fixed fee a vendor pays on
+// orders placed from now on, orders already placed keep theirs
+func SetVendorCommission(w http.ResponseWriter, r *http.Request) {
+	vendorID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	}
+
+	var req models.VendorCommissionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	currency, err := vendorCurrency(db, vendorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	errs := utils.FieldErrors{}
+	var percent *string
+	if req.Percent != "" {
+		rate, ok := new(big.Rat).SetString(req.Percent.String())
+		if !ok || !percentPattern.MatchString(req.Percent.String()) || rate.Cmp(big.NewRat(100, 1)) > 0 {
+			errs["percent"] = "must be a percentage between 0 and 100 with at most 2 decimals"
+		} else {
+			value := req.Percent.String()
+			percent = &value
+		}
+	}
+	fee, message := amountIn(req.FixedFee, currency)
+	if message != "" {
+		errs["fixed_fee"] = message
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	query, args, err := QB.Update("vendors").
+		Set("commission_percent", percent).
+		Set("commission_fee", fee).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.VendorCommissionResponse{
+		VendorID:        vendorID,
+		Percent:         percent,
+		PlatformPercent: commissionPercent,
+		FixedFee:        fee,
+	})
+}
+
+// unpaidEntries selects the payment and refund entries of orders not paid out
+// yet, recorded before the end of the day until
+func unpaidEntries(columns []string, until time.Time, vendorID *uuid.UUID) squirrel.SelectBuilder {
+	selectEntries := QB.Select(columns...).
+		From("journal_entries").
+		Join("orders ON orders.id = journal_entries.order_id").
+		Where(squirrel.Eq{"journal_entries.kind": []string{models.EntryOrderPayment, models.EntryRefund}}).
+		Where(squirrel.Lt{"journal_entries.created_at": until.AddDate(0, 0, 1)}).
+		Where("NOT EXISTS (SELECT 1 FROM payout_entries WHERE payout_entries.entry_id = journal_entries.id)")
+	if vendorID != nil {
+		selectEntries = selectEntries.Where(squirrel.Eq{"orders.vendor_id": *vendorID})
+	}
+	return selectEntries
+}
+
+// payoutLineColumns sum the postings of an order's entries on the vendor's
+// accounts and on the platform commission. What the customer paid is what
+// the vendor earned plus the commission.
+var payoutLineColumns = []string{
+	"orders.vendor_id", "ledger_accounts.currency", "journal_entries.order_id",
+	"to_char(MIN(journal_entries.created_at), 'YYYY-MM-DD') AS first_entry",
+	moneyColumn(fmt.Sprintf("SUM(CASE WHEN journal_entries.kind = '%s' AND ledger_accounts.name <> '%s' THEN -ledger_postings.amount ELSE 0 END)",
+		models.EntryOrderPayment, models.AccountCash), "ledger_accounts.currency", "gross_sales"),
+	moneyColumn(fmt.Sprintf("SUM(CASE WHEN journal_entries.kind = '%s' AND ledger_accounts.name <> '%s' THEN ledger_postings.amount ELSE 0 END)",
+		models.EntryRefund, models.AccountCash), "ledger_accounts.currency", "refunds"),
+	moneyColumn(fmt.Sprintf("SUM(CASE WHEN ledger_accounts.name = '%s' THEN -ledger_postings.amount ELSE 0 END)",
+		models.AccountCommission), "ledger_accounts.currency", "commission"),
+	moneyColumn(fmt.Sprintf("SUM(CASE WHEN ledger_accounts.name = '%s' THEN -ledger_postings.amount ELSE 0 END)",
+		models.AccountPayable), "ledger_accounts.currency", "net_payout"),
+	moneyColumn(fmt.Sprintf("SUM(CASE WHEN ledger_accounts.name = '%s' THEN ledger_postings.amount ELSE 0 END)",
+		models.AccountCash), "ledger_accounts.currency", "cash_collected"),
+}
+
+// GeneratePayouts writes a pending statement per vendor and currency, or for
+// one vendor, covering the ledger entries of their orders not paid out yet up
+// to the end of the day until
+func GeneratePayouts(until time.Time, vendorID *uuid.UUID) ([]models.Payout, error) {
+	payouts := []models.Payout{}
+	year, month, day := time.Now().Date()
+	if today := time.Date(year, month, day, 0, 0, 0, 0, time.Local); !until.Before(today) {
+		return payouts, ErrPayoutPeriod
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return payouts, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", payoutsLockID); err != nil {
+		return payouts, err
+	}
+
+	query, args, err := unpaidEntries(payoutLineColumns, until, vendorID).
+		Join("ledger_postings ON ledger_postings.entry_id = journal_entries.id").
+		Join("ledger_accounts ON ledger_accounts.id = ledger_postings.account_id").
+		Where(squirrel.Or{
+			squirrel.Expr("ledger_accounts.owner_type = ? AND ledger_accounts.owner_id = orders.vendor_id", models.LedgerOwnerVendor),
+			squirrel.Eq{"ledger_accounts.owner_type": models.LedgerOwnerPlatform, "ledger_accounts.name": models.AccountCommission},
+		}).
+		GroupBy("orders.vendor_id", "ledger_accounts.currency", "journal_entries.order_id").
+		OrderBy("orders.vendor_id", "ledger_accounts.currency", "first_entry").
+		ToSql()
+	if err != nil {
+		return payouts, err
+	}
+	var lines []struct {
+		models.PayoutLine
+		VendorID      uuid.UUID    `db:"vendor_id"`
+		Currency      string       `db:"currency"`
+		FirstEntry    string       `db:"first_entry"`
+		CashCollected models.Money `db:"cash_collected"`
+	}
+	if err := tx.Select(&lines, query, args...); err != nil {
+		return payouts, err
+	}
+
+	// Lines come sorted, a statement starts with each vendor and currency
+	now := time.Now()
+	for i, line := range lines {
+		if i == 0 || line.VendorID != lines[i-1].VendorID || line.Currency != lines[i-1].Currency {
+			zero := models.NewMoney(0, line.Currency)
+			payouts = append(payouts, models.Payout{
+				ID:            uuid.New(),
+				VendorID:      line.VendorID,
+				Currency:      line.Currency,
+				PeriodStart:   line.FirstEntry,
+				PeriodEnd:     until.Format(time.DateOnly),
+				GrossSales:    zero,
+				Refunds:       zero,
+				Commission:    zero,
+				NetPayout:     zero,
+				CashCollected: zero,
+				Status:        models.PayoutPending,
+				CreatedAt:     now,
+			})
+		}
+		payout := &payouts[len(payouts)-1]
+		if line.FirstEntry < payout.PeriodStart {
+			payout.PeriodStart = line.FirstEntry
+		}
+		payout.GrossSales = payout.GrossSales.Add(line.GrossSales)
+		payout.Refunds = payout.Refunds.Add(line.Refunds)
+		payout.Commission = payout.Commission.Add(line.Commission)
+		payout.NetPayout = payout.NetPayout.Add(line.NetPayout)
+		payout.CashCollected = payout.CashCollected.Add(line.CashCollected)
+		payout.Lines = append(payout.Lines, line.PayoutLine)
+	}
+
+	for i := range payouts {
+		payout := &payouts[i]
+		payout.AmountDue = payout.NetPayout.Sub(payout.CashCollected)
+
+		// A statement follows the previous one of the vendor
+		var previousEnd sql.NullTime
+		if err := tx.Get(&previousEnd, "SELECT MAX(period_end) FROM payouts WHERE vendor_id = $1 AND currency = $2",
+			payout.VendorID, payout.Currency); err != nil {
+			return payouts, err
+		}
+		if previousEnd.Valid {
+			if start := previousEnd.Time.AddDate(0, 0, 1).Format(time.DateOnly); start <= payout.PeriodEnd {
+				payout.PeriodStart = start
+			}
+		}
+
+		query, args, err := QB.Insert("payouts").
+			Columns("id", "vendor_id", "currency", "period_start", "period_end", "gross_sales", "refunds", "commission",
+				"net_payout", "cash_collected", "amount_due", "status", "created_at").
+			Values(payout.ID, payout.VendorID, payout.Currency, payout.PeriodStart, payout.PeriodEnd, payout.GrossSales, payout.Refunds,
+				payout.Commission, payout.NetPayout, payout.CashCollected, payout.AmountDue, payout.Status, payout.CreatedAt).
+			ToSql()
+		if err != nil {
+			return payouts, err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return payouts, err
+		}
+
+		insertLines := QB.Insert("payout_lines").Columns("payout_id", "order_id", "gross_sales", "refunds", "commission", "net_payout")
+		for _, line := range payout.Lines {
+			insertLines = insertLines.Values(payout.ID, line.OrderID, line.GrossSales, line.Refunds, line.Commission, line.NetPayout)
+		}
+		query, args, err = insertLines.ToSql()
+		if err != nil {
+			return payouts, err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return payouts, err
+		}
+
+		// The entries of the statement are not paid out again
+		query, args, err = unpaidEntries([]string{"journal_entries.id"}, until, &payout.VendorID).
+			Column("?::uuid", payout.ID).
+			Where("EXISTS (SELECT 1 FROM ledger_postings JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id WHERE ledger_postings.entry_id = journal_entries.id AND ledger_accounts.currency = ?)", payout.Currency).
+			Prefix("INSERT INTO payout_entries (entry_id, payout_id)").
+			ToSql()
+		if err != nil {
+			return payouts, err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return payouts, err
+		}
+	}
+
+	err = tx.Commit()
+	return payouts, err
+}
+
+// CreatePayouts generates the pending statements up to the end of a day
+func CreatePayouts(w http.ResponseWriter, r *http.Request) {
+	var req models.GeneratePayoutsRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	until, err := time.ParseInLocation(time.DateOnly, req.Until, time.Local)
+	if err != nil {
+		utils.HandleValidationError(w, utils.FieldErrors{"until": "must be a date in YYYY-MM-DD format"})
+		return
+	}
+
+	payouts, err := GeneratePayouts(until, req.VendorID)
+	if errors.Is(err, ErrPayoutPeriod) {
+		utils.HandleValidationError(w, utils.FieldErrors{"until": "must be a day that has ended"})
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate payouts")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, payouts)
+}
+
+var payoutColumns = []string{
+	"id", "vendor_id", "currency", "to_char(period_start, 'YYYY-MM-DD') AS period_start", "to_char(period_end, 'YYYY-MM-DD') AS period_end",
+	moneyColumn("gross_sales", "currency", "gross_sales"), moneyColumn("refunds", "currency", "refunds"),
+	moneyColumn("commission", "currency", "commission"), moneyColumn("net_payout", "currency", "net_payout"),
+	moneyColumn("cash_collected", "currency", "cash_collected"), moneyColumn("amount_due", "currency", "amount_due"),
+	"status", "approved_by", "approved_at", "paid_by", "paid_at", "payment_reference", "created_at",
+}
+
+// GetPayouts lists payout statements, newest first. Admins filter them with
+// ?vendor_id=, vendors only see theirs; both filter with ?status=
+func GetPayouts(w http.ResponseWriter, r *http.Request) {
+	selectPayouts := QB.Select(payoutColumns...).
+		From("payouts").
+		OrderBy("period_end DESC", "created_at DESC")
+	if vendorID := orderScope(r); vendorID != nil {
+		selectPayouts = selectPayouts.Where(squirrel.Eq{"vendor_id": *vendorID})
+	} else if raw := r.URL.Query().Get("vendor_id"); raw != "" {
+		vendorID, err := uuid.Parse(raw)
+		if err != nil {
+			utils.HandleValidationError(w, utils.FieldErrors{"vendor_id": "must be a UUID"})
+			return
+		}
+		selectPayouts = selectPayouts.Where(squirrel.Eq{"vendor_id": vendorID})
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		selectPayouts = selectPayouts.Where(squirrel.Eq{"status": status})
+	}
+	query, args, err := selectPayouts.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	payouts := []models.Payout{}
+	if err := db.Select(&payouts, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get payouts")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, payouts)
+}
+
+// scopedPayout loads a payout of the vendor, or any payout without one. With
+// lock set the row stays locked until the transaction ends.
+func scopedPayout(q sqlx.Queryer, vendorID *uuid.UUID, id string, lock bool) (models.Payout, error) {
+	var payout models.Payout
+	payoutID, err := uuid.Parse(id)
+	if err != nil {
+		return payout, sql.ErrNoRows
+	}
+	selectPayout := QB.Select(payoutColumns...).From("payouts").Where(squirrel.Eq{"id": payoutID})
+	if vendorID != nil {
+		selectPayout = selectPayout.Where(squirrel.Eq{"vendor_id": *vendorID})
+	}
+	if lock {
+		selectPayout = selectPayout.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectPayout.ToSql()
+	if err != nil {
+		return payout, err
+	}
+	err = sqlx.Get(q, &payout, query, args...)
+	return payout, err
+}
+
+// GetPayout returns a payout statement with its lines per order
+func GetPayout(w http.ResponseWriter, r *http.Request) {
+	payout, err := scopedPayout(db, orderScope(r), r.PathValue("id"), false)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Payout not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Select("order_id", moneyColumn("payout_lines.gross_sales", "payouts.currency", "gross_sales"),
+		moneyColumn("payout_lines.refunds", "payouts.currency", "refunds"), moneyColumn("payout_lines.commission", "payouts.currency", "commission"),
+		moneyColumn("payout_lines.net_payout", "payouts.currency", "net_payout")).
+		From("payout_lines").
+		Join("payouts ON payouts.id = payout_lines.payout_id").
+		Where(squirrel.Eq{"payout_id": payout.ID}).
+		OrderBy("order_id").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	payout.Lines = []models.PayoutLine{}
+	if err := db.Select(&payout.Lines, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get payout lines")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, payout)
+}
+
+// ApprovePayout approves a pending statement for payment
+func ApprovePayout(w http.ResponseWriter, r *http.Request) {
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	payout, err := scopedPayout(tx, nil, r.PathValue("id"), true)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Payout not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if payout.Status != models.PayoutPending {
+		utils.HandleError(w, http.StatusConflict, fmt.Sprintf("The payout is already %s", payout.Status))
+		return
+	}
+
+	session := currentSession(r)
+	now := time.Now()
+	payout.Status, payout.ApprovedBy, payout.ApprovedAt = models.PayoutApproved, &session.UserID, &now
+	query, args, err := QB.Update("payouts").
+		Set("status", payout.Status).
+		Set("approved_by", payout.ApprovedBy).
+		Set("approved_at", payout.ApprovedAt).
+		Where(squirrel.Eq{"id": payout.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to approve payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to approve payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, payout)
+}
+
+// MarkPayoutPaid records that an approved statement was settled, with the
+// reference of the bank transfer
+func MarkPayoutPaid(w http.ResponseWriter, r *http.Request) {
+	var req models.PayoutPaidRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	payout, err := scopedPayout(tx, nil, r.PathValue("id"), true)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.HandleError(w, http.StatusNotFound, "Payout not found")
+		return
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if payout.Status != models.PayoutApproved {
+		utils.HandleError(w, http.StatusConflict, fmt.Sprintf("Only approved payouts can be paid, this one is %s", payout.Status))
+		return
+	}
+
+	session := currentSession(r)
+	now := time.Now()
+	payout.Status, payout.PaidBy, payout.PaidAt, payout.PaymentReference = models.PayoutPaid, &session.UserID, &now, &req.PaymentReference
+	query, args, err := QB.Update("payouts").
+		Set("status", payout.Status).
+		Set("paid_by", payout.PaidBy).
+		Set("paid_at", payout.PaidAt).
+		Set("payment_reference", payout.PaymentReference).
+		Where(squirrel.Eq{"id": payout.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := postPayout(tx, payout); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record payout in the ledger")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payout")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, payout)
+}
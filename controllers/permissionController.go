@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"strconv"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// permissionGranted is true when one of the user's roles grants the permission
+const permissionGranted = `EXISTS (SELECT 1 FROM user_roles
+	JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+	JOIN permissions ON permissions.id = role_permissions.permission_id
+	WHERE user_roles.user_id = users.id AND permissions.name = ?)`
+
+// RequirePermission only lets through users whose roles grant the permission,
+// e.g. RequirePermission("orders:refund"). It must run after RequireAuth.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return requireAccess(squirrel.Expr(permissionGranted, permission))
+}
+
+// hasPermission is the check behind RequirePermission for handlers that only
+// need it on some paths
+func hasPermission(q sqlx.Queryer, userID uuid.UUID, permission string) (bool, error) {
+	query, args, err := QB.Select().
+		Column(squirrel.Expr(permissionGranted, permission)).
+		From("users").
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	var granted bool
+	err = sqlx.Get(q, &granted, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return granted, err
+}
+
+// roleColumns selects a role with the names of its permissions
+var roleColumns = []string{
+	"roles.id", "roles.name", "roles.scope", "roles.vendor_id",
+	"ARRAY(SELECT permissions.name FROM role_permissions JOIN permissions ON permissions.id = role_permissions.permission_id WHERE role_permissions.role_id = roles.id ORDER BY permissions.name) AS permissions",
+}
+
+func getRole(q sqlx.Queryer, roleID int) (models.RoleResponse, error) {
+	var role models.RoleResponse
+	query, args, err := QB.Select(roleColumns...).From("roles").Where(squirrel.Eq{"roles.id": roleID}).ToSql()
+	if err != nil {
+		return role, err
+	}
+	err = sqlx.Get(q, &role, query, args...)
+	return role, err
+}
+
+// errUnknownPermission is returned when a role is given a permission that
+// does not exist or belongs to another scope
+type errUnknownPermission []string
+
+func (e errUnknownPermission) Error() string {
+	return fmt.Sprintf("unknown permissions for this role: %v", []string(e))
+}
+
+// setRolePermissions replaces the permissions of the role, they must all
+// exist in the role's scope
+func setRolePermissions(tx *sqlx.Tx, role models.RoleResponse, names []string) error {
+	var ids []int
+	query, args, err := QB.Select("id").
+		From("permissions").
+		Where(squirrel.Eq{"scope": role.Scope}).
+		Where("name = ANY(?)", pq.StringArray(names)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if err := tx.Select(&ids, query, args...); err != nil {
+		return err
+	}
+	if len(ids) != len(uniqueStrings(names)) {
+		var known []string
+		query, args, err := QB.Select("name").From("permissions").Where(squirrel.Eq{"scope": role.Scope}).ToSql()
+		if err != nil {
+			return err
+		}
+		if err := tx.Select(&known, query, args...); err != nil {
+			return err
+		}
+		var unknown errUnknownPermission
+		for _, name := range names {
+			if !containsString(known, name) {
+				unknown = append(unknown, name)
+			}
+		}
+		return unknown
+	}
+
+	query, args, err = QB.Delete("role_permissions").Where(squirrel.Eq{"role_id": role.ID}).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	insert := QB.Insert("role_permissions").Columns("role_id", "permission_id")
+	for _, id := range ids {
+		insert = insert.Values(role.ID, id)
+	}
+	query, args, err = insert.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !containsString(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func GetPermissions(w http.ResponseWriter, r *http.Request) {
+	var permissions []models.Permission
+	query, args, err := QB.Select("id", "name", "description", "scope").From("permissions").OrderBy("scope", "name").ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&permissions, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, permissions)
+}
+
+// GetRoles lists the built-in roles, vendors' custom roles are left out
+func GetRoles(w http.ResponseWriter, r *http.Request) {
+	var roles []models.RoleResponse
+	query, args, err := QB.Select(roleColumns...).From("roles").Where(squirrel.Eq{"roles.vendor_id": nil}).OrderBy("roles.id").ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&roles, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get roles")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, roles)
+}
+
+// UpdateRolePermissions replaces the permissions of a built-in role. The admin
+// role always keeps every platform permission so admins cannot lock themselves out.
+func UpdateRolePermissions(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid role ID")
+		return
+	}
+	if roleID == adminRoleID {
+		utils.HandleError(w, http.StatusConflict, "The admin role always has every platform permission")
+		return
+	}
+
+	var req models.RolePermissionsRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	role, err := getRole(tx, roleID)
+	if err != nil || role.VendorID != nil {
+		utils.HandleError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	if err := setRolePermissions(tx, role, req.Permissions); err != nil {
+		var unknown errUnknownPermission
+		if errors.As(err, &unknown) {
+			utils.HandleError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update role permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	role, err = getRole(tx, roleID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update role permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, role)
+}
+
+// GetVendorRoles lists the roles a vendor can give its staff: the built-in
+// staff roles and the vendor's own roles
+func GetVendorRoles(w http.ResponseWriter, r *http.Request) {
+	var roles []models.RoleResponse
+	query, args, err := QB.Select(roleColumns...).
+		From("roles").
+		Where(assignableRoles(currentVendorID(r))).
+		OrderBy("roles.id").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&roles, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get roles")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, roles)
+}
+
+// vendorRoleNameTaken reports whether the vendor already has a role with that
+// name, ignoring the role being renamed
+func vendorRoleNameTaken(q sqlx.Queryer, vendorID uuid.UUID, name string, exceptID int) (bool, error) {
+	var taken bool
+	err := sqlx.Get(q, &taken,
+		"SELECT EXISTS (SELECT 1 FROM roles WHERE vendor_id = $1 AND name = $2 AND id <> $3)",
+		vendorID, name, exceptID,
+	)
+	return taken, err
+}
+
+func CreateVendorRole(w http.ResponseWriter, r *http.Request) {
+	vendorID := currentVendorID(r)
+
+	var req models.RoleRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	if taken, err := vendorRoleNameTaken(tx, vendorID, req.Name, 0); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check role name")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A role with this name already exists")
+		return
+	}
+
+	role := models.RoleResponse{Name: req.Name, Scope: models.ScopeVendor, VendorID: &vendorID}
+	query, args, err := QB.Insert("roles").
+		Columns("name", "scope", "vendor_id").
+		Values(role.Name, role.Scope, role.VendorID).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&role.ID, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := setRolePermissions(tx, role, req.Permissions); err != nil {
+		var unknown errUnknownPermission
+		if errors.As(err, &unknown) {
+			utils.HandleError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to set role permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	role, err = getRole(tx, role.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, role)
+}
+
+// vendorRole loads one of the vendor's own roles, built-in roles cannot be
+// changed by vendors
+func vendorRole(q sqlx.Queryer, r *http.Request) (models.RoleResponse, error) {
+	roleID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return models.RoleResponse{}, sql.ErrNoRows
+	}
+	role, err := getRole(q, roleID)
+	if err != nil {
+		return role, err
+	}
+	if role.VendorID == nil || *role.VendorID != currentVendorID(r) {
+		return role, sql.ErrNoRows
+	}
+	return role, nil
+}
+
+func UpdateVendorRole(w http.ResponseWriter, r *http.Request) {
+	var req models.RoleRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	role, err := vendorRole(tx, r)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Role not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if taken, err := vendorRoleNameTaken(tx, *role.VendorID, req.Name, role.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check role name")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A role with this name already exists")
+		return
+	}
+
+	query, args, err := QB.Update("roles").Set("name", req.Name).Where(squirrel.Eq{"id": role.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := setRolePermissions(tx, role, req.Permissions); err != nil {
+		var unknown errUnknownPermission
+		if errors.As(err, &unknown) {
+			utils.HandleError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to set role permissions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	role, err = getRole(tx, role.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, role)
+}
+
+// DeleteVendorRole deletes one of the vendor's roles once nobody holds it
+func DeleteVendorRole(w http.ResponseWriter, r *http.Request) {
+	role, err := vendorRole(db, r)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Role not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Delete("roles").
+		Where(squirrel.Eq{"id": role.ID}).
+		Where("NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.role_id = roles.id)").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		utils.HandleError(w, http.StatusConflict, "The role is still given to staff members")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Role deleted successfully",
+	})
+}
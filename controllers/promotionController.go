@@ -0,0 +1,613 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// couponCodePattern matches codes once upper-cased, customers type them in any case
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+
+// percentPattern matches the percentages that fit the decimal(5, 2) percent column
+var percentPattern = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,2})?$`)
+
+// promotionColumns selects promotions with the number of orders placed with
+// them, cancelled ones left out
+var promotionColumns = []string{
+	"id", "code", "description", "vendor_id", "kind", "trim_scale(percent)::text AS percent",
+	moneyColumn("amount", "currency", "amount"), "item_id", "buy_quantity", "get_quantity",
+	moneyColumn("min_spend", fmt.Sprintf("COALESCE(currency, '%s')", models.DefaultCurrency), "min_spend"),
+	"currency", "starts_at", "ends_at", "max_uses", "max_uses_per_customer", "active",
+	fmt.Sprintf("(SELECT COUNT(*) FROM orders WHERE orders.promotion_id = promotions.id AND orders.status NOT IN ('%s', '%s')) AS uses",
+		models.OrderStatusCancelled, models.OrderStatusPaymentFailed),
+	"created_at", "updated_at",
+}
+
+// promotionScope is the vendor whose promotions the user manages, nil for
+// admins who manage every promotion
+func promotionScope(r *http.Request) *uuid.UUID {
+	if vendorID := currentVendorID(r); vendorID != uuid.Nil {
+		return &vendorID
+	}
+	return nil
+}
+
+// loadPromotion loads the promotion matching where, with lock set the row
+// stays locked until the transaction ends
+func loadPromotion(q sqlx.Queryer, where squirrel.Sqlizer, lock bool) (models.Promotion, error) {
+	var promotion models.Promotion
+	selectPromotion := QB.Select(promotionColumns...).From("promotions").Where(where)
+	if lock {
+		selectPromotion = selectPromotion.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectPromotion.ToSql()
+	if err != nil {
+		return promotion, err
+	}
+	err = sqlx.Get(q, &promotion, query, args...)
+	return promotion, err
+}
+
+// promotionFromRequest validates the request against the promotion kind and
+// builds the promotion. Buy-x-get-y promotions belong to the vendor of their
+// item and amounts are in the vendor's currency.
+func promotionFromRequest(q sqlx.Queryer, vendorID *uuid.UUID, req models.PromotionRequest) (models.Promotion, utils.FieldErrors, error) {
+	promotion := models.Promotion{
+		Code:        strings.ToUpper(strings.TrimSpace(req.Code)),
+		Description: req.Description,
+		VendorID:    vendorID,
+		Kind:        req.Kind,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if req.MaxUses > 0 {
+		promotion.MaxUses = &req.MaxUses
+	}
+	if req.MaxUsesPerCustomer > 0 {
+		promotion.MaxUsesPerCustomer = &req.MaxUsesPerCustomer
+	}
+
+	errs := utils.FieldErrors{}
+	if !couponCodePattern.MatchString(promotion.Code) {
+		errs["code"] = "must only hold letters, digits, - and _"
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		errs["ends_at"] = "must be after starts_at"
+	}
+	switch req.Kind {
+	case models.PromotionPercentage:
+		percent, ok := new(big.Rat).SetString(req.Percent.String())
+		if req.Percent == "" {
+			errs["percent"] = "is required for percentage promotions"
+		} else if !ok || !percentPattern.MatchString(req.Percent.String()) || percent.Sign() <= 0 || percent.Cmp(big.NewRat(100, 1)) > 0 {
+			errs["percent"] = "must be a percentage above 0 and up to 100 with at most 2 decimals"
+		} else {
+			rate := req.Percent.String()
+			promotion.Percent = &rate
+		}
+	case models.PromotionFixed:
+		if req.Amount.IsZero() {
+			errs["amount"] = "is required for fixed promotions"
+		}
+	case models.PromotionBuyXGetY:
+		if req.ItemID == nil {
+			errs["item_id"] = "is required for buy_x_get_y promotions"
+		}
+		if req.BuyQuantity == 0 {
+			errs["buy_quantity"] = "is required for buy_x_get_y promotions"
+		}
+		if req.GetQuantity == 0 {
+			errs["get_quantity"] = "is required for buy_x_get_y promotions"
+		}
+		promotion.ItemID, promotion.BuyQuantity, promotion.GetQuantity = req.ItemID, &req.BuyQuantity, &req.GetQuantity
+	}
+	if len(errs) > 0 {
+		return promotion, errs, nil
+	}
+
+	if promotion.ItemID != nil {
+		var itemVendorID uuid.UUID
+		err := sqlx.Get(q, &itemVendorID, "SELECT vendor_id FROM items WHERE id = $1 AND deleted_at IS NULL", *promotion.ItemID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && promotion.VendorID != nil && *promotion.VendorID != itemVendorID {
+			return promotion, utils.FieldErrors{"item_id": "is not an item of the vendor"}, nil
+		}
+		if err != nil {
+			return promotion, nil, err
+		}
+		promotion.VendorID = &itemVendorID
+	}
+
+	currency := req.Currency
+	if promotion.VendorID != nil {
+		var err error
+		if currency, err = vendorCurrency(q, *promotion.VendorID); errors.Is(err, sql.ErrNoRows) {
+			return promotion, utils.FieldErrors{"vendor_id": "is not a vendor"}, nil
+		} else if err != nil {
+			return promotion, nil, err
+		}
+	}
+	if currency == "" {
+		if req.Kind == models.PromotionFixed || !req.MinSpend.IsZero() {
+			return promotion, utils.FieldErrors{"currency": "is required for platform-wide promotions with an amount or a minimum spend"}, nil
+		}
+		return promotion, nil, nil
+	}
+	promotion.Currency = &currency
+	var message string
+	if promotion.MinSpend, message = amountIn(req.MinSpend, currency); message != "" {
+		errs["min_spend"] = message
+	}
+	if req.Kind == models.PromotionFixed {
+		amount, message := amountIn(req.Amount, currency)
+		if message != "" {
+			errs["amount"] = message
+		}
+		promotion.Amount = &amount
+	}
+	if len(errs) > 0 {
+		return promotion, errs, nil
+	}
+	return promotion, nil, nil
+}
+
+// GetPromotions lists the promotions of the vendor the user works for, or
+// every promotion for admins
+func GetPromotions(w http.ResponseWriter, r *http.Request) {
+	selectPromotions := QB.Select(promotionColumns...).From("promotions").OrderBy("created_at DESC")
+	if vendorID := promotionScope(r); vendorID != nil {
+		selectPromotions = selectPromotions.Where(squirrel.Eq{"vendor_id": *vendorID})
+	}
+	query, args, err := selectPromotions.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	promotions := []models.Promotion{}
+	if err := db.Select(&promotions, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get promotions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, promotions)
+}
+
+// CreatePromotion creates a promotion, of the vendor the user works for or,
+// for admins, of the vendor given (platform-wide without one)
+func CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	var req models.PromotionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	vendorID := promotionScope(r)
+	if vendorID == nil {
+		vendorID = req.VendorID
+	}
+	promotion, errs, err := promotionFromRequest(db, vendorID, req)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	promotion.ID = uuid.New()
+	query, args, err := QB.Insert("promotions").
+		Columns("id", "code", "description", "vendor_id", "kind", "percent", "amount", "item_id", "buy_quantity", "get_quantity",
+			"min_spend", "currency", "starts_at", "ends_at", "max_uses", "max_uses_per_customer", "active", "created_at", "updated_at").
+		Values(promotion.ID, promotion.Code, promotion.Description, promotion.VendorID, promotion.Kind, promotion.Percent,
+			promotion.Amount, promotion.ItemID, promotion.BuyQuantity, promotion.GetQuantity, promotion.MinSpend, promotion.Currency,
+			promotion.StartsAt, promotion.EndsAt, promotion.MaxUses, promotion.MaxUsesPerCustomer, promotion.Active, time.Now(), time.Now()).
+		Suffix("ON CONFLICT (code) DO NOTHING").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusConflict, "A promotion with this code already exists")
+		return
+	}
+
+	promotion, err = loadPromotion(db, squirrel.Eq{"id": promotion.ID}, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, promotion)
+}
+
+// UpdatePromotion replaces a promotion, orders already placed with it keep
+// the discount they got
+func UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	var req models.PromotionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	scope := promotionScope(r)
+	vendorID := scope
+	if vendorID == nil {
+		vendorID = req.VendorID
+	}
+	promotion, errs, err := promotionFromRequest(db, vendorID, req)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	var taken bool
+	if err := db.Get(&taken, "SELECT EXISTS (SELECT 1 FROM promotions WHERE code = $1 AND id <> $2)", promotion.Code, promotionID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check promotion code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A promotion with this code already exists")
+		return
+	}
+
+	updatePromotion := QB.Update("promotions").
+		Set("code", promotion.Code).
+		Set("description", promotion.Description).
+		Set("vendor_id", promotion.VendorID).
+		Set("kind", promotion.Kind).
+		Set("percent", promotion.Percent).
+		Set("amount", promotion.Amount).
+		Set("item_id", promotion.ItemID).
+		Set("buy_quantity", promotion.BuyQuantity).
+		Set("get_quantity", promotion.GetQuantity).
+		Set("min_spend", promotion.MinSpend).
+		Set("currency", promotion.Currency).
+		Set("starts_at", promotion.StartsAt).
+		Set("ends_at", promotion.EndsAt).
+		Set("max_uses", promotion.MaxUses).
+		Set("max_uses_per_customer", promotion.MaxUsesPerCustomer).
+		Set("active", promotion.Active).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": promotionID})
+	if scope != nil {
+		updatePromotion = updatePromotion.Where(squirrel.Eq{"vendor_id": *scope})
+	}
+	query, args, err := updatePromotion.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	promotion, err = loadPromotion(db, squirrel.Eq{"id": promotionID}, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, promotion)
+}
+
+func DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	deletePromotion := QB.Delete("promotions").Where(squirrel.Eq{"id": promotionID})
+	if vendorID := promotionScope(r); vendorID != nil {
+		deletePromotion = deletePromotion.Where(squirrel.Eq{"vendor_id": *vendorID})
+	}
+	query, args, err := deletePromotion.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete promotion")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Promotion deleted successfully"})
+}
+
+// couponDiscount is what a promotion takes off a cart: the discount of every
+// item line, in the order of the lines, and whether the delivery is free
+type couponDiscount struct {
+	currency     string
+	lines        []models.Money
+	freeDelivery bool
+}
+
+// newCouponDiscount is a discount of nothing on the items
+func newCouponDiscount(items []models.CartItemResponse) couponDiscount {
+	discount := couponDiscount{currency: models.DefaultCurrency, lines: make([]models.Money, len(items))}
+	if len(items) > 0 {
+		discount.currency = items[0].Price.Currency
+	}
+	for i := range discount.lines {
+		discount.lines[i] = models.NewMoney(0, discount.currency)
+	}
+	return discount
+}
+
+// total is the discount on the items
+func (d couponDiscount) total() models.Money {
+	total := models.NewMoney(0, d.currency)
+	for _, line := range d.lines {
+		total = total.Add(line)
+	}
+	return total
+}
+
+// evaluatePromotion checks that the customer can redeem the promotion on the
+// cart items and computes the discount, the message tells why it can't be
+// redeemed. Usage limits are only safe to check with the promotion row locked.
+func evaluatePromotion(q sqlx.Queryer, promotion models.Promotion, customerID uuid.UUID, items []models.CartItemResponse) (couponDiscount, string, error) {
+	discount := newCouponDiscount(items)
+	now := time.Now()
+	switch {
+	case !promotion.Active:
+		return discount, "This coupon is not active", nil
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return discount, "This coupon is not valid yet", nil
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return discount, "This coupon has expired", nil
+	case len(items) == 0:
+		return discount, "Your cart is empty", nil
+	case promotion.VendorID != nil && *promotion.VendorID != items[0].VendorID:
+		return discount, "This coupon is for another vendor", nil
+	case promotion.Currency != nil && *promotion.Currency != discount.currency:
+		return discount, fmt.Sprintf("This coupon only applies to orders in %s", *promotion.Currency), nil
+	}
+
+	// The lines and the minimum spend come from different rows, their
+	// currencies are checked rather than trusted
+	subtotal := models.NewMoney(0, discount.currency)
+	for _, item := range items {
+		var err error
+		if subtotal, err = subtotal.CheckedAdd(item.LineTotal); err != nil {
+			return discount, "", err
+		}
+	}
+	if !promotion.MinSpend.IsZero() {
+		if cmp, err := subtotal.CheckedCmp(promotion.MinSpend); err != nil {
+			return discount, "", err
+		} else if cmp < 0 {
+			return discount, fmt.Sprintf("This coupon needs a subtotal of at least %s %s", promotion.MinSpend, discount.currency), nil
+		}
+	}
+
+	if promotion.MaxUses != nil || promotion.MaxUsesPerCustomer != nil {
+		var uses struct {
+			Total    int `db:"total"`
+			Customer int `db:"customer"`
+		}
+		err := sqlx.Get(q, &uses, `SELECT COUNT(*) AS total, COUNT(*) FILTER (WHERE customer_id = $2) AS customer
+			FROM orders WHERE promotion_id = $1 AND status NOT IN ($3, $4)`, promotion.ID, customerID, models.OrderStatusCancelled, models.OrderStatusPaymentFailed)
+		if err != nil {
+			return discount, "", err
+		}
+		if promotion.MaxUses != nil && uses.Total >= *promotion.MaxUses {
+			return discount, "This coupon has been used up", nil
+		}
+		if promotion.MaxUsesPerCustomer != nil && uses.Customer >= *promotion.MaxUsesPerCustomer {
+			return discount, "You have already used this coupon as many times as allowed", nil
+		}
+	}
+
+	switch promotion.Kind {
+	case models.PromotionPercentage:
+		percent, _ := new(big.Rat).SetString(*promotion.Percent)
+		factor := new(big.Rat).Quo(percent, big.NewRat(100, 1))
+		for i, item := range items {
+			discount.lines[i] = item.LineTotal.MulRat(factor)
+		}
+	case models.PromotionFixed:
+		amount := *promotion.Amount
+		if amount.Cmp(subtotal) > 0 {
+			amount = subtotal
+		}
+		if subtotal.IsZero() {
+			break
+		}
+		// Spread the amount over the lines by their share of the subtotal,
+		// rounding the running sum so the shares add up to the amount
+		running, allocated := models.NewMoney(0, discount.currency), models.NewMoney(0, discount.currency)
+		for i, item := range items {
+			running = running.Add(item.LineTotal)
+			share := amount.MulRatio(running.Amount, subtotal.Amount)
+			discount.lines[i] = share.Sub(allocated)
+			allocated = share
+		}
+	case models.PromotionBuyXGetY:
+		bundle := *promotion.BuyQuantity + *promotion.GetQuantity
+		for i, item := range items {
+			if promotion.ItemID != nil && item.ItemID == *promotion.ItemID {
+				discount.lines[i] = item.Price.Mul(int64(item.Quantity / bundle * *promotion.GetQuantity))
+			}
+		}
+		if discount.total().IsZero() {
+			return discount, fmt.Sprintf("This coupon needs %d of its item in the cart", bundle), nil
+		}
+	case models.PromotionFreeDelivery:
+		discount.freeDelivery = true
+	}
+	return discount, "", nil
+}
+
+// cartCoupon describes the coupon applied to the cart and what it takes off
+// the items, nil when there is none
+func cartCoupon(q sqlx.Queryer, cart models.Cart, items []models.CartItemResponse) (*models.CartCouponResponse, error) {
+	if cart.PromotionID == nil {
+		return nil, nil
+	}
+	promotion, err := loadPromotion(q, squirrel.Eq{"id": *cart.PromotionID}, false)
+	if err != nil {
+		return nil, err
+	}
+	discount, message, err := evaluatePromotion(q, promotion, cart.UserID, items)
+	if err != nil {
+		return nil, err
+	}
+	return &models.CartCouponResponse{
+		Code:         promotion.Code,
+		Description:  promotion.Description,
+		Discount:     discount.total(),
+		FreeDelivery: discount.freeDelivery,
+		Unavailable:  message,
+	}, nil
+}
+
+// ApplyCoupon applies a coupon code to the cart once it can be redeemed on
+// it, it replaces the coupon applied before
+func ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.CouponRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	cart, err := activeCart(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	items, err := cartItems(tx, cart.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	promotion, err := loadPromotion(tx, squirrel.Eq{"code": strings.ToUpper(strings.TrimSpace(req.Code))}, false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Coupon not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	_, message, err := evaluatePromotion(tx, promotion, session.UserID, items)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if message != "" {
+		utils.HandleError(w, http.StatusConflict, message)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE carts SET promotion_id = $1, updated_at = $2 WHERE id = $3", promotion.ID, time.Now(), cart.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to apply coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to apply coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	sendCart(w, session.UserID)
+}
+
+func RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	cart, err := activeCart(db, session.UserID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to load cart")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec("UPDATE carts SET promotion_id = NULL, updated_at = $1 WHERE id = $2", time.Now(), cart.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove coupon")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	sendCart(w, session.UserID)
+}
@@ -0,0 +1,524 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// refundableStatuses are the statuses of orders whose payment was captured,
+// orders that were not accepted yet are cancelled instead
+var refundableStatuses = []string{
+	models.OrderStatusAccepted, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusCompleted,
+}
+
+// orderScope is the vendor whose orders the user handles, nil for admins who
+// handle every order
+func orderScope(r *http.Request) *uuid.UUID {
+	if vendorID := currentVendorID(r); vendorID != uuid.Nil {
+		return &vendorID
+	}
+	return nil
+}
+
+// scopedOrder loads an order of the vendor, or any order without one. With
+// lock set the row stays locked until the transaction ends.
+func scopedOrder(q sqlx.Queryer, vendorID *uuid.UUID, id string, lock bool) (models.Order, error) {
+	if vendorID != nil {
+		return vendorOrder(q, *vendorID, id, lock)
+	}
+	var order models.Order
+	orderID, err := uuid.Parse(id)
+	if err != nil {
+		return order, sql.ErrNoRows
+	}
+	selectOrder := QB.Select(orderColumns...).From("orders").Where(squirrel.Eq{"id": orderID})
+	if lock {
+		selectOrder = selectOrder.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectOrder.ToSql()
+	if err != nil {
+		return order, err
+	}
+	err = sqlx.Get(q, &order, query, args...)
+	return order, err
+}
+
+// orderRefunds lists the refunds of an order with their lines, oldest first
+func orderRefunds(q sqlx.Queryer, orderID uuid.UUID) ([]models.Refund, error) {
+	refunds := []models.Refund{}
+	query, args, err := QB.Select("refunds.id", "order_id", "payment_intent_id", "refunds.status", "reason",
+		moneyColumn("amount", "orders.currency", "amount"), moneyColumn("refunds.tax_amount", "orders.currency", "tax_amount"),
+		moneyColumn("delivery_amount", "orders.currency", "delivery_amount"), moneyColumn("card_amount", "orders.currency", "card_amount"),
+		moneyColumn("cash_amount", "orders.currency", "cash_amount"), moneyColumn("wallet_amount", "orders.currency", "wallet_amount"), "refunded_by", "refunds.created_at").
+		From("refunds").
+		Join("orders ON orders.id = refunds.order_id").
+		Where(squirrel.Eq{"refunds.order_id": orderID}).
+		OrderBy("refunds.created_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlx.Select(q, &refunds, query, args...); err != nil {
+		return nil, err
+	}
+
+	query, args, err = QB.Select("refund_items.refund_id", "refund_items.item_id", "refund_items.quantity",
+		moneyColumn("refund_items.amount", "orders.currency", "amount"), moneyColumn("refund_items.tax_amount", "orders.currency", "tax_amount")).
+		From("refund_items").
+		Join("refunds ON refunds.id = refund_items.refund_id").
+		Join("orders ON orders.id = refunds.order_id").
+		Where(squirrel.Eq{"refunds.order_id": orderID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var items []models.RefundItem
+	if err := sqlx.Select(q, &items, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range refunds {
+		refunds[i].Items = []models.RefundItem{}
+		for _, item := range items {
+			if item.RefundID == refunds[i].ID {
+				refunds[i].Items = append(refunds[i].Items, item)
+			}
+		}
+	}
+	return refunds, nil
+}
+
+// lineShare is the part of what a line charged, and of its tax, that covers
+// its first n units. Refunding units one after the other adds up to the line
+// exactly, the last unit takes the rounding.
+func lineShare(order models.Order, item models.OrderItemResponse, n int) (models.Money, models.Money) {
+	charged := item.Price.Mul(int64(item.Quantity)).Sub(item.Discount)
+	if !order.PricesIncludeTax {
+		charged = charged.Add(item.TaxAmount)
+	}
+	return charged.MulRatio(int64(n), int64(item.Quantity)), item.TaxAmount.MulRatio(int64(n), int64(item.Quantity))
+}
+
+// deliveryCharge is what the order charged for the delivery and the tax of it
+func deliveryCharge(order models.Order) (models.Money, models.Money) {
+	charged := order.DeliveryFee.Sub(order.DeliveryDiscount)
+	if !order.PricesIncludeTax {
+		charged = charged.Add(order.DeliveryTax)
+	}
+	return charged, order.DeliveryTax
+}
+
+// minMoney is the smaller of two amounts of the same currency
+func minMoney(a, b models.Money) models.Money {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+// CreateRefund cancels and refunds lines of an order, by quantity, and
+// possibly its delivery. The money goes back the way it was paid: cash that
+// was not collected yet is no longer due, then what the wallet paid goes back
+// to it, the card is refunded and the rest is handed back in cash. With
+// to_wallet everything paid goes to the customer's wallet instead.
+func CreateRefund(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.RefundRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	errs := utils.FieldErrors{}
+	seen := map[uuid.UUID]bool{}
+	for i, item := range req.Items {
+		if seen[item.ItemID] {
+			errs[fmt.Sprintf("items[%d].item_id", i)] = "is listed twice"
+		}
+		seen[item.ItemID] = true
+	}
+	if req.Full && (len(req.Items) > 0 || req.Delivery) {
+		errs["full"] = "refunds everything, items and delivery are not sent with it"
+	}
+	if !req.Full && len(req.Items) == 0 && !req.Delivery {
+		errs["items"] = "are required unless the delivery or the full order is refunded"
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// The order row stays locked so concurrent refunds can't refund a line twice
+	order, err := scopedOrder(tx, orderScope(r), r.PathValue("id"), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	refundable := false
+	for _, status := range refundableStatuses {
+		refundable = refundable || order.Status == status
+	}
+	if !refundable {
+		utils.HandleError(w, http.StatusConflict, "Only accepted orders are refunded, cancel the order instead")
+		return
+	}
+
+	lines, err := orderItems(tx, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	var deliveryRefunded bool
+	if err := tx.Get(&deliveryRefunded, "SELECT EXISTS (SELECT 1 FROM refunds WHERE order_id = $1 AND delivery_amount > 0)", order.ID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get refunds")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// A full refund takes whatever is left of every line and of the delivery
+	quantities := map[uuid.UUID]int{}
+	for _, item := range req.Items {
+		quantities[item.ItemID] = item.Quantity
+	}
+	if req.Full {
+		for _, line := range lines {
+			if left := line.Quantity - line.RefundedQuantity; left > 0 {
+				quantities[line.ItemID] = left
+			}
+		}
+	}
+
+	zero := models.NewMoney(0, order.Currency)
+	refund := models.Refund{
+		ID:             uuid.New(),
+		OrderID:        order.ID,
+		Reason:         req.Reason,
+		Amount:         zero,
+		TaxAmount:      zero,
+		DeliveryAmount: zero,
+		CardAmount:     zero,
+		CashAmount:     zero,
+		WalletAmount:   zero,
+		Status:         models.RefundRefunded,
+		RefundedBy:     &session.UserID,
+		Items:          []models.RefundItem{},
+		CreatedAt:      time.Now(),
+	}
+	for i, item := range req.Items {
+		found := false
+		for _, line := range lines {
+			if line.ItemID != item.ItemID {
+				continue
+			}
+			found = true
+			if left := line.Quantity - line.RefundedQuantity; item.Quantity > left {
+				errs[fmt.Sprintf("items[%d].quantity", i)] = fmt.Sprintf("must be at most %d, the quantity not refunded yet", left)
+			}
+		}
+		if !found {
+			errs[fmt.Sprintf("items[%d].item_id", i)] = "is not a line of the order"
+		}
+	}
+	if req.Delivery && (deliveryRefunded || order.DeliveryFee.Sub(order.DeliveryDiscount).IsZero()) {
+		errs["delivery"] = "was not charged or was already refunded"
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	for _, line := range lines {
+		quantity := quantities[line.ItemID]
+		if quantity == 0 {
+			continue
+		}
+		chargedBefore, taxBefore := lineShare(order, line, line.RefundedQuantity)
+		chargedAfter, taxAfter := lineShare(order, line, line.RefundedQuantity+quantity)
+		item := models.RefundItem{
+			RefundID:  refund.ID,
+			ItemID:    line.ItemID,
+			Quantity:  quantity,
+			Amount:    chargedAfter.Sub(chargedBefore),
+			TaxAmount: taxAfter.Sub(taxBefore),
+		}
+		refund.Items = append(refund.Items, item)
+		refund.Amount = refund.Amount.Add(item.Amount)
+		refund.TaxAmount = refund.TaxAmount.Add(item.TaxAmount)
+	}
+	if req.Delivery || req.Full && !deliveryRefunded {
+		charged, tax := deliveryCharge(order)
+		refund.DeliveryAmount = charged
+		refund.Amount = refund.Amount.Add(charged)
+		refund.TaxAmount = refund.TaxAmount.Add(tax)
+	}
+	if refund.Amount.IsZero() {
+		utils.HandleError(w, http.StatusConflict, "There is nothing left to refund on this order")
+		return
+	}
+
+	balance, err := orderBalance(tx, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order balance")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Cash that was not collected yet is simply no longer due
+	left := refund.Amount
+	if outstanding := balance.CashOutstanding(); outstanding.Cmp(zero) > 0 {
+		left = left.Sub(minMoney(left, outstanding))
+	}
+
+	// Then the wallet gets back what it paid, or everything paid when the
+	// customer takes the refund as wallet balance
+	walletRefundable := order.WalletPaid.Sub(order.WalletRefunded)
+	if req.ToWallet {
+		walletRefundable = balance.Paid
+	}
+	if walletRefundable.Cmp(zero) > 0 {
+		refund.WalletAmount = minMoney(left, walletRefundable)
+		left = left.Sub(refund.WalletAmount)
+	}
+
+	// Then the card payment, checkout makes one at most, is refunded at the
+	// provider once the refund is committed
+	intents, err := orderPayments(tx, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	operations := []pendingOperation{}
+	for _, intent := range intents {
+		refundable := intent.CapturedAmount.Sub(intent.RefundedAmount)
+		if intent.Status != models.PaymentCaptured || refundable.Cmp(zero) <= 0 || left.IsZero() {
+			continue
+		}
+		refund.CardAmount = minMoney(left, refundable)
+		refund.PaymentIntentID = &intent.ID
+		refund.Status = models.RefundPending
+		left = left.Sub(refund.CardAmount)
+		operations = append(operations, pendingOperation{
+			PaymentOperation: models.PaymentOperation{
+				ID:              uuid.New(),
+				PaymentIntentID: intent.ID,
+				RefundID:        &refund.ID,
+				Kind:            models.PaymentOperationRefund,
+				Amount:          refund.CardAmount,
+				Status:          models.PaymentOperationPending,
+				CreatedAt:       time.Now(),
+			},
+			OrderID:           order.ID,
+			ProviderPaymentID: *intent.ProviderPaymentID,
+		})
+		break
+	}
+
+	// And the rest of the cash collected is handed back
+	refund.CashAmount = minMoney(left, balance.CashReceived)
+	if refund.CashAmount.IsNegative() {
+		refund.CashAmount = zero
+	}
+	waived := refund.Amount.Sub(refund.CardAmount).Sub(refund.WalletAmount)
+
+	query, args, err := QB.Insert("refunds").
+		Columns("id", "order_id", "payment_intent_id", "status", "reason", "amount", "tax_amount", "delivery_amount",
+			"card_amount", "cash_amount", "wallet_amount", "refunded_by", "created_at").
+		Values(refund.ID, refund.OrderID, refund.PaymentIntentID, refund.Status, refund.Reason, refund.Amount, refund.TaxAmount, refund.DeliveryAmount,
+			refund.CardAmount, refund.CashAmount, refund.WalletAmount, refund.RefundedBy, refund.CreatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store refund")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	// The card part is recorded in the ledger once the provider refunded it
+	if err := postRefund(tx, order, refund.ID, zero, refund.CashAmount, refund.WalletAmount); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record refund in the ledger")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if !refund.WalletAmount.IsZero() {
+		if _, err := refundToWallet(tx, order, refund.WalletAmount, refund.ID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to credit wallet")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+	for _, operation := range operations {
+		if message, err := insertPaymentOperation(tx, operation); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to store refund")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		} else if message != "" {
+			utils.HandleError(w, http.StatusConflict, message)
+			return
+		}
+	}
+
+	for _, item := range refund.Items {
+		query, args, err := QB.Insert("refund_items").
+			Columns("refund_id", "item_id", "quantity", "amount", "tax_amount").
+			Values(item.RefundID, item.ItemID, item.Quantity, item.Amount, item.TaxAmount).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to store refund items")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+
+		query, args, err = QB.Update("order_item").
+			Set("refunded_quantity", squirrel.Expr("refunded_quantity + ?", item.Quantity)).
+			Where(squirrel.Eq{"order_id": order.ID, "item_id": item.ItemID}).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to update order items")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+	}
+
+	// What is not refunded on the card or to the wallet came off the cash,
+	// whether it was collected or not
+	order.RefundedTotal = order.RefundedTotal.Add(refund.Amount)
+	order.CashDue = order.CashDue.Sub(minMoney(waived, order.CashDue))
+	order.WalletRefunded = order.WalletRefunded.Add(refund.WalletAmount)
+	order.UpdatedAt = time.Now()
+	query, args, err = QB.Update("orders").
+		Set("refunded_total", order.RefundedTotal).
+		Set("cash_due", order.CashDue).
+		Set("wallet_refunded", order.WalletRefunded).
+		Set("updated_at", order.UpdatedAt).
+		Where(squirrel.Eq{"id": order.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store refund")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// A provider that can't be reached is asked again by settle-payments
+	status := http.StatusCreated
+	if message, err := runPaymentOperations(operations); errors.Is(err, errPaymentProvider) {
+		status = http.StatusAccepted
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	} else if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if message != "" {
+		utils.HandleError(w, http.StatusConflict, message)
+		return
+	}
+
+	order, err = scopedOrder(db, nil, order.ID.String(), false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	items, err := orderItems(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	intents, err = orderPayments(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order payments")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	refunds, err := orderRefunds(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get refunds")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	for _, stored := range refunds {
+		if stored.ID == refund.ID {
+			refund = stored
+		}
+	}
+
+	utils.SendJSONResponse(w, status, models.RefundResponse{
+		Refund: refund,
+		Order:  models.NewOrderResponse(order, items, intents),
+	})
+}
+
+// GetRefunds lists the refunds of an order, oldest first
+func GetRefunds(w http.ResponseWriter, r *http.Request) {
+	order, err := scopedOrder(db, orderScope(r), r.PathValue("id"), false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get order")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	refunds, err := orderRefunds(db, order.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get refunds")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, refunds)
+}
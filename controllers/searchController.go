@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchQuery     = 200
+)
+
+// ts_headline marks matches with control characters so the text around them
+// can be HTML escaped before the <mark> tags are put in
+const (
+	highlightStart   = "\x02"
+	highlightStop    = "\x03"
+	headlineOptions  = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+	vendorSearchText = "setweight(to_tsvector('english', users.name), 'A') || vendors.search_vector"
+)
+
+// highlight turns a ts_headline snippet into escaped HTML with <mark> around matches
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
+
+// searchItems runs the full-text item search, with fuzzy set it matches names
+// by trigram similarity instead
+func searchItems(q string, filters []squirrel.Sqlizer, limit uint64, fuzzy bool) ([]models.ItemSearchResult, error) {
+	selectItems := QB.Select(
+		"items.id",
+		"items.name",
+		"items.description",
+		"COALESCE(items.img, '') AS img",
+		moneyColumn("items.price", "vendors.currency", "price"),
+		"items.vendor_id",
+		"users.name AS vendor_name").
+		Column("ts_headline('english', items.name || ' ' || items.description, query, ?) AS snippet", headlineOptions).
+		From("items").
+		Join("users ON users.id = items.vendor_id").
+		Join("vendors ON vendors.vendor_id = items.vendor_id").
+		CrossJoin("websearch_to_tsquery('english', ?) AS query", q).
+		Where(squirrel.Eq{"items.deleted_at": nil})
+	if fuzzy {
+		selectItems = selectItems.
+			Column("similarity(items.name, ?) AS rank", q).
+			Where("items.name % ?", q)
+	} else {
+		selectItems = selectItems.
+			Column("ts_rank(items.search_vector, query) AS rank").
+			Where("items.search_vector @@ query")
+	}
+	for _, filter := range filters {
+		selectItems = selectItems.Where(filter)
+	}
+
+	query, args, err := selectItems.OrderBy("rank DESC", "items.name").Limit(limit).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	results := []models.ItemSearchResult{}
+	if err := db.Select(&results, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Snippet)
+	}
+	return results, nil
+}
+
+// searchVendors is searchItems for vendors, matching their name, cuisine and description
+func searchVendors(q string, filters []squirrel.Sqlizer, limit uint64, fuzzy bool) ([]models.VendorSearchResult, error) {
+	selectVendors := QB.Select(
+		"users.id",
+		"users.name",
+		"COALESCE(users.img, '') AS img",
+		"vendors.cuisine").
+		Column("ts_headline('english', users.name || ' ' || vendors.cuisine || ' ' || vendors.description, query, ?) AS snippet", headlineOptions).
+		From("users").
+		Join("vendors ON vendors.vendor_id = users.id").
+		CrossJoin("websearch_to_tsquery('english', ?) AS query", q)
+	if fuzzy {
+		selectVendors = selectVendors.
+			Column("similarity(users.name, ?) AS rank", q).
+			Where("users.name % ?", q)
+	} else {
+		selectVendors = selectVendors.
+			Column("ts_rank(" + vendorSearchText + ", query) AS rank").
+			Where("(" + vendorSearchText + ") @@ query")
+	}
+	for _, filter := range filters {
+		selectVendors = selectVendors.Where(filter)
+	}
+
+	query, args, err := selectVendors.OrderBy("rank DESC", "users.name").Limit(limit).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	results := []models.VendorSearchResult{}
+	if err := db.Select(&results, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Snippet)
+	}
+	return results, nil
+}
+
+// Search looks up menu items and vendors matching ?q=. Items can be narrowed
+// with ?min_price= and ?max_price=, which compare prices in each vendor's own
+// currency, both kinds with ?currency= and ?vendor_id=. When the
+// full-text search finds nothing, names are matched by trigram similarity so
+// typos still find something.
+func Search(w http.ResponseWriter, r *http.Request) {
+	errs := utils.FieldErrors{}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		errs["q"] = "is required"
+	} else if utf8.RuneCountInString(q) > maxSearchQuery {
+		errs["q"] = "must be at most 200 characters"
+	}
+	minPrice, message := queryMoney(r, "min_price")
+	if message != "" {
+		errs["min_price"] = message
+	}
+	maxPrice, message := queryMoney(r, "max_price")
+	if message != "" {
+		errs["max_price"] = message
+	}
+	defaultLimit := float64(defaultSearchLimit)
+	limit, message := queryFloat(r, "limit", &defaultLimit, 1, maxSearchLimit)
+	if message != "" {
+		errs["limit"] = message
+	}
+	currency := r.URL.Query().Get("currency")
+	if currencyErrs := utils.Validate(struct {
+		Currency string `json:"currency" validate:"omitempty,currency"`
+	}{currency}); currencyErrs != nil {
+		errs["currency"] = currencyErrs["currency"]
+	}
+	var vendorID uuid.UUID
+	if raw := r.URL.Query().Get("vendor_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			errs["vendor_id"] = "must be a UUID"
+		}
+		vendorID = id
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	var itemFilters, vendorFilters []squirrel.Sqlizer
+	if minPrice != nil {
+		itemFilters = append(itemFilters, squirrel.GtOrEq{"items.price": *minPrice})
+	}
+	if maxPrice != nil {
+		itemFilters = append(itemFilters, squirrel.LtOrEq{"items.price": *maxPrice})
+	}
+	if currency != "" {
+		itemFilters = append(itemFilters, squirrel.Eq{"vendors.currency": currency})
+		vendorFilters = append(vendorFilters, squirrel.Eq{"vendors.currency": currency})
+	}
+	if vendorID != uuid.Nil {
+		itemFilters = append(itemFilters, squirrel.Eq{"items.vendor_id": vendorID})
+		vendorFilters = append(vendorFilters, squirrel.Eq{"users.id": vendorID})
+	}
+
+	response := models.SearchResponse{Query: q}
+	var err error
+	if response.Items, err = searchItems(q, itemFilters, uint64(limit), false); err == nil && len(response.Items) == 0 {
+		response.Items, err = searchItems(q, itemFilters, uint64(limit), true)
+		response.Fuzzy = len(response.Items) > 0
+	}
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to search items")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if response.Vendors, err = searchVendors(q, vendorFilters, uint64(limit), false); err == nil && len(response.Vendors) == 0 {
+		response.Vendors, err = searchVendors(q, vendorFilters, uint64(limit), true)
+		response.Fuzzy = response.Fuzzy || len(response.Vendors) > 0
+	}
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to search vendors")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
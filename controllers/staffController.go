@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/mailer"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const staffInvitationTTL = 72 * time.Hour
+
+// assignableRoles matches the roles a vendor can give its staff: the built-in
+// staff roles and the vendor's own roles, never the owner role
+func assignableRoles(vendorID uuid.UUID) squirrel.Sqlizer {
+	return squirrel.And{
+		squirrel.Eq{"roles.scope": models.ScopeVendor},
+		squirrel.Or{
+			squirrel.And{squirrel.Eq{"roles.vendor_id": nil}, squirrel.NotEq{"roles.id": vendorRoleID}},
+			squirrel.Eq{"roles.vendor_id": vendorID},
+		},
+	}
+}
+
+// roleAssignable reports whether the vendor can give the role to its staff
+func roleAssignable(q sqlx.Queryer, vendorID uuid.UUID, roleID int) (bool, error) {
+	query, args, err := QB.Select("COUNT(*)").
+		From("roles").
+		Where(squirrel.Eq{"roles.id": roleID}).
+		Where(assignableRoles(vendorID)).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	var count int
+	err = sqlx.Get(q, &count, query, args...)
+	return count > 0, err
+}
+
+// setStaffRole replaces the vendor role held by a staff member
+func setStaffRole(tx *sqlx.Tx, userID uuid.UUID, roleID int) error {
+	query, args, err := QB.Delete("user_roles").
+		Where(squirrel.Eq{"user_id": userID}).
+		Where(squirrel.Expr("role_id IN (SELECT id FROM roles WHERE scope = ?)", models.ScopeVendor)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	query, args, err = QB.Insert("user_roles").Columns("user_id", "role_id").Values(userID, roleID).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// InviteStaff emails a single-use invitation to join the vendor with a role
+func InviteStaff(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+	vendorID := currentVendorID(r)
+
+	var req models.InviteStaffRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	if ok, err := roleAssignable(db, vendorID, req.RoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !ok {
+		utils.HandleValidationError(w, utils.FieldErrors{"role_id": "is not a role this vendor can give"})
+		return
+	}
+
+	if taken, err := emailTaken(db, req.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+
+	var vendorName string
+	if err := db.Get(&vendorName, "SELECT name FROM users WHERE id = $1", vendorID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate invitation token")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	invitation := models.StaffInvitation{
+		ID:        uuid.New(),
+		VendorID:  vendorID,
+		RoleID:    req.RoleID,
+		Email:     req.Email,
+		TokenHash: hash,
+		InvitedBy: &session.UserID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(staffInvitationTTL),
+	}
+	query, args, err := QB.Insert("staff_invitations").
+		Columns("id", "vendor_id", "role_id", "email", "token_hash", "invited_by", "created_at", "expires_at").
+		Values(invitation.ID, invitation.VendorID, invitation.RoleID, invitation.Email, invitation.TokenHash, invitation.InvitedBy, invitation.CreatedAt, invitation.ExpiresAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store invitation")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	err = mail.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", vendorName),
+		Body: fmt.Sprintf(
+			"Hello,\n\n%s invited you to join their staff. Use the following token to create your account, it expires in %s:\n\n%s\n\nOr open %s/accept-staff-invitation?token=%s",
+			vendorName, staffInvitationTTL, token, os.Getenv("DOMAIN"), token,
+		),
+	})
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to send invitation email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.StaffInvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		RoleID:    invitation.RoleID,
+		CreatedAt: invitation.CreatedAt,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// AcceptStaffInvitation creates the invited staff account and links it to the vendor
+func AcceptStaffInvitation(w http.ResponseWriter, r *http.Request) {
+	var req models.AcceptInvitationRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the invitation so it cannot be accepted twice
+	var invitation models.StaffInvitation
+	query, args, err := QB.Select("id", "vendor_id", "role_id", "email", "token_hash", "invited_by", "created_at", "expires_at", "accepted_at").
+		From("staff_invitations").
+		Where(squirrel.Eq{"token_hash": utils.HashToken(req.Token), "accepted_at": nil}).
+		Where(squirrel.Gt{"expires_at": time.Now()}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&invitation, query, args...); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid or expired invitation token")
+		return
+	}
+
+	if taken, err := emailTaken(tx, invitation.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+
+	// The role may have been deleted or changed since the invitation was sent
+	if ok, err := roleAssignable(tx, invitation.VendorID, invitation.RoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !ok {
+		utils.HandleError(w, http.StatusConflict, "The role of this invitation no longer exists, ask for a new invitation")
+		return
+	}
+
+	query, args, err = QB.Update("staff_invitations").Set("accepted_at", time.Now()).Where(squirrel.Eq{"id": invitation.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to accept invitation")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The invitation token was delivered to the email, so it is verified
+	now := time.Now()
+	user := models.User{
+		ID:              uuid.New(),
+		Name:            req.Username,
+		Email:           invitation.Email,
+		Phone:           req.Phone,
+		Password:        hashedPassword,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+	query, args, err = QB.Insert("users").
+		Columns("id", "name", "email", "phone", "password", "created_at", "updated_at", "email_verified", "email_verified_at").
+		Values(user.ID, user.Name, user.Email, user.Phone, user.Password, user.CreatedAt, user.UpdatedAt, user.EmailVerified, user.EmailVerifiedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create account")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Insert("vendor_staff").
+		Columns("user_id", "vendor_id", "created_at").
+		Values(user.ID, invitation.VendorID, now).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to join vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := setStaffRole(tx, user.ID, invitation.RoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create account")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewUserResponse(user))
+}
+
+// staffQuery selects the vendor's staff members with their vendor role
+func staffQuery(vendorID uuid.UUID) squirrel.SelectBuilder {
+	return QB.Select("users.id", "users.name", "users.email", "COALESCE(users.phone, '') AS phone", "roles.id AS role_id", "roles.name AS role", "vendor_staff.created_at AS joined_at").
+		From("vendor_staff").
+		Join("users ON users.id = vendor_staff.user_id").
+		Join("user_roles ON user_roles.user_id = users.id").
+		Join("roles ON roles.id = user_roles.role_id AND roles.scope = ?", models.ScopeVendor).
+		Where(squirrel.Eq{"vendor_staff.vendor_id": vendorID})
+}
+
+func GetStaff(w http.ResponseWriter, r *http.Request) {
+	staff := []models.StaffResponse{}
+	query, args, err := staffQuery(currentVendorID(r)).OrderBy("vendor_staff.created_at").ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&staff, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get staff")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, staff)
+}
+
+// UpdateStaffRole gives a staff member another role. Nobody can change their own role.
+func UpdateStaffRole(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+	vendorID := currentVendorID(r)
+
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid staff ID")
+		return
+	}
+	if userID == session.UserID {
+		utils.HandleError(w, http.StatusConflict, "You cannot change your own role")
+		return
+	}
+
+	var req models.StaffRoleRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var member models.VendorStaff
+	if err := tx.Get(&member, "SELECT user_id, vendor_id, created_at FROM vendor_staff WHERE user_id = $1 AND vendor_id = $2 FOR UPDATE", userID, vendorID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Staff member not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get staff member")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if ok, err := roleAssignable(tx, vendorID, req.RoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !ok {
+		utils.HandleValidationError(w, utils.FieldErrors{"role_id": "is not a role this vendor can give"})
+		return
+	}
+
+	if err := setStaffRole(tx, userID, req.RoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	var staff models.StaffResponse
+	query, args, err := staffQuery(vendorID).Where(squirrel.Eq{"users.id": userID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&staff, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get staff member")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, staff)
+}
+
+// RemoveStaff unlinks a staff member from the vendor, drops their vendor role
+// and ends their sessions. The account is kept for the history it is part of.
+func RemoveStaff(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid staff ID")
+		return
+	}
+	if userID == session.UserID {
+		utils.HandleError(w, http.StatusConflict, "You cannot remove yourself")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Delete("vendor_staff").Where(squirrel.Eq{"user_id": userID, "vendor_id": currentVendorID(r)}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove staff member")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Staff member not found")
+		return
+	}
+
+	query, args, err = QB.Delete("user_roles").
+		Where(squirrel.Eq{"user_id": userID}).
+		Where(squirrel.Expr("role_id IN (SELECT id FROM roles WHERE scope = ?)", models.ScopeVendor)).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove staff role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := revokeSessions(tx, userID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to remove staff member")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Staff member removed successfully",
+	})
+}
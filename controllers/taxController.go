@@ -0,0 +1,410 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// taxRatePattern matches the percentages that fit the decimal(7, 4) rate columns
+var taxRatePattern = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,4})?$`)
+
+// vendorTaxes holds what checkout needs to tax the orders of a vendor
+type vendorTaxes struct {
+	inclusive bool
+	rates     map[string]string
+}
+
+// loadVendorTaxes reads the rates of the vendor's jurisdiction, a vendor
+// without one charges no tax
+func loadVendorTaxes(q sqlx.Queryer, vendorID uuid.UUID) (vendorTaxes, error) {
+	taxes := vendorTaxes{rates: map[string]string{}}
+	if err := sqlx.Get(q, &taxes.inclusive, "SELECT prices_include_tax FROM vendors WHERE vendor_id = $1", vendorID); err != nil {
+		return taxes, err
+	}
+
+	query, args, err := QB.Select("tax_rates.category", "trim_scale(tax_rates.rate)::text AS rate").
+		From("tax_rates").
+		Join("vendors ON vendors.tax_jurisdiction_id = tax_rates.jurisdiction_id").
+		Where(squirrel.Eq{"vendors.vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		return taxes, err
+	}
+	rates := []models.TaxRate{}
+	if err := sqlx.Select(q, &rates, query, args...); err != nil {
+		return taxes, err
+	}
+	for _, rate := range rates {
+		taxes.rates[rate.Category] = rate.Rate
+	}
+	return taxes, nil
+}
+
+// tax returns the tax on an amount of the category and the rate charged. With
+// tax-inclusive prices it is the part of the amount above its net value,
+// otherwise it comes on top of the amount.
+func (t vendorTaxes) tax(category string, amount models.Money) (models.Money, string) {
+	rate, ok := t.rates[category]
+	if !ok {
+		rate = "0"
+	}
+	percent, _ := new(big.Rat).SetString(rate)
+	base := big.NewRat(100, 1)
+	if t.inclusive {
+		base.Add(base, percent)
+	}
+	return amount.MulRat(new(big.Rat).Quo(percent, base)), rate
+}
+
+var taxJurisdictionColumns = []string{"id", "code", "name", "created_at", "updated_at"}
+
+// loadTaxRates fills in the rates of the jurisdictions
+func loadTaxRates(q sqlx.Queryer, jurisdictions []models.TaxJurisdiction) error {
+	if len(jurisdictions) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(jurisdictions))
+	for i, jurisdiction := range jurisdictions {
+		ids[i] = jurisdiction.ID
+	}
+	query, args, err := QB.Select("jurisdiction_id", "category", "trim_scale(rate)::text AS rate").
+		From("tax_rates").
+		Where(squirrel.Eq{"jurisdiction_id": ids}).
+		OrderBy("category").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	var rates []struct {
+		JurisdictionID uuid.UUID `db:"jurisdiction_id"`
+		models.TaxRate
+	}
+	if err := sqlx.Select(q, &rates, query, args...); err != nil {
+		return err
+	}
+
+	for i := range jurisdictions {
+		jurisdictions[i].Rates = []models.TaxRate{}
+		for _, rate := range rates {
+			if rate.JurisdictionID == jurisdictions[i].ID {
+				jurisdictions[i].Rates = append(jurisdictions[i].Rates, rate.TaxRate)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTaxRates checks the rate values of a jurisdiction, whose fields
+// utils.Validate already checked, and that each category comes at most once
+func validateTaxRates(rates []models.TaxRateRequest) utils.FieldErrors {
+	errs := utils.FieldErrors{}
+	seen := map[string]bool{}
+	for i, rate := range rates {
+		field := fmt.Sprintf("rates[%d]", i)
+		if percent, ok := new(big.Rat).SetString(rate.Rate.String()); !ok || !taxRatePattern.MatchString(rate.Rate.String()) || percent.Cmp(big.NewRat(100, 1)) > 0 {
+			errs[field+".rate"] = "must be a percentage between 0 and 100 with at most 4 decimals"
+			continue
+		}
+		if seen[rate.Category] {
+			errs[field+".category"] = "is listed twice"
+		}
+		seen[rate.Category] = true
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// saveTaxRates replaces the rates of a jurisdiction
+func saveTaxRates(tx *sqlx.Tx, jurisdictionID uuid.UUID, rates []models.TaxRateRequest) error {
+	query, args, err := QB.Delete("tax_rates").Where(squirrel.Eq{"jurisdiction_id": jurisdictionID}).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		return nil
+	}
+
+	insert := QB.Insert("tax_rates").Columns("jurisdiction_id", "category", "rate")
+	for _, rate := range rates {
+		insert = insert.Values(jurisdictionID, rate.Category, rate.Rate.String())
+	}
+	query, args, err = insert.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// GetTaxJurisdictions lists the tax jurisdictions with their rates
+func GetTaxJurisdictions(w http.ResponseWriter, r *http.Request) {
+	jurisdictions := []models.TaxJurisdiction{}
+	query, args, err := QB.Select(taxJurisdictionColumns...).From("tax_jurisdictions").OrderBy("code").ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&jurisdictions, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get tax jurisdictions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := loadTaxRates(db, jurisdictions); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, jurisdictions)
+}
+
+func CreateTaxJurisdiction(w http.ResponseWriter, r *http.Request) {
+	var req models.TaxJurisdictionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if errs := validateTaxRates(req.Rates); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	jurisdiction := models.TaxJurisdiction{
+		ID:        uuid.New(),
+		Code:      req.Code,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	query, args, err := QB.Insert("tax_jurisdictions").
+		Columns(taxJurisdictionColumns...).
+		Values(jurisdiction.ID, jurisdiction.Code, jurisdiction.Name, jurisdiction.CreatedAt, jurisdiction.UpdatedAt).
+		Suffix("ON CONFLICT (code) DO NOTHING").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create tax jurisdiction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusConflict, "A tax jurisdiction with this code already exists")
+		return
+	}
+	if err := saveTaxRates(tx, jurisdiction.ID, req.Rates); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	jurisdictions := []models.TaxJurisdiction{jurisdiction}
+	if err := loadTaxRates(tx, jurisdictions); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create tax jurisdiction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, jurisdictions[0])
+}
+
+// UpdateTaxJurisdiction replaces the code, name and rates of a jurisdiction,
+// the orders already placed keep the rates they were charged
+func UpdateTaxJurisdiction(w http.ResponseWriter, r *http.Request) {
+	jurisdictionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Tax jurisdiction not found")
+		return
+	}
+
+	var req models.TaxJurisdictionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if errs := validateTaxRates(req.Rates); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.Get(&taken, "SELECT EXISTS (SELECT 1 FROM tax_jurisdictions WHERE code = $1 AND id <> $2)", req.Code, jurisdictionID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check tax jurisdiction code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A tax jurisdiction with this code already exists")
+		return
+	}
+
+	var jurisdiction models.TaxJurisdiction
+	query, args, err := QB.Update("tax_jurisdictions").
+		Set("code", req.Code).
+		Set("name", req.Name).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": jurisdictionID}).
+		Suffix("RETURNING id, code, name, created_at, updated_at").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&jurisdiction, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Tax jurisdiction not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update tax jurisdiction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := saveTaxRates(tx, jurisdiction.ID, req.Rates); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to save tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	jurisdictions := []models.TaxJurisdiction{jurisdiction}
+	if err := loadTaxRates(tx, jurisdictions); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get tax rates")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update tax jurisdiction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, jurisdictions[0])
+}
+
+// DeleteTaxJurisdiction deletes a jurisdiction, its vendors charge no tax
+// until they are assigned another one
+func DeleteTaxJurisdiction(w http.ResponseWriter, r *http.Request) {
+	jurisdictionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Tax jurisdiction not found")
+		return
+	}
+
+	query, args, err := QB.Delete("tax_jurisdictions").Where(squirrel.Eq{"id": jurisdictionID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete tax jurisdiction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Tax jurisdiction not found")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Tax jurisdiction deleted successfully"})
+}
+
+// SetVendorTaxJurisdiction assigns the jurisdiction whose rates the vendor charges
+func SetVendorTaxJurisdiction(w http.ResponseWriter, r *http.Request) {
+	vendorID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	}
+
+	var req models.VendorTaxJurisdictionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.JurisdictionID != nil {
+		var exists bool
+		if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM tax_jurisdictions WHERE id = $1)", *req.JurisdictionID); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get tax jurisdiction")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		} else if !exists {
+			utils.HandleValidationError(w, utils.FieldErrors{"jurisdiction_id": "is not a tax jurisdiction"})
+			return
+		}
+	}
+
+	query, args, err := QB.Update("vendors").
+		Set("tax_jurisdiction_id", req.JurisdictionID).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		utils.HandleError(w, http.StatusNotFound, "Vendor not found")
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{"message": "Tax jurisdiction assigned successfully"})
+}
@@ -0,0 +1,580 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	totpIssuer                = "Restaurant Management System"
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	recoveryCodeCount         = 10
+)
+
+// sendLoginChallenge answers a successful password login of a user with 2FA
+// enabled: instead of a session it hands out a short-lived challenge that is
+// traded for a session at /auth/2fa/verify
+func sendLoginChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate login challenge")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	challenge := models.LoginChallenge{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	query, args, err := QB.Insert("login_challenges").
+		Columns("id", "user_id", "token_hash", "created_at", "expires_at").
+		Values(challenge.ID, challenge.UserID, challenge.TokenHash, challenge.CreatedAt, challenge.ExpiresAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store login challenge")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusAccepted, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         challenge.ExpiresAt,
+	})
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and generates new
+// ones, returned in clear for the only time
+func replaceRecoveryCodes(tx *sqlx.Tx, userID uuid.UUID) ([]string, error) {
+	query, args, err := QB.Delete("recovery_codes").Where(squirrel.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	insert := QB.Insert("recovery_codes").Columns("id", "user_id", "code_hash", "created_at")
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		insert = insert.Values(uuid.New(), userID, utils.HashToken(code), time.Now())
+	}
+
+	query, args, err = insert.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// twoFactorUser loads the 2FA state of a user, locking the row when a
+// transaction is given
+func twoFactorUser(q sqlx.Ext, userID uuid.UUID, lock bool) (models.User, error) {
+	var user models.User
+	selectUser := QB.Select("id", "email", "password", "totp_secret", "totp_enabled", "totp_required", "totp_last_step").
+		From("users").
+		Where(squirrel.Eq{"id": userID})
+	if lock {
+		selectUser = selectUser.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectUser.ToSql()
+	if err != nil {
+		return user, err
+	}
+	err = sqlx.Get(q, &user, query, args...)
+	return user, err
+}
+
+// checkTOTP validates a code for the user and records its time step so the
+// same code cannot be used twice
+func checkTOTP(tx *sqlx.Tx, user models.User, code string) (bool, error) {
+	if user.TOTPSecret == nil {
+		return false, nil
+	}
+	step, ok := utils.ValidateTOTP(*user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false, nil
+	}
+
+	query, args, err := QB.Update("users").Set("totp_last_step", step).Where(squirrel.Eq{"id": user.ID}).ToSql()
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	user, err := twoFactorUser(db, session.UserID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.TOTPEnabled {
+		utils.HandleError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	// The secret only becomes active once a code generated from it is confirmed
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate secret")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err := QB.Update("users").
+		Set("totp_secret", secret).
+		Set("totp_last_step", 0).
+		Where(squirrel.Eq{"id": user.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store secret")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.TwoFactorCodeRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := twoFactorUser(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.TOTPEnabled {
+		utils.HandleError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == nil {
+		utils.HandleError(w, http.StatusBadRequest, "Start the enrollment first")
+		return
+	}
+
+	ok, err := checkTOTP(tx, user, req.Code)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if !ok {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	query, args, err := QB.Update("users").Set("totp_enabled", true).Where(squirrel.Eq{"id": user.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The code was just checked on this session, the user's other sessions
+	// are refused until they log in with a code
+	query, args, err = QB.Update("sessions").Set("two_factor_verified", true).Where(squirrel.Eq{"id": session.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.TwoFactorCodeRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := twoFactorUser(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !user.TOTPEnabled {
+		utils.HandleError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	ok, err := checkTOTP(tx, user, req.Code)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if !ok {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.DisableTwoFactorRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := twoFactorUser(tx, session.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !user.TOTPEnabled {
+		utils.HandleError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	if user.TOTPRequired {
+		utils.HandleError(w, http.StatusForbidden, "Two-factor authentication is required on this account")
+		return
+	}
+	if err := utils.CheckPassword(user.Password, req.Password); err != nil {
+		utils.HandleError(w, http.StatusUnauthorized, "Password is not correct")
+		return
+	}
+
+	ok, err := checkTOTP(tx, user, req.Code)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if !ok {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	query, args, err := QB.Update("users").
+		Set("totp_enabled", false).
+		Set("totp_secret", nil).
+		Where(squirrel.Eq{"id": user.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Delete("recovery_codes").Where(squirrel.Eq{"user_id": user.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to delete recovery codes")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// VerifyLogin trades a login challenge and a valid code for a session
+func VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyLoginRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		utils.HandleValidationError(w, utils.FieldErrors{"code": "send either a code or a recovery_code"})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var challenge models.LoginChallenge
+	query, args, err := QB.Select("id", "user_id", "token_hash", "attempts", "created_at", "expires_at", "used_at").
+		From("login_challenges").
+		Where(squirrel.Eq{"token_hash": utils.HashToken(req.ChallengeToken)}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&challenge, query, args...); err != nil || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) {
+		utils.HandleError(w, http.StatusUnauthorized, "Invalid or expired login challenge")
+		return
+	}
+	if challenge.Attempts >= loginChallengeMaxAttempts {
+		utils.HandleError(w, http.StatusUnauthorized, "Too many attempts, please log in again")
+		return
+	}
+
+	user, err := twoFactorUser(tx, challenge.UserID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusUnauthorized, "Invalid or expired login challenge")
+		return
+	}
+
+	var ok bool
+	if req.Code != "" {
+		ok, err = checkTOTP(tx, user, req.Code)
+	} else {
+		ok, err = useRecoveryCode(tx, user.ID, req.RecoveryCode)
+	}
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check code")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if !ok {
+		// Count the failed attempt and keep it even though the login fails
+		query, args, err = QB.Update("login_challenges").Set("attempts", squirrel.Expr("attempts + 1")).Where(squirrel.Eq{"id": challenge.ID}).ToSql()
+		if err == nil {
+			_, err = tx.Exec(query, args...)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+		}
+		utils.HandleError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	query, args, err = QB.Update("login_challenges").Set("used_at", time.Now()).Where(squirrel.Eq{"id": challenge.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to use login challenge")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	session, err := createSession(tx, user.ID, true)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to log in")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, session)
+}
+
+// useRecoveryCode marks a matching unused recovery code as used
+func useRecoveryCode(tx *sqlx.Tx, userID uuid.UUID, code string) (bool, error) {
+	query, args, err := QB.Update("recovery_codes").
+		Set("used_at", time.Now()).
+		Where(squirrel.Eq{
+			"user_id":   userID,
+			"code_hash": utils.HashToken(utils.NormalizeRecoveryCode(code)),
+			"used_at":   nil,
+		}).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used > 0, err
+}
+
+// RequireTwoFactor lets an admin enforce (or stop enforcing) 2FA on an account
+func RequireTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req models.RequireTwoFactorRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query, args, err := QB.Update("users").
+		Set("totp_required", req.Required).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update user")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	message := "Two-factor authentication is no longer required for this user"
+	if req.Required {
+		message = "Two-factor authentication is now required for this user"
+	}
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": message,
+	})
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"resturant/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+var (
+	loginColumns     = []string{"id", "name", "email", "password", "img", "phone", "created_at", "updated_at", "email_verified", "totp_enabled"}
+	twoFactorColumns = []string{"id", "email", "password", "totp_secret", "totp_enabled", "totp_required", "totp_last_step"}
+	challengeColumns = []string{"id", "user_id", "token_hash", "attempts", "created_at", "expires_at", "used_at"}
+	sessionColumns   = []string{"id", "user_id", "token_hash", "created_at", "expires_at", "revoked_at", "two_factor_verified", "totp_enabled"}
+)
+
+func jsonRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestLoginSendsAChallengeWhenTwoFactorIsEnabled(t *testing.T) {
+	hash, err := utils.HashPassword("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+
+	tests := []struct {
+		name        string
+		totpEnabled bool
+		statement   string
+		status      int
+		field       string
+	}{
+		{"2FA enabled", true, "INSERT INTO login_challenges", http.StatusAccepted, "challenge_token"},
+		{"2FA disabled", false, "INSERT INTO sessions", http.StatusOK, "token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t)
+			f.expect("FROM users").returns(loginColumns, []driver.Value{
+				userID.String(), "Admin", "admin@example.com", hash, "", "", time.Now(), time.Now(), true, tt.totpEnabled,
+			})
+			f.expect(tt.statement)
+
+			w := httptest.NewRecorder()
+			Login(w, jsonRequest(http.MethodPost, "/login", `{"email":"admin@example.com","password":"Password1"}`))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if token, _ := body[tt.field].(string); token == "" {
+				t.Errorf("response %s has no %s", w.Body, tt.field)
+			}
+			if tt.totpEnabled && body["token"] != nil {
+				t.Errorf("response %s hands out a session before the second factor", w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireAuthRefusesSessionsWithoutTheSecondFactor(t *testing.T) {
+	tests := []struct {
+		name              string
+		totpEnabled       bool
+		twoFactorVerified bool
+		status            int
+	}{
+		{"2FA disabled", false, false, http.StatusNoContent},
+		{"2FA enabled and verified", true, true, http.StatusNoContent},
+		{"2FA enabled without a code", true, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t)
+			f.expect("FROM sessions JOIN users").returns(sessionColumns, []driver.Value{
+				uuid.NewString(), uuid.NewString(), utils.HashToken("token"), time.Now(), time.Now().Add(time.Hour), nil, tt.twoFactorVerified, tt.totpEnabled,
+			})
+
+			handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			r.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestVerifyLogin(t *testing.T) {
+	userID := uuid.New()
+	now := time.Now()
+	currentCode, err := utils.TOTPCode(testTOTPSecret, utils.TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := func(attempts int64, expiresAt time.Time, usedAt any) []driver.Value {
+		return []driver.Value{uuid.NewString(), userID.String(), utils.HashToken("challenge"), attempts, now, expiresAt, usedAt}
+	}
+	user := func(lastStep int64) []driver.Value {
+		return []driver.Value{userID.String(), "admin@example.com", "", testTOTPSecret, true, false, lastStep}
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		script func(f *fakeDB)
+		status int
+	}{
+		{"expired challenge", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(-time.Second), nil))
+		}, http.StatusUnauthorized},
+		{"used challenge", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(time.Minute), now))
+		}, http.StatusUnauthorized},
+		{"unknown challenge", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns)
+		}, http.StatusUnauthorized},
+		{"too many attempts", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(loginChallengeMaxAttempts, now.Add(time.Minute), nil))
+		}, http.StatusUnauthorized},
+		{"valid code", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(time.Minute), nil))
+			f.expect("FROM users").returns(twoFactorColumns, user(0))
+			f.expect("UPDATE users SET totp_last_step")
+			f.expect("UPDATE login_challenges SET used_at")
+			f.expect("INSERT INTO sessions")
+		}, http.StatusOK},
+		{"replayed code", `{"challenge_token":"challenge","code":"` + currentCode + `"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(time.Minute), nil))
+			f.expect("FROM users").returns(twoFactorColumns, user(utils.TOTPStep(now)))
+			f.expect("UPDATE login_challenges SET attempts")
+		}, http.StatusUnauthorized},
+		{"recovery code", `{"challenge_token":"challenge","recovery_code":"ABCDE ABCDE"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(time.Minute), nil))
+			f.expect("FROM users").returns(twoFactorColumns, user(0))
+			f.expect("UPDATE recovery_codes SET used_at").affects(1)
+			f.expect("UPDATE login_challenges SET used_at")
+			f.expect("INSERT INTO sessions")
+		}, http.StatusOK},
+		{"used recovery code", `{"challenge_token":"challenge","recovery_code":"abcde-abcde"}`, func(f *fakeDB) {
+			f.expect("FROM login_challenges").returns(challengeColumns, challenge(0, now.Add(time.Minute), nil))
+			f.expect("FROM users").returns(twoFactorColumns, user(0))
+			f.expect("UPDATE recovery_codes SET used_at").affects(0)
+			f.expect("UPDATE login_challenges SET attempts")
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t)
+			tt.script(f)
+
+			w := httptest.NewRecorder()
+			VerifyLogin(w, jsonRequest(http.MethodPost, "/auth/2fa/verify", tt.body))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestVerifyLoginStoresAVerifiedSession(t *testing.T) {
+	userID := uuid.New()
+	now := time.Now()
+
+	f := useFakeDB(t)
+	f.expect("FROM login_challenges").returns(challengeColumns, []driver.Value{
+		uuid.NewString(), userID.String(), utils.HashToken("challenge"), int64(0), now, now.Add(time.Minute), nil,
+	})
+	f.expect("FROM users").returns(twoFactorColumns, []driver.Value{
+		userID.String(), "admin@example.com", "", testTOTPSecret, true, false, int64(0),
+	})
+	recovery := f.expect("UPDATE recovery_codes SET used_at").affects(1)
+	f.expect("UPDATE login_challenges SET used_at")
+	insert := f.expect("INSERT INTO sessions")
+
+	w := httptest.NewRecorder()
+	VerifyLogin(w, jsonRequest(http.MethodPost, "/auth/2fa/verify", `{"challenge_token":"challenge","recovery_code":" ABCDE-abcde "}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if f.commits != 1 {
+		t.Errorf("commits = %d, want 1", f.commits)
+	}
+	// The code is looked up normalized and only while unused
+	if !containsArg(recovery.args, utils.HashToken("abcde-abcde")) {
+		t.Errorf("recovery code statement args = %v, want the hash of the normalized code", recovery.args)
+	}
+	if got := insert.args[len(insert.args)-1]; got != true {
+		t.Errorf("session two_factor_verified = %v, want true", got)
+	}
+}
+
+func containsArg(args []driver.Value, want any) bool {
+	for _, arg := range args {
+		if arg == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"resturant/mailer"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxApplicationDocuments caps the files attached to one vendor application
+const maxApplicationDocuments = 10
+
+var vendorApplicationColumns = []string{
+	"id", "name", "email", "phone", "password", "description", "address", "cuisine", "logo",
+	"status", "rejection_reason", "reviewed_by", "reviewed_at", "vendor_id", "created_at",
+}
+
+// ApplyAsVendor stores the application of a prospective vendor with its logo
+// ("img") and supporting documents ("documents", repeatable) for an admin to review
+func ApplyAsVendor(w http.ResponseWriter, r *http.Request) {
+	var req models.VendorApplicationRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	var documents []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		documents = r.MultipartForm.File["documents"]
+	}
+	if len(documents) > maxApplicationDocuments {
+		utils.HandleValidationError(w, utils.FieldErrors{"documents": fmt.Sprintf("must be at most %d files", maxApplicationDocuments)})
+		return
+	}
+
+	if taken, err := emailTaken(db, req.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+	var pending bool
+	if err := db.Get(&pending, "SELECT EXISTS (SELECT 1 FROM vendor_applications WHERE email = $1 AND status = $2)", req.Email, models.ApplicationStatusPending); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check applications")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if pending {
+		utils.HandleError(w, http.StatusConflict, "An application for this email is already being reviewed")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to hash password")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	application := models.VendorApplication{
+		ID:          uuid.New(),
+		Name:        req.Username,
+		Email:       req.Email,
+		Phone:       req.Phone,
+		Password:    hashedPassword,
+		Description: req.Description,
+		Address:     req.Address,
+		Cuisine:     req.Cuisine,
+		Status:      models.ApplicationStatusPending,
+		CreatedAt:   time.Now(),
+	}
+
+	// Handle the logo upload (optional), it becomes the vendor image once approved
+	file, fileHeader, err := r.FormFile("img")
+	if err == nil {
+		defer file.Close()
+
+		imgPath, err := utils.SaveImageFile(file, "vendors", fileHeader.Filename)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		// Convert backslashes to forward slashes for URI compatibility
+		application.Logo = fmt.Sprintf("http://localhost:8000/%s", strings.ReplaceAll(imgPath, "\\", "/"))
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Insert("vendor_applications").
+		Columns("id", "name", "email", "phone", "password", "description", "address", "cuisine", "logo", "status", "created_at").
+		Values(application.ID, application.Name, application.Email, application.Phone, application.Password, application.Description, application.Address, application.Cuisine, application.Logo, application.Status, application.CreatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Documents are kept out of the public uploads directory
+	stored := []models.VendorApplicationDocument{}
+	for _, document := range documents {
+		path, err := saveDocument(document)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to save document")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		doc := models.VendorApplicationDocument{
+			ID:            uuid.New(),
+			ApplicationID: application.ID,
+			Filename:      filepath.Base(document.Filename),
+			Path:          path,
+			CreatedAt:     time.Now(),
+		}
+		query, args, err := QB.Insert("vendor_application_documents").
+			Columns("id", "application_id", "filename", "path", "created_at").
+			Values(doc.ID, doc.ApplicationID, doc.Filename, doc.Path, doc.CreatedAt).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to store document")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		stored = append(stored, doc)
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to store application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.NewVendorApplicationResponse(application, stored))
+}
+
+// saveDocument stores an uploaded application document under storage/
+func saveDocument(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return utils.SavePrivateFile(file, "vendor_documents", header.Filename)
+}
+
+// getVendorApplication loads an application, with lock set the row stays
+// locked until the transaction ends
+func getVendorApplication(q sqlx.Queryer, id string, lock bool) (models.VendorApplication, error) {
+	var application models.VendorApplication
+	applicationID, err := uuid.Parse(id)
+	if err != nil {
+		return application, sql.ErrNoRows
+	}
+	selectApplication := QB.Select(vendorApplicationColumns...).From("vendor_applications").Where(squirrel.Eq{"id": applicationID})
+	if lock {
+		selectApplication = selectApplication.Suffix("FOR UPDATE")
+	}
+	query, args, err := selectApplication.ToSql()
+	if err != nil {
+		return application, err
+	}
+	err = sqlx.Get(q, &application, query, args...)
+	return application, err
+}
+
+func applicationDocuments(q sqlx.Queryer, applicationID uuid.UUID) ([]models.VendorApplicationDocument, error) {
+	documents := []models.VendorApplicationDocument{}
+	query, args, err := QB.Select("id", "application_id", "filename", "path", "created_at").
+		From("vendor_application_documents").
+		Where(squirrel.Eq{"application_id": applicationID}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	err = sqlx.Select(q, &documents, query, args...)
+	return documents, err
+}
+
+// GetVendorApplications lists applications, oldest first so they are reviewed
+// in order, filtered with ?status= (pending by default)
+func GetVendorApplications(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ApplicationStatusPending
+	}
+
+	var applications []models.VendorApplication
+	query, args, err := QB.Select(vendorApplicationColumns...).
+		From("vendor_applications").
+		Where(squirrel.Eq{"status": status}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Select(&applications, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get applications")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	responses := make([]models.VendorApplicationResponse, 0, len(applications))
+	for _, application := range applications {
+		documents, err := applicationDocuments(db, application.ID)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get documents")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		responses = append(responses, models.NewVendorApplicationResponse(application, documents))
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, responses)
+}
+
+func GetVendorApplication(w http.ResponseWriter, r *http.Request) {
+	application, err := getVendorApplication(db, r.PathValue("id"), false)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Application not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	documents, err := applicationDocuments(db, application.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get documents")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorApplicationResponse(application, documents))
+}
+
+// GetVendorApplicationDocument downloads one of the documents of an application
+func GetVendorApplicationDocument(w http.ResponseWriter, r *http.Request) {
+	var document models.VendorApplicationDocument
+	err := db.Get(&document,
+		"SELECT id, application_id, filename, path, created_at FROM vendor_application_documents WHERE id::text = $1 AND application_id::text = $2",
+		r.PathValue("document_id"), r.PathValue("id"),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Document not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get document")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.Filename))
+	http.ServeFile(w, r, document.Path)
+}
+
+// ApproveVendorApplication creates the vendor account from a pending application
+// and emails the applicant, who then verifies their email and logs in at /vendor/login
+func ApproveVendorApplication(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	application, err := getVendorApplication(tx, r.PathValue("id"), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Application not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if application.Status != models.ApplicationStatusPending {
+		utils.HandleError(w, http.StatusConflict, "The application was already "+application.Status)
+		return
+	}
+	if taken, err := emailTaken(tx, application.Email); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if taken {
+		utils.HandleError(w, http.StatusConflict, "A user with this email already exists")
+		return
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:        uuid.New(),
+		Name:      application.Name,
+		Email:     application.Email,
+		Phone:     application.Phone,
+		Password:  application.Password,
+		Img:       application.Logo,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	query, args, err := QB.Insert("users").
+		Columns("id", "name", "email", "phone", "password", "img", "created_at", "updated_at").
+		Values(user.ID, user.Name, user.Email, user.Phone, user.Password, user.Img, user.CreatedAt, user.UpdatedAt).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create vendor account")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Insert("vendors").
+		Columns("vendor_id", "description", "address", "cuisine", "updated_at").
+		Values(user.ID, application.Description, application.Address, application.Cuisine, now).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create vendor")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Insert("user_roles").Columns("user_id", "role_id").Values(user.ID, vendorRoleID).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to assign vendor role")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	application.Status = models.ApplicationStatusApproved
+	application.ReviewedBy = &session.UserID
+	application.ReviewedAt = &now
+	application.VendorID = &user.ID
+	query, args, err = QB.Update("vendor_applications").
+		Set("status", application.Status).
+		Set("reviewed_by", application.ReviewedBy).
+		Set("reviewed_at", application.ReviewedAt).
+		Set("vendor_id", application.VendorID).
+		Where(squirrel.Eq{"id": application.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to approve application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	documents, err := applicationDocuments(tx, application.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get documents")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to approve application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The account exists at this point, failing emails are only logged
+	err = mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your vendor application was approved",
+		Body:    fmt.Sprintf("Hello %s,\n\nYour application was approved. Confirm your email address with the message we just sent, then log in as a vendor with the password you chose when applying.", user.Name),
+	})
+	if err != nil {
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	}
+	if err := sendEmailVerification(user); err != nil {
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorApplicationResponse(application, documents))
+}
+
+// RejectVendorApplication closes a pending application and emails the reason to the applicant
+func RejectVendorApplication(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.RejectVendorApplicationRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	application, err := getVendorApplication(tx, r.PathValue("id"), true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.HandleError(w, http.StatusNotFound, "Application not found")
+			return
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if application.Status != models.ApplicationStatusPending {
+		utils.HandleError(w, http.StatusConflict, "The application was already "+application.Status)
+		return
+	}
+
+	now := time.Now()
+	application.Status = models.ApplicationStatusRejected
+	application.RejectionReason = &req.Reason
+	application.ReviewedBy = &session.UserID
+	application.ReviewedAt = &now
+	query, args, err := QB.Update("vendor_applications").
+		Set("status", application.Status).
+		Set("rejection_reason", application.RejectionReason).
+		Set("reviewed_by", application.ReviewedBy).
+		Set("reviewed_at", application.ReviewedAt).
+		Where(squirrel.Eq{"id": application.ID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to reject application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	documents, err := applicationDocuments(tx, application.ID)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get documents")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to reject application")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	err = mail.Send(mailer.Message{
+		To:      application.Email,
+		Subject: "Your vendor application was not approved",
+		Body:    fmt.Sprintf("Hello %s,\n\nYour application was not approved for the following reason:\n\n%s\n\nYou are welcome to apply again once this is addressed.", application.Name, req.Reason),
+	})
+	if err != nil {
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorApplicationResponse(application, documents))
+}
@@ -1 +1,416 @@
 package controllers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/models"
+	"resturant/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+func VendorLogin(w http.ResponseWriter, r *http.Request) {
+	// Decode the JSON or form body
+	var req models.LoginRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	// Query to check if the user exists and owns or works for a vendor. Both
+	// joins match at most one row, an owner who is also listed as staff
+	// elsewhere logs in to the vendor they own.
+	var user struct {
+		models.User
+		VendorID uuid.UUID `db:"vendor_id"`
+	}
+	query, args, err := QB.Select("users.id", "users.name", "users.email", "users.password", "users.img", "users.phone", "users.created_at", "users.updated_at", "users.email_verified", "users.totp_enabled", "users.totp_required").
+		Column("COALESCE(vendors.vendor_id, vendor_staff.vendor_id) AS vendor_id").
+		From("users").
+		LeftJoin("vendors ON vendors.vendor_id = users.id").
+		LeftJoin("vendor_staff ON vendor_staff.user_id = users.id").
+		Where(squirrel.Eq{"users.email": req.Email}).
+		Where(squirrel.Or{squirrel.NotEq{"vendors.vendor_id": nil}, squirrel.NotEq{"vendor_staff.vendor_id": nil}}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Internal server error")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&user, query, args...); err != nil {
+		utils.HandleError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	// Vendors added by an admin have no password until they set one through /auth/forgot-password
+	if err := utils.CheckPassword(user.Password, req.Password); err != nil {
+		utils.HandleError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	// With 2FA enabled the session is only created once the code is verified
+	if user.TOTPEnabled {
+		sendLoginChallenge(w, user.ID)
+		return
+	}
+
+	session, err := createSession(db, user.ID, false)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create session")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.VendorLoginResponse{
+		UserResponse:                models.NewUserResponse(user.User),
+		VendorID:                    user.VendorID,
+		SessionResponse:             session,
+		TwoFactorEnrollmentRequired: user.TOTPRequired,
+	})
+}
+
+// RequireVendorMember resolves the vendor the authenticated user owns or works
+// for and makes it available to handlers through currentVendorID. It must run after RequireAuth.
+func RequireVendorMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := currentSession(r).UserID
+		var vendorID uuid.UUID
+		// The vendor the user owns comes first, as at login
+		query, args, err := QB.Select("COALESCE(vendors.vendor_id, vendor_staff.vendor_id) AS vendor_id").
+			From("users").
+			LeftJoin("vendors ON vendors.vendor_id = users.id").
+			LeftJoin("vendor_staff ON vendor_staff.user_id = users.id").
+			Where(squirrel.Eq{"users.id": userID}).
+			Where(squirrel.Or{squirrel.NotEq{"vendors.vendor_id": nil}, squirrel.NotEq{"vendor_staff.vendor_id": nil}}).
+			ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Internal server error")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := db.Get(&vendorID, query, args...); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				utils.HandleError(w, http.StatusForbidden, "You do not belong to a vendor")
+				return
+			}
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), vendorContextKey, vendorID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentVendorID returns the vendor resolved by RequireVendorMember
+func currentVendorID(r *http.Request) uuid.UUID {
+	vendorID, _ := r.Context().Value(vendorContextKey).(uuid.UUID)
+	return vendorID
+}
+
+// selectVendors selects the profile of vendors by joining the users and vendors tables
+func selectVendors() squirrel.SelectBuilder {
+	return QB.Select(
+		"users.id",
+		"users.name",
+		"users.email",
+		"COALESCE(users.phone, '') AS phone",
+		"COALESCE(users.img, '') AS img",
+		"users.created_at",
+		"vendors.description",
+		"vendors.address",
+		"vendors.cuisine",
+		"vendors.latitude",
+		"vendors.longitude",
+		"vendors.time_zone",
+		"vendors.currency",
+		"vendors.tax_jurisdiction_id",
+		"vendors.prices_include_tax",
+		vendorOpenNow+" AS is_open_now").
+		From("users").
+		Join("vendors ON users.id = vendors.vendor_id")
+}
+
+// GetVendorProfile returns the profile of the vendor the user works for
+func GetVendorProfile(w http.ResponseWriter, r *http.Request) {
+	var vendor models.Vendor
+	query, args, err := selectVendors().Where(squirrel.Eq{"users.id": currentVendorID(r)}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&vendor, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor profile")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorResponse(vendor))
+}
+
+// UpdateVendorProfile lets an approved vendor edit its own profile, only the
+// fields sent are changed
+func UpdateVendorProfile(w http.ResponseWriter, r *http.Request) {
+	vendorID := currentVendorID(r)
+
+	// Decode the JSON or multipart body (the logo can only be sent as multipart)
+	var req models.UpdateVendorProfileRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		utils.HandleValidationError(w, utils.FieldErrors{"location": "latitude and longitude must be sent together"})
+		return
+	}
+
+	var vendor models.Vendor
+	query, args, err := selectVendors().Where(squirrel.Eq{"users.id": vendorID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&vendor, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get vendor profile")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// Handle the logo upload (optional)
+	file, fileHeader, err := r.FormFile("img")
+	if err == nil {
+		defer file.Close()
+
+		imgPath, err := utils.SaveImageFile(file, "vendors", fileHeader.Filename)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to save image")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		// Delete the old image from the uploads directory (if present)
+		if vendor.Img != "" {
+			oldImagePath := strings.ReplaceAll(vendor.Img, "http://localhost:8000/", "") // Strip base URL
+			if err := os.Remove(oldImagePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Println(utils.ErrorWithTrace(err, err.Error()))
+			}
+		}
+		// Convert backslashes to forward slashes for URI compatibility
+		vendor.Img = fmt.Sprintf("http://localhost:8000/%s", strings.ReplaceAll(imgPath, "\\", "/"))
+	}
+	if req.Name != "" {
+		vendor.Name = req.Name
+	}
+	if req.Description != "" {
+		vendor.Description = req.Description
+	}
+	if req.Phone != "" {
+		vendor.Phone = req.Phone
+	}
+	if req.Address != "" {
+		vendor.Address = req.Address
+	}
+	if req.Cuisine != "" {
+		vendor.Cuisine = req.Cuisine
+	}
+	if req.Latitude != nil {
+		vendor.Latitude, vendor.Longitude = req.Latitude, req.Longitude
+	}
+	if req.PricesIncludeTax != nil {
+		vendor.PricesIncludeTax = *req.PricesIncludeTax
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	query, args, err = QB.Update("users").
+		Set("name", vendor.Name).
+		Set("phone", vendor.Phone).
+		Set("img", vendor.Img).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": vendorID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor profile")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Update("vendors").
+		Set("description", vendor.Description).
+		Set("address", vendor.Address).
+		Set("cuisine", vendor.Cuisine).
+		Set("latitude", vendor.Latitude).
+		Set("longitude", vendor.Longitude).
+		Set("prices_include_tax", vendor.PricesIncludeTax).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"vendor_id": vendorID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor profile")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to update vendor profile")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, models.NewVendorResponse(vendor))
+}
+
+const (
+	earthRadiusKm       = 6371.0
+	defaultNearbyRadius = 5.0
+	maxNearbyRadius     = 50.0
+)
+
+// haversineKm is the great-circle distance in km between the vendor and the
+// point at lat, lng. LEAST guards ASIN against rounding just above 1.
+func haversineKm(lat, lng float64) squirrel.Sqlizer {
+	return squirrel.Expr(
+		"? * 2 * ASIN(LEAST(1, SQRT("+
+			"POWER(SIN(RADIANS(vendors.latitude - ?) / 2), 2) + "+
+			"COS(RADIANS(?)) * COS(RADIANS(vendors.latitude)) * POWER(SIN(RADIANS(vendors.longitude - ?) / 2), 2))))",
+		earthRadiusKm, lat, lat, lng,
+	)
+}
+
+// queryFloat reads a float query parameter, def is used when it is missing
+func queryFloat(r *http.Request, name string, def *float64, min, max float64) (float64, string) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		if def == nil {
+			return 0, "is required"
+		}
+		return *def, ""
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, "must be a number"
+	}
+	if value < min || value > max {
+		return 0, fmt.Sprintf("must be between %g and %g", min, max)
+	}
+	return value, ""
+}
+
+// queryMoney reads an amount query parameter, it is nil when missing and not
+// in a currency yet otherwise
+func queryMoney(r *http.Request, name string) (*models.Money, string) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, ""
+	}
+	value, err := models.ParseMoney(raw, "")
+	if err != nil {
+		return nil, "must be an amount such as 12.50"
+	}
+	if value.IsNegative() {
+		return nil, "must be at least 0"
+	}
+	return &value, ""
+}
+
+// GetNearbyVendors lists the vendors within ?radius= km (5 by default) of
+// ?lat= and ?lng=, closest first
+func GetNearbyVendors(w http.ResponseWriter, r *http.Request) {
+	errs := utils.FieldErrors{}
+	lat, message := queryFloat(r, "lat", nil, -90, 90)
+	if message != "" {
+		errs["lat"] = message
+	}
+	lng, message := queryFloat(r, "lng", nil, -180, 180)
+	if message != "" {
+		errs["lng"] = message
+	}
+	defaultRadius := defaultNearbyRadius
+	radius, message := queryFloat(r, "radius", &defaultRadius, 0, maxNearbyRadius)
+	if message != "" {
+		errs["radius"] = message
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	distance := haversineKm(lat, lng)
+	distanceSQL, distanceArgs, err := distance.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The latitude band (one degree is about 111 km) lets the location index
+	// skip most vendors before the distance is computed
+	band := radius / 111.0
+	query, args, err := selectVendors().
+		Column(squirrel.Alias(distance, "distance_km")).
+		Where(squirrel.NotEq{"vendors.latitude": nil}).
+		Where("vendors.latitude BETWEEN ? AND ?", lat-band, lat+band).
+		Where(squirrel.Expr(distanceSQL+" <= ?", append(distanceArgs, radius)...)).
+		OrderBy("distance_km").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	var vendors []struct {
+		models.Vendor
+		DistanceKm float64 `db:"distance_km"`
+	}
+	if err := db.Select(&vendors, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to fetch vendors")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	responses := make([]models.NearbyVendorResponse, 0, len(vendors))
+	for _, vendor := range vendors {
+		responses = append(responses, models.NearbyVendorResponse{
+			VendorResponse: models.NewVendorResponse(vendor.Vendor),
+			DistanceKm:     vendor.DistanceKm,
+		})
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, responses)
+}
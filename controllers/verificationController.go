@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"resturant/mailer"
+	"resturant/models"
+	"resturant/utils"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	// A new verification email can be asked for once per interval and at most
+	// verificationDailyLimit times a day
+	verificationResendInterval = time.Minute
+	verificationDailyLimit     = 5
+)
+
+// requireVerifiedEmailForCheckout blocks checkout for customers who did not confirm their email
+var requireVerifiedEmailForCheckout = true
+
+func SetCheckoutPolicy(requireVerifiedEmail bool) {
+	requireVerifiedEmailForCheckout = requireVerifiedEmail
+}
+
+// sendEmailVerification stores a new verification token for the user and emails it
+func sendEmailVerification(user models.User) error {
+	token, hash, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	query, args, err := QB.Insert("email_verifications").
+		Columns("id", "user_id", "token_hash", "created_at", "expires_at").
+		Values(verification.ID, verification.UserID, verification.TokenHash, verification.CreatedAt, verification.ExpiresAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		return err
+	}
+
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse the following token to confirm your email address, it expires in %s:\n\n%s\n\nOr open %s/verify-email?token=%s",
+			user.Name, emailVerificationTTL, token, os.Getenv("DOMAIN"), token,
+		),
+	})
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var verification models.EmailVerification
+	query, args, err := QB.Select("id", "user_id", "token_hash", "created_at", "expires_at", "used_at").
+		From("email_verifications").
+		Where(squirrel.Eq{"token_hash": utils.HashToken(req.Token), "used_at": nil}).
+		Where(squirrel.Gt{"expires_at": time.Now()}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := tx.Get(&verification, query, args...); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+
+	now := time.Now()
+	query, args, err = QB.Update("email_verifications").Set("used_at", now).Where(squirrel.Eq{"id": verification.ID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to use verification token")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	query, args, err = QB.Update("users").
+		Set("email_verified", true).
+		Set("email_verified_at", now).
+		Where(squirrel.Eq{"id": verification.UserID}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to verify email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to verify email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Email verified successfully",
+	})
+}
+
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var user models.User
+	query, args, err := QB.Select("id", "name", "email", "email_verified").From("users").Where(squirrel.Eq{"id": session.UserID}).ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&user, query, args...); err != nil {
+		utils.HandleError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.EmailVerified {
+		utils.HandleError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	// Throttle on the verification emails sent during the last day
+	var recent struct {
+		Count  int        `db:"count"`
+		LastAt *time.Time `db:"last_at"`
+	}
+	query, args, err = QB.Select("COUNT(*) AS count", "MAX(created_at) AS last_at").
+		From("email_verifications").
+		Where(squirrel.Eq{"user_id": user.ID}).
+		Where(squirrel.Gt{"created_at": time.Now().Add(-24 * time.Hour)}).
+		ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if err := db.Get(&recent, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to check previous verification emails")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if recent.Count >= verificationDailyLimit {
+		w.Header().Set("Retry-After", strconv.Itoa(int((24 * time.Hour).Seconds())))
+		utils.HandleError(w, http.StatusTooManyRequests, "Too many verification emails sent today, try again tomorrow")
+		return
+	}
+	if recent.LastAt != nil {
+		if wait := time.Until(recent.LastAt.Add(verificationResendInterval)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			utils.HandleError(w, http.StatusTooManyRequests, "A verification email was just sent, please wait before asking again")
+			return
+		}
+	}
+
+	if err := sendEmailVerification(user); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to send verification email")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Verification email sent",
+	})
+}
+
+// RequireVerifiedEmail blocks unverified users when the checkout policy asks
+// for it, it must run after RequireAuth
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireVerifiedEmailForCheckout {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var verified bool
+		query, args, err := QB.Select("email_verified").From("users").Where(squirrel.Eq{"id": currentSession(r).UserID}).ToSql()
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if err := db.Get(&verified, query, args...); err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to check email verification")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		if !verified {
+			utils.HandleError(w, http.StatusForbidden, "Please verify your email address before checking out")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,618 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"resturant/models"
+	"resturant/payments"
+	"resturant/utils"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// errInsufficientBalance is returned when a wallet can't cover a debit
+var errInsufficientBalance = errors.New("insufficient wallet balance")
+
+var walletColumns = []string{"id", "customer_id", "currency", moneyColumn("balance", "currency", "balance"), "created_at", "updated_at"}
+
+var walletTransactionColumns = []string{
+	"wallet_transactions.id", "wallet_id", "kind", moneyColumn("amount", "wallets.currency", "amount"),
+	moneyColumn("balance_after", "wallets.currency", "balance_after"), "order_id", "reference_id", "provider_payment_id",
+	"description", "expires_at", "created_by", "wallet_transactions.created_at",
+}
+
+// lockWallet loads the customer's wallet in a currency, created empty when
+// needed, and keeps its row locked until the transaction ends so concurrent
+// debits wait for each other. Promotional credit that lapsed is taken back
+// first.
+func lockWallet(tx *sqlx.Tx, customerID uuid.UUID, currency string) (models.Wallet, error) {
+	var wallet models.Wallet
+	now := time.Now()
+	query, args, err := QB.Insert("wallets").
+		Columns("id", "customer_id", "currency", "created_at", "updated_at").
+		Values(uuid.New(), customerID, currency, now, now).
+		Suffix("ON CONFLICT (customer_id, currency) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return wallet, err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return wallet, err
+	}
+
+	query, args, err = QB.Select(walletColumns...).
+		From("wallets").
+		Where(squirrel.Eq{"customer_id": customerID, "currency": currency}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return wallet, err
+	}
+	if err := tx.Get(&wallet, query, args...); err != nil {
+		return wallet, err
+	}
+
+	if err := loadWalletCredits(tx, &wallet, false); err != nil {
+		return wallet, err
+	}
+	if err := expireWalletCredits(tx, &wallet); err != nil {
+		return wallet, err
+	}
+	err = loadWalletCredits(tx, &wallet, true)
+	return wallet, err
+}
+
+// loadWalletCredits fills in the promotional credit left in the wallet,
+// soonest to expire first. Without unexpired it is the credit that lapsed.
+func loadWalletCredits(q sqlx.Queryer, wallet *models.Wallet, unexpired bool) error {
+	selectCredits := QB.Select("wallet_credits.id", "transaction_id", moneyColumn("wallet_credits.amount", "wallets.currency", "amount"),
+		moneyColumn("remaining", "wallets.currency", "remaining"), "wallet_credits.expires_at", "wallet_credits.created_at").
+		From("wallet_credits").
+		Join("wallets ON wallets.id = wallet_credits.wallet_id").
+		Where(squirrel.Eq{"wallet_id": wallet.ID}).
+		Where(squirrel.Gt{"remaining": 0}).
+		OrderBy("wallet_credits.expires_at", "wallet_credits.created_at")
+	if unexpired {
+		selectCredits = selectCredits.Where(squirrel.Gt{"wallet_credits.expires_at": time.Now()})
+	} else {
+		selectCredits = selectCredits.Where(squirrel.LtOrEq{"wallet_credits.expires_at": time.Now()})
+	}
+	query, args, err := selectCredits.ToSql()
+	if err != nil {
+		return err
+	}
+	wallet.Credits = []models.WalletCredit{}
+	if err := sqlx.Select(q, &wallet.Credits, query, args...); err != nil {
+		return err
+	}
+	wallet.Promotional = models.NewMoney(0, wallet.Currency)
+	for _, credit := range wallet.Credits {
+		wallet.Promotional = wallet.Promotional.Add(credit.Remaining)
+	}
+	return nil
+}
+
+// expireWalletCredits takes back the unspent part of the lapsed credits
+// loaded in the wallet
+func expireWalletCredits(tx *sqlx.Tx, wallet *models.Wallet) error {
+	for _, credit := range wallet.Credits {
+		if err := spendWalletCredit(tx, credit, credit.Remaining); err != nil {
+			return err
+		}
+		transaction := models.WalletTransaction{
+			Kind:        models.WalletExpiry,
+			Amount:      negate(credit.Remaining),
+			ReferenceID: &credit.ID,
+			Description: "Promotional credit expired",
+		}
+		if err := recordWalletTransaction(tx, wallet, &transaction); err != nil {
+			return err
+		}
+		err := postEntry(tx, models.EntryWalletExpiry, nil, &transaction.ID, "Promotional credit expired for customer "+wallet.CustomerID.String(), []posting{
+			{models.LedgerOwnerCustomer, wallet.CustomerID, models.AccountWallet, credit.Remaining},
+			{models.LedgerOwnerPlatform, uuid.Nil, models.AccountPromotions, negate(credit.Remaining)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spendWalletCredit lowers what is left of a promotional credit
+func spendWalletCredit(tx *sqlx.Tx, credit models.WalletCredit, amount models.Money) error {
+	query, args, err := QB.Update("wallet_credits").
+		Set("remaining", credit.Remaining.Sub(amount)).
+		Where(squirrel.Eq{"id": credit.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query, args...)
+	return err
+}
+
+// recordWalletTransaction appends a transaction to the locked wallet and
+// moves its balance, which can't go below zero
+func recordWalletTransaction(tx *sqlx.Tx, wallet *models.Wallet, transaction *models.WalletTransaction) error {
+	balance := wallet.Balance.Add(transaction.Amount)
+	if balance.IsNegative() {
+		return errInsufficientBalance
+	}
+
+	transaction.ID = uuid.New()
+	transaction.WalletID = wallet.ID
+	transaction.BalanceAfter = balance
+	transaction.CreatedAt = time.Now()
+	query, args, err := QB.Insert("wallet_transactions").
+		Columns("id", "wallet_id", "kind", "amount", "balance_after", "order_id", "reference_id", "provider_payment_id",
+			"description", "expires_at", "created_by", "created_at").
+		Values(transaction.ID, transaction.WalletID, transaction.Kind, transaction.Amount, transaction.BalanceAfter, transaction.OrderID,
+			transaction.ReferenceID, transaction.ProviderPaymentID, transaction.Description, transaction.ExpiresAt, transaction.CreatedBy,
+			transaction.CreatedAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	query, args, err = QB.Update("wallets").
+		Set("balance", balance).
+		Set("updated_at", transaction.CreatedAt).
+		Where(squirrel.Eq{"id": wallet.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	wallet.Balance, wallet.UpdatedAt = balance, transaction.CreatedAt
+	return nil
+}
+
+// debitWallet pays an order from the locked wallet, spending the promotional
+// credit that expires first before the rest of the balance. What it took from
+// each credit is kept so a refund can give it back.
+func debitWallet(tx *sqlx.Tx, wallet *models.Wallet, order models.Order, amount models.Money) (models.WalletTransaction, error) {
+	transaction := models.WalletTransaction{
+		Kind:        models.WalletPayment,
+		Amount:      negate(amount),
+		OrderID:     &order.ID,
+		Description: "Payment for order " + order.ID.String(),
+	}
+	if err := recordWalletTransaction(tx, wallet, &transaction); err != nil {
+		return transaction, err
+	}
+
+	left := amount
+	for i, credit := range wallet.Credits {
+		if left.IsZero() {
+			break
+		}
+		spent := minMoney(left, credit.Remaining)
+		if spent.IsZero() {
+			continue
+		}
+		if err := spendWalletCredit(tx, credit, spent); err != nil {
+			return transaction, err
+		}
+		query, args, err := QB.Insert("wallet_credit_spends").
+			Columns("transaction_id", "credit_id", "amount").
+			Values(transaction.ID, credit.ID, spent).
+			ToSql()
+		if err != nil {
+			return transaction, err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return transaction, err
+		}
+		wallet.Credits[i].Remaining = credit.Remaining.Sub(spent)
+		wallet.Promotional = wallet.Promotional.Sub(spent)
+		left = left.Sub(spent)
+	}
+	return transaction, nil
+}
+
+// creditWallet adds to the locked wallet, the credit is promotional and
+// spent first when it expires
+func creditWallet(tx *sqlx.Tx, wallet *models.Wallet, transaction *models.WalletTransaction) error {
+	if err := recordWalletTransaction(tx, wallet, transaction); err != nil {
+		return err
+	}
+	if transaction.ExpiresAt == nil {
+		return nil
+	}
+
+	credit := models.WalletCredit{
+		ID:            uuid.New(),
+		TransactionID: transaction.ID,
+		Amount:        transaction.Amount,
+		Remaining:     transaction.Amount,
+		ExpiresAt:     *transaction.ExpiresAt,
+		CreatedAt:     transaction.CreatedAt,
+	}
+	query, args, err := QB.Insert("wallet_credits").
+		Columns("id", "wallet_id", "transaction_id", "amount", "remaining", "expires_at", "created_at").
+		Values(credit.ID, wallet.ID, credit.TransactionID, credit.Amount, credit.Remaining, credit.ExpiresAt, credit.CreatedAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	wallet.Credits = append(wallet.Credits, credit)
+	wallet.Promotional = wallet.Promotional.Add(credit.Amount)
+	return nil
+}
+
+// refundToWallet gives money of an order back to the customer's wallet, the
+// caller records it in the ledger with the refund. The promotional credit the
+// order's wallet payment spent comes back first, with its expiry, the credit
+// that expires last first; only the rest becomes regular balance.
+func refundToWallet(tx *sqlx.Tx, order models.Order, amount models.Money, referenceID uuid.UUID) (models.WalletTransaction, error) {
+	transaction := models.WalletTransaction{
+		Kind:        models.WalletRefund,
+		Amount:      amount,
+		OrderID:     &order.ID,
+		ReferenceID: &referenceID,
+		Description: "Refund for order " + order.ID.String(),
+	}
+	wallet, err := lockWallet(tx, order.CustomerID, order.Currency)
+	if err != nil {
+		return transaction, err
+	}
+	if err := recordWalletTransaction(tx, &wallet, &transaction); err != nil {
+		return transaction, err
+	}
+	if err := restoreWalletCredits(tx, order, amount); err != nil {
+		return transaction, err
+	}
+	// Credit that lapsed since it was spent is taken back right away
+	if err := loadWalletCredits(tx, &wallet, false); err != nil {
+		return transaction, err
+	}
+	err = expireWalletCredits(tx, &wallet)
+	return transaction, err
+}
+
+// restoreWalletCredits gives back up to amount of the promotional credit the
+// wallet payments of an order spent and that didn't go back yet
+func restoreWalletCredits(tx *sqlx.Tx, order models.Order, amount models.Money) error {
+	query, args, err := QB.Select("wallet_credit_spends.transaction_id", "wallet_credit_spends.credit_id",
+		moneyColumn("wallet_credit_spends.amount - wallet_credit_spends.restored", "wallets.currency", "spent")).
+		From("wallet_credit_spends").
+		Join("wallet_credits ON wallet_credits.id = wallet_credit_spends.credit_id").
+		Join("wallets ON wallets.id = wallet_credits.wallet_id").
+		Join("wallet_transactions ON wallet_transactions.id = wallet_credit_spends.transaction_id").
+		Where(squirrel.Eq{"wallet_transactions.order_id": order.ID, "wallet_transactions.kind": models.WalletPayment}).
+		Where("wallet_credit_spends.restored < wallet_credit_spends.amount").
+		OrderBy("wallet_credits.expires_at DESC", "wallet_credits.created_at DESC").
+		Suffix("FOR UPDATE OF wallet_credit_spends").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	var spends []struct {
+		TransactionID uuid.UUID    `db:"transaction_id"`
+		CreditID      uuid.UUID    `db:"credit_id"`
+		Spent         models.Money `db:"spent"`
+	}
+	if err := tx.Select(&spends, query, args...); err != nil {
+		return err
+	}
+
+	left := amount
+	for _, spend := range spends {
+		if left.IsZero() {
+			break
+		}
+		restored := minMoney(left, spend.Spent)
+		query, args, err := QB.Update("wallet_credits").
+			Set("remaining", squirrel.Expr("remaining + ?", restored)).
+			Where(squirrel.Eq{"id": spend.CreditID}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		query, args, err = QB.Update("wallet_credit_spends").
+			Set("restored", squirrel.Expr("restored + ?", restored)).
+			Where(squirrel.Eq{"transaction_id": spend.TransactionID, "credit_id": spend.CreditID}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		left = left.Sub(restored)
+	}
+	return nil
+}
+
+// walletCustomer is the customer of the wallet routes, the one in the path
+// for admins
+func walletCustomer(r *http.Request) (uuid.UUID, error) {
+	if id := r.PathValue("id"); id != "" {
+		return uuid.Parse(id)
+	}
+	return currentSession(r).UserID, nil
+}
+
+// GetWallets lists the customer's wallets, one per currency, with the
+// promotional credit left in each
+func GetWallets(w http.ResponseWriter, r *http.Request) {
+	customerID, err := walletCustomer(r)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	var currencies []string
+	if err := tx.Select(&currencies, "SELECT currency FROM wallets WHERE customer_id = $1 ORDER BY currency", customerID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallets")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	// Locking expires the lapsed credits so the balances are current
+	wallets := []models.Wallet{}
+	for _, currency := range currencies {
+		wallet, err := lockWallet(tx, customerID, currency)
+		if err != nil {
+			utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallets")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallets")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, wallets)
+}
+
+// GetWalletTransactions lists the transactions of the customer's wallets,
+// newest first, filtered with ?currency=
+func GetWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	customerID, err := walletCustomer(r)
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	selectTransactions := QB.Select(walletTransactionColumns...).
+		From("wallet_transactions").
+		Join("wallets ON wallets.id = wallet_transactions.wallet_id").
+		Where(squirrel.Eq{"wallets.customer_id": customerID}).
+		OrderBy("wallet_transactions.created_at DESC")
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		selectTransactions = selectTransactions.Where(squirrel.Eq{"wallets.currency": currency})
+	}
+	query, args, err := selectTransactions.ToSql()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to create query")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	transactions := []models.WalletTransaction{}
+	if err := db.Select(&transactions, query, args...); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallet transactions")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, transactions)
+}
+
+// TopUpWallet charges the customer's card and adds the amount to their wallet
+func TopUpWallet(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+
+	var req models.WalletTopUpRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	amount, message := amountIn(req.Amount, req.Currency)
+	if message == "" && (amount.IsZero() || amount.IsNegative()) {
+		message = "must be more than 0"
+	}
+	if message != "" {
+		utils.HandleValidationError(w, utils.FieldErrors{"amount": message})
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	wallet, err := lockWallet(tx, session.UserID, req.Currency)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallet")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	// The card is charged at once, the wallet stays locked so a parallel
+	// top-up waits for this one
+	transactionKey := uuid.New()
+	result, err := paymentProvider.Authorize(payments.AuthorizeRequest{
+		Amount:         amount,
+		PaymentMethod:  req.PaymentMethod,
+		IdempotencyKey: transactionKey.String(),
+	})
+	if err != nil {
+		utils.HandleError(w, http.StatusBadGateway, "The payment provider is unavailable, try again later")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	if result.Status != payments.StatusAuthorized {
+		utils.HandleError(w, http.StatusPaymentRequired, "The payment was declined: "+result.DeclineReason)
+		return
+	}
+	paymentID := result.PaymentID
+	if result, err = paymentProvider.Capture(paymentID, amount, transactionKey.String()+":capture"); err != nil || result.Status != payments.StatusCaptured {
+		voidAuthorization(paymentID, authorizationVoidKey(transactionKey))
+		if err != nil {
+			utils.HandleError(w, http.StatusBadGateway, "The payment provider is unavailable, try again later")
+			log.Println(utils.ErrorWithTrace(err, err.Error()))
+			return
+		}
+		utils.HandleError(w, http.StatusPaymentRequired, "The payment was declined: "+result.DeclineReason)
+		return
+	}
+
+	transaction := models.WalletTransaction{
+		Kind:              models.WalletTopUp,
+		Amount:            amount,
+		ProviderPaymentID: &paymentID,
+		Description:       "Top-up by card",
+		CreatedBy:         &session.UserID,
+	}
+	err = creditWallet(tx, &wallet, &transaction)
+	if err == nil {
+		err = postEntry(tx, models.EntryWalletTopUp, nil, &transaction.ID, "Wallet top-up for customer "+wallet.CustomerID.String(), []posting{
+			{models.LedgerOwnerPlatform, uuid.Nil, models.AccountCash, amount},
+			{models.LedgerOwnerCustomer, wallet.CustomerID, models.AccountWallet, negate(amount)},
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		// The charge is given back when the wallet could not be credited
+		if _, refundErr := paymentProvider.Refund(paymentID, amount, transactionKey.String()+":refund"); refundErr != nil {
+			log.Println(utils.ErrorWithTrace(refundErr, "failed to refund top-up "+paymentID))
+		}
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to top up wallet")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.WalletTransactionResponse{Transaction: transaction, Wallet: wallet})
+}
+
+// CreateWalletPromotion gives a customer promotional credit that expires
+func CreateWalletPromotion(w http.ResponseWriter, r *http.Request) {
+	session := currentSession(r)
+	customerID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		utils.HandleError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	var req models.WalletPromotionRequest
+	if err := utils.DecodeRequest(r, &req); err != nil {
+		utils.HandleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := utils.Validate(req); errs != nil {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+	errs := utils.FieldErrors{}
+	amount, message := amountIn(req.Amount, req.Currency)
+	if message == "" && (amount.IsZero() || amount.IsNegative()) {
+		message = "must be more than 0"
+	}
+	if message != "" {
+		errs["amount"] = message
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		errs["expires_at"] = "must be in the future"
+	}
+	if len(errs) > 0 {
+		utils.HandleValidationError(w, errs)
+		return
+	}
+
+	var exists bool
+	if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM user_roles WHERE user_id = $1 AND role_id = $2)", customerID, customerRoleID); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get customer")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	} else if !exists {
+		utils.HandleError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to start transaction")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	defer tx.Rollback()
+
+	wallet, err := lockWallet(tx, customerID, req.Currency)
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to get wallet")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	description := req.Description
+	if description == "" {
+		description = "Promotional credit"
+	}
+	transaction := models.WalletTransaction{
+		Kind:        models.WalletPromotion,
+		Amount:      amount,
+		Description: description,
+		ExpiresAt:   &req.ExpiresAt,
+		CreatedBy:   &session.UserID,
+	}
+	if err := creditWallet(tx, &wallet, &transaction); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to credit wallet")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+	err = postEntry(tx, models.EntryWalletPromotion, nil, &transaction.ID, "Promotional credit for customer "+customerID.String(), []posting{
+		{models.LedgerOwnerPlatform, uuid.Nil, models.AccountPromotions, amount},
+		{models.LedgerOwnerCustomer, customerID, models.AccountWallet, negate(amount)},
+	})
+	if err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to record credit in the ledger")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.HandleError(w, http.StatusInternalServerError, "Failed to credit wallet")
+		log.Println(utils.ErrorWithTrace(err, err.Error()))
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusCreated, models.WalletTransactionResponse{Transaction: transaction, Wallet: wallet})
+}
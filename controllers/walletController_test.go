@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"resturant/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var walletCreditRowColumns = []string{"id", "transaction_id", "amount", "remaining", "expires_at", "created_at"}
+
+func TestRefundToWalletRestoresTheSpentCredit(t *testing.T) {
+	f := useFakeDB(t)
+	customerID, orderID, paymentID := uuid.New(), uuid.New(), uuid.New()
+	laterCredit, soonerCredit := uuid.New(), uuid.New()
+	f.expect("INSERT INTO wallets")
+	f.expect("FROM wallets").returns([]string{"id", "customer_id", "currency", "balance", "created_at", "updated_at"},
+		[]driver.Value{uuid.NewString(), customerID.String(), "USD", "2.00 USD", time.Now(), time.Now()})
+	f.expect("FROM wallet_credits").returns(walletCreditRowColumns)
+	f.expect("FROM wallet_credits").returns(walletCreditRowColumns)
+	refunded := f.expect("INSERT INTO wallet_transactions")
+	balance := f.expect("UPDATE wallets")
+	// The payment spent 5.00 from each credit, the one expiring last comes
+	// back first
+	f.expect("FROM wallet_credit_spends").returns([]string{"transaction_id", "credit_id", "spent"},
+		[]driver.Value{paymentID.String(), laterCredit.String(), "5.00 USD"},
+		[]driver.Value{paymentID.String(), soonerCredit.String(), "5.00 USD"})
+	restoredLater := f.expect("UPDATE wallet_credits")
+	f.expect("UPDATE wallet_credit_spends")
+	restoredSooner := f.expect("UPDATE wallet_credits")
+	f.expect("UPDATE wallet_credit_spends")
+	f.expect("FROM wallet_credits").returns(walletCreditRowColumns)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	amount, err := models.ParseMoney("8.00", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{ID: orderID, CustomerID: customerID, Currency: "USD"}
+	if _, err := refundToWallet(tx, order, amount, orderID); err != nil {
+		t.Fatal(err)
+	}
+
+	if !containsArg(refunded.args, models.WalletRefund) {
+		t.Errorf("no refund transaction, args %v", refunded.args)
+	}
+	if !containsAmount(balance.args, "10.00") {
+		t.Errorf("balance not raised to 10.00, args %v", balance.args)
+	}
+	if !containsArg(restoredLater.args, laterCredit.String()) || !containsAmount(restoredLater.args, "5.00") {
+		t.Errorf("credit %s not restored by 5.00, args %v", laterCredit, restoredLater.args)
+	}
+	if !containsArg(restoredSooner.args, soonerCredit.String()) || !containsAmount(restoredSooner.args, "3.00") {
+		t.Errorf("credit %s not restored by 3.00, args %v", soonerCredit, restoredSooner.args)
+	}
+}
+
+// containsAmount reports whether one of the args prints as amount
+func containsAmount(args []driver.Value, amount string) bool {
+	for _, arg := range args {
+		if fmt.Sprint(arg) == amount {
+			return true
+		}
+	}
+	return false
+}
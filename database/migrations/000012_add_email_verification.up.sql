@@ -0,0 +1,17 @@
+ALTER TABLE users
+    ADD COLUMN email_verified boolean NOT NULL DEFAULT false,
+    ADD COLUMN email_verified_at timestamp;
+
+-- Accounts created before verification existed are trusted as they are
+UPDATE users SET email_verified = true, email_verified_at = NOW();
+
+CREATE TABLE email_verifications (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    expires_at timestamp NOT NULL,
+    used_at timestamp
+);
+
+CREATE INDEX idx_email_verifications_user_id ON email_verifications (user_id, created_at);
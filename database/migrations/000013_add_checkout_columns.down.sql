@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS vendor_id,
+    DROP COLUMN IF EXISTS status;
+
+DROP INDEX IF EXISTS idx_carts_active_user;
+
+ALTER TABLE carts DROP COLUMN IF EXISTS checked_out_at;
@@ -0,0 +1,11 @@
+-- A cart stays active until it is checked out, the order keeps referencing it
+ALTER TABLE carts ADD COLUMN checked_out_at timestamp;
+
+CREATE UNIQUE INDEX idx_carts_active_user ON carts (user_id) WHERE checked_out_at IS NULL;
+
+ALTER TABLE orders
+    ADD COLUMN vendor_id uuid REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN status varchar(20) NOT NULL DEFAULT 'placed';
+
+CREATE INDEX idx_orders_vendor_id ON orders (vendor_id);
+CREATE INDEX idx_orders_customer_id ON orders (customer_id);
@@ -0,0 +1,27 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret varchar(64),
+    ADD COLUMN totp_enabled boolean NOT NULL DEFAULT false,
+    ADD COLUMN totp_required boolean NOT NULL DEFAULT false,
+    ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash varchar(64) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    used_at timestamp
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+-- Password logins of users with 2FA enabled get a challenge that is traded
+-- for a session once the code is verified
+CREATE TABLE login_challenges (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    attempts int NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    expires_at timestamp NOT NULL,
+    used_at timestamp
+);
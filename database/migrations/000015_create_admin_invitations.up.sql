@@ -0,0 +1,9 @@
+CREATE TABLE admin_invitations (
+    id uuid PRIMARY KEY,
+    email varchar(100) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    invited_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    expires_at timestamp NOT NULL,
+    accepted_at timestamp
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+
+DELETE FROM roles WHERE id > 3;
+SELECT setval('roles_id_seq', 3);
+
+ALTER TABLE roles
+    DROP COLUMN IF EXISTS vendor_id,
+    DROP COLUMN IF EXISTS scope;
@@ -0,0 +1,58 @@
+-- Platform roles (admin, customer) hold platform permissions, vendor roles
+-- (the owner, staff and roles a vendor creates) hold vendor permissions
+ALTER TABLE roles
+    ADD COLUMN scope varchar(20) NOT NULL DEFAULT 'platform',
+    ADD COLUMN vendor_id uuid REFERENCES vendors(vendor_id) ON DELETE CASCADE;
+
+UPDATE roles SET scope = 'vendor' WHERE id = 2;
+
+INSERT INTO roles (id, name, scope)
+VALUES
+    (4, 'manager', 'vendor'),
+    (5, 'cashier', 'vendor'),
+    (6, 'kitchen', 'vendor')
+ON CONFLICT (id) DO NOTHING;
+
+-- Roles were inserted with explicit ids, custom roles continue after them
+SELECT setval('roles_id_seq', (SELECT MAX(id) FROM roles));
+
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    name varchar(100) NOT NULL UNIQUE,
+    description text NOT NULL,
+    scope varchar(20) NOT NULL
+);
+
+INSERT INTO permissions (name, description, scope)
+VALUES
+    ('admins:manage', 'Invite admins and revoke admin roles', 'platform'),
+    ('users:manage', 'Manage user accounts and their security settings', 'platform'),
+    ('vendors:read', 'List vendors and read their details', 'platform'),
+    ('vendors:manage', 'Add, update and delete vendors', 'platform'),
+    ('roles:manage', 'Change the permissions of the built-in roles', 'platform'),
+    ('menu:manage', 'Add, update and delete menu items', 'vendor'),
+    ('orders:read', 'See the vendor''s orders', 'vendor'),
+    ('orders:update', 'Move orders through their statuses', 'vendor'),
+    ('orders:refund', 'Refund and cancel order lines', 'vendor'),
+    ('staff:manage', 'Invite staff and manage the vendor''s roles', 'vendor');
+
+CREATE TABLE role_permissions (
+    role_id integer NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id integer NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Admins and vendor owners get every permission of their scope
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.scope = roles.scope
+WHERE roles.id IN (1, 2);
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON
+    (roles.name = 'manager' AND permissions.name IN ('menu:manage', 'orders:read', 'orders:update', 'orders:refund'))
+    OR (roles.name IN ('cashier', 'kitchen') AND permissions.name IN ('orders:read', 'orders:update'))
+WHERE roles.id IN (4, 5, 6);
@@ -0,0 +1,4 @@
+ALTER TABLE items DROP COLUMN IF EXISTS deleted_at;
+
+DROP TABLE IF EXISTS staff_invitations;
+DROP TABLE IF EXISTS vendor_staff;
@@ -0,0 +1,24 @@
+-- A staff member works for a single vendor, their permissions come from the
+-- vendor role they hold in user_roles
+CREATE TABLE vendor_staff (
+    user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    vendor_id uuid NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_vendor_staff_vendor_id ON vendor_staff (vendor_id);
+
+CREATE TABLE staff_invitations (
+    id uuid PRIMARY KEY,
+    vendor_id uuid NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    role_id integer NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    email varchar(100) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    invited_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    expires_at timestamp NOT NULL,
+    accepted_at timestamp
+);
+
+-- Menu items are archived instead of deleted so past orders keep their lines
+ALTER TABLE items ADD COLUMN deleted_at timestamp;
@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name = 'profile:manage';
+
+DROP TABLE IF EXISTS vendor_application_documents;
+DROP TABLE IF EXISTS vendor_applications;
+
+ALTER TABLE vendors
+    DROP COLUMN IF EXISTS cuisine,
+    DROP COLUMN IF EXISTS address;
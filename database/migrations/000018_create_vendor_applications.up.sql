@@ -0,0 +1,39 @@
+ALTER TABLE vendors
+    ADD COLUMN address text NOT NULL DEFAULT '',
+    ADD COLUMN cuisine varchar(100) NOT NULL DEFAULT '';
+
+-- Applications hold everything needed to create the vendor account, nothing
+-- is created in users until an admin approves them
+CREATE TABLE vendor_applications (
+    id uuid PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    email varchar(100) NOT NULL,
+    phone varchar(20) NOT NULL,
+    password varchar(255) NOT NULL,
+    description text NOT NULL,
+    address text NOT NULL,
+    cuisine varchar(100) NOT NULL,
+    logo varchar(255) NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    rejection_reason text,
+    reviewed_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at timestamp,
+    vendor_id uuid REFERENCES vendors(vendor_id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_vendor_applications_pending_email ON vendor_applications (email) WHERE status = 'pending';
+
+CREATE TABLE vendor_application_documents (
+    id uuid PRIMARY KEY,
+    application_id uuid NOT NULL REFERENCES vendor_applications(id) ON DELETE CASCADE,
+    filename varchar(255) NOT NULL,
+    path varchar(255) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('profile:manage', 'Edit the vendor''s public profile', 'vendor');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 2, id FROM permissions WHERE name = 'profile:manage';
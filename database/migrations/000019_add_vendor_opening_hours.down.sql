@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS vendor_closures;
+DROP TABLE IF EXISTS vendor_opening_hours;
+
+ALTER TABLE vendors DROP COLUMN IF EXISTS time_zone;
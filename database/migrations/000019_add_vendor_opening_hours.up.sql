@@ -0,0 +1,26 @@
+-- Opening hours are kept in the vendor's local time, time_zone is an IANA
+-- name understood by Postgres (AT TIME ZONE)
+ALTER TABLE vendors ADD COLUMN time_zone varchar(64) NOT NULL DEFAULT 'UTC';
+
+-- weekday follows EXTRACT(DOW): 0 is Sunday. An interval closing at or before
+-- its opening time runs past midnight into the next day, opens_at = closes_at
+-- is open for 24 hours.
+CREATE TABLE vendor_opening_hours (
+    id serial PRIMARY KEY,
+    vendor_id uuid NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    weekday smallint NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at time NOT NULL,
+    closes_at time NOT NULL
+);
+
+CREATE INDEX idx_vendor_opening_hours_vendor_id ON vendor_opening_hours (vendor_id, weekday);
+
+-- A closure shuts the intervals opening on that local date
+CREATE TABLE vendor_closures (
+    id uuid PRIMARY KEY,
+    vendor_id uuid NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    date date NOT NULL,
+    reason varchar(255) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (vendor_id, date)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_vendors_location;
+
+ALTER TABLE vendors
+    DROP CONSTRAINT IF EXISTS vendors_location_complete,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
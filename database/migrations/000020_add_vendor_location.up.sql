@@ -0,0 +1,8 @@
+-- Coordinates in decimal degrees (WGS 84), distances are computed with the
+-- haversine formula so PostGIS is not needed
+ALTER TABLE vendors
+    ADD COLUMN latitude double precision CHECK (latitude BETWEEN -90 AND 90),
+    ADD COLUMN longitude double precision CHECK (longitude BETWEEN -180 AND 180),
+    ADD CONSTRAINT vendors_location_complete CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+CREATE INDEX idx_vendors_location ON vendors (latitude, longitude) WHERE latitude IS NOT NULL;
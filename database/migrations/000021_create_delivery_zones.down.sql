@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS delivery_fee,
+    DROP COLUMN IF EXISTS delivery_longitude,
+    DROP COLUMN IF EXISTS delivery_latitude,
+    DROP COLUMN IF EXISTS delivery_zone_id;
+
+DROP TABLE IF EXISTS delivery_zones;
@@ -0,0 +1,27 @@
+-- A radius zone covers radius_km around its center, a polygon zone the area
+-- inside polygon, a JSON array of [latitude, longitude] points
+CREATE TABLE delivery_zones (
+    id uuid PRIMARY KEY,
+    vendor_id uuid NOT NULL REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    kind varchar(10) NOT NULL CHECK (kind IN ('radius', 'polygon')),
+    center_latitude double precision,
+    center_longitude double precision,
+    radius_km double precision,
+    polygon jsonb,
+    fee decimal(10, 2) NOT NULL DEFAULT 0,
+    min_order decimal(10, 2) NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    CHECK (kind <> 'radius' OR (center_latitude IS NOT NULL AND center_longitude IS NOT NULL AND radius_km > 0)),
+    CHECK (kind <> 'polygon' OR polygon IS NOT NULL)
+);
+
+CREATE INDEX idx_delivery_zones_vendor_id ON delivery_zones (vendor_id);
+
+-- Orders keep the delivery point and the fee charged, order_total_cost includes the fee
+ALTER TABLE orders
+    ADD COLUMN delivery_zone_id uuid REFERENCES delivery_zones(id) ON DELETE SET NULL,
+    ADD COLUMN delivery_latitude double precision,
+    ADD COLUMN delivery_longitude double precision,
+    ADD COLUMN delivery_fee decimal(10, 2) NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS delivery_instructions,
+    DROP COLUMN IF EXISTS delivery_address,
+    DROP COLUMN IF EXISTS address_id;
+
+DROP TABLE IF EXISTS customer_addresses;
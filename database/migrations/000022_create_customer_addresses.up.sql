@@ -0,0 +1,23 @@
+CREATE TABLE customer_addresses (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    label varchar(50) NOT NULL,
+    address varchar(500) NOT NULL,
+    latitude double precision CHECK (latitude BETWEEN -90 AND 90),
+    longitude double precision CHECK (longitude BETWEEN -180 AND 180),
+    instructions varchar(500) NOT NULL DEFAULT '',
+    is_default boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    CHECK ((latitude IS NULL) = (longitude IS NULL))
+);
+
+CREATE INDEX idx_customer_addresses_user_id ON customer_addresses (user_id);
+CREATE UNIQUE INDEX idx_customer_addresses_default ON customer_addresses (user_id) WHERE is_default;
+
+-- Orders keep a copy of the address so editing or deleting it later does not
+-- change past orders
+ALTER TABLE orders
+    ADD COLUMN address_id uuid REFERENCES customer_addresses(id) ON DELETE SET NULL,
+    ADD COLUMN delivery_address varchar(500) NOT NULL DEFAULT '',
+    ADD COLUMN delivery_instructions varchar(500) NOT NULL DEFAULT '';
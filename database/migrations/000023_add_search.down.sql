@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_users_name_trgm;
+DROP INDEX IF EXISTS idx_items_name_trgm;
+DROP INDEX IF EXISTS idx_vendors_search_vector;
+DROP INDEX IF EXISTS idx_items_search_vector;
+
+ALTER TABLE vendors DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE items DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE items DROP COLUMN IF EXISTS description;
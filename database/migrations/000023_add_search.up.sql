@@ -0,0 +1,20 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE items ADD COLUMN description text NOT NULL DEFAULT '';
+
+-- Names weigh more than descriptions in the search rank. The vendor name lives
+-- in users, it is weighted in at query time.
+ALTER TABLE items ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', name), 'A') || setweight(to_tsvector('english', description), 'B')
+) STORED;
+
+ALTER TABLE vendors ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', cuisine), 'B') || setweight(to_tsvector('english', description), 'C')
+) STORED;
+
+CREATE INDEX idx_items_search_vector ON items USING GIN (search_vector);
+CREATE INDEX idx_vendors_search_vector ON vendors USING GIN (search_vector);
+
+-- Trigram indexes back the fuzzy fallback for misspelled names
+CREATE INDEX idx_items_name_trgm ON items USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
@@ -0,0 +1,22 @@
+DELETE FROM permissions WHERE name = 'finance:manage';
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE delivery_zones
+    ALTER COLUMN min_order TYPE decimal(10, 2),
+    ALTER COLUMN fee TYPE decimal(10, 2);
+
+ALTER TABLE order_item ALTER COLUMN price TYPE decimal(10, 2);
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS currency,
+    ALTER COLUMN delivery_fee TYPE decimal(10, 2),
+    ALTER COLUMN order_total_cost TYPE decimal(10, 2);
+
+ALTER TABLE carts
+    DROP COLUMN IF EXISTS currency,
+    ALTER COLUMN total_price TYPE decimal(10, 2);
+
+ALTER TABLE items ALTER COLUMN price TYPE decimal(10, 2);
+
+ALTER TABLE vendors DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,39 @@
+-- Amounts are in the currency of the vendor they belong to, orders keep the
+-- currency they were placed in. Three decimals fit every ISO 4217 currency.
+ALTER TABLE vendors ADD COLUMN currency char(3) NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+
+ALTER TABLE items ALTER COLUMN price TYPE decimal(13, 3);
+
+-- The currency of the items in the cart, NULL while it is empty
+ALTER TABLE carts
+    ALTER COLUMN total_price TYPE decimal(13, 3),
+    ADD COLUMN currency char(3);
+
+ALTER TABLE orders
+    ALTER COLUMN order_total_cost TYPE decimal(13, 3),
+    ALTER COLUMN delivery_fee TYPE decimal(13, 3),
+    ADD COLUMN currency char(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE order_item ALTER COLUMN price TYPE decimal(13, 3);
+
+ALTER TABLE delivery_zones
+    ALTER COLUMN fee TYPE decimal(13, 3),
+    ALTER COLUMN min_order TYPE decimal(13, 3);
+
+-- rate is how many units of base_currency one unit of currency is worth,
+-- reports convert with the rates of the configured base currency
+CREATE TABLE exchange_rates (
+    currency char(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    base_currency char(3) NOT NULL CHECK (base_currency ~ '^[A-Z]{3}$'),
+    rate decimal(20, 10) NOT NULL CHECK (rate > 0),
+    updated_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (base_currency, currency)
+);
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('finance:manage', 'Maintain exchange rates and read financial reports', 'platform');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE name = 'finance:manage';
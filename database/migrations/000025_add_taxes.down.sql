@@ -0,0 +1,19 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS tax_total,
+    DROP COLUMN IF EXISTS delivery_tax,
+    DROP COLUMN IF EXISTS delivery_tax_rate,
+    DROP COLUMN IF EXISTS prices_include_tax;
+
+ALTER TABLE order_item
+    DROP COLUMN IF EXISTS tax_amount,
+    DROP COLUMN IF EXISTS tax_rate,
+    DROP COLUMN IF EXISTS tax_category;
+
+ALTER TABLE items DROP COLUMN IF EXISTS tax_category;
+
+ALTER TABLE vendors
+    DROP COLUMN IF EXISTS prices_include_tax,
+    DROP COLUMN IF EXISTS tax_jurisdiction_id;
+
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS tax_jurisdictions;
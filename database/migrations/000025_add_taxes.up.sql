@@ -0,0 +1,36 @@
+-- A jurisdiction holds the tax rates of an area, vendors are assigned one by
+-- an admin. Rates are percentages, e.g. 8.875.
+CREATE TABLE tax_jurisdictions (
+    id uuid PRIMARY KEY,
+    code varchar(20) NOT NULL UNIQUE,
+    name varchar(100) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE tax_rates (
+    jurisdiction_id uuid NOT NULL REFERENCES tax_jurisdictions(id) ON DELETE CASCADE,
+    category varchar(20) NOT NULL CHECK (category IN ('food', 'alcohol', 'delivery')),
+    rate decimal(7, 4) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    PRIMARY KEY (jurisdiction_id, category)
+);
+
+-- With prices_include_tax menu prices and delivery fees already contain the tax
+ALTER TABLE vendors
+    ADD COLUMN tax_jurisdiction_id uuid REFERENCES tax_jurisdictions(id) ON DELETE SET NULL,
+    ADD COLUMN prices_include_tax boolean NOT NULL DEFAULT false;
+
+ALTER TABLE items ADD COLUMN tax_category varchar(20) NOT NULL DEFAULT 'food' CHECK (tax_category IN ('food', 'alcohol'));
+
+-- Every line keeps the rate and the tax it was charged, tax_total sums the
+-- lines and the tax on the delivery fee
+ALTER TABLE order_item
+    ADD COLUMN tax_category varchar(20) NOT NULL DEFAULT 'food',
+    ADD COLUMN tax_rate decimal(7, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount decimal(13, 3) NOT NULL DEFAULT 0;
+
+ALTER TABLE orders
+    ADD COLUMN prices_include_tax boolean NOT NULL DEFAULT false,
+    ADD COLUMN delivery_tax_rate decimal(7, 4) NOT NULL DEFAULT 0,
+    ADD COLUMN delivery_tax decimal(13, 3) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_total decimal(13, 3) NOT NULL DEFAULT 0;
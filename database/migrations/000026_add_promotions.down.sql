@@ -0,0 +1,15 @@
+DELETE FROM permissions WHERE name = 'promotions:manage';
+
+ALTER TABLE order_item DROP COLUMN IF EXISTS discount;
+
+DROP INDEX IF EXISTS orders_promotion_id_idx;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS delivery_discount,
+    DROP COLUMN IF EXISTS discount_total,
+    DROP COLUMN IF EXISTS coupon_code,
+    DROP COLUMN IF EXISTS promotion_id;
+
+ALTER TABLE carts DROP COLUMN IF EXISTS promotion_id;
+
+DROP TABLE IF EXISTS promotions;
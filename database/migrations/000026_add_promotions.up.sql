@@ -0,0 +1,50 @@
+-- Promotions are redeemed with their code. A promotion without a vendor is
+-- platform-wide. Amounts (the fixed discount and the minimum spend) are in
+-- the promotion's currency, which is the vendor's one for vendor promotions.
+CREATE TABLE promotions (
+    id uuid PRIMARY KEY,
+    code varchar(40) NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT '',
+    vendor_id uuid REFERENCES vendors(vendor_id) ON DELETE CASCADE,
+    kind varchar(20) NOT NULL CHECK (kind IN ('percentage', 'fixed', 'free_delivery', 'buy_x_get_y')),
+    percent decimal(5, 2) CHECK (percent > 0 AND percent <= 100),
+    amount decimal(13, 3) CHECK (amount > 0),
+    item_id uuid REFERENCES items(id) ON DELETE CASCADE,
+    buy_quantity integer CHECK (buy_quantity > 0),
+    get_quantity integer CHECK (get_quantity > 0),
+    min_spend decimal(13, 3) NOT NULL DEFAULT 0 CHECK (min_spend >= 0),
+    currency char(3) CHECK (currency ~ '^[A-Z]{3}$'),
+    starts_at timestamp,
+    ends_at timestamp,
+    max_uses integer CHECK (max_uses > 0),
+    max_uses_per_customer integer CHECK (max_uses_per_customer > 0),
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    CHECK (currency IS NOT NULL OR (amount IS NULL AND min_spend = 0)),
+    CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX promotions_vendor_id_idx ON promotions (vendor_id);
+
+-- The coupon a customer applied to the cart, checked again at checkout
+ALTER TABLE carts ADD COLUMN promotion_id uuid REFERENCES promotions(id) ON DELETE SET NULL;
+
+-- Orders keep the code and what it took off: discount_total is the discount
+-- of the lines plus the delivery_discount
+ALTER TABLE orders
+    ADD COLUMN promotion_id uuid REFERENCES promotions(id) ON DELETE SET NULL,
+    ADD COLUMN coupon_code varchar(40),
+    ADD COLUMN discount_total decimal(13, 3) NOT NULL DEFAULT 0,
+    ADD COLUMN delivery_discount decimal(13, 3) NOT NULL DEFAULT 0;
+
+-- Usage limits count the orders placed with a promotion
+CREATE INDEX orders_promotion_id_idx ON orders (promotion_id, customer_id);
+
+ALTER TABLE order_item ADD COLUMN discount decimal(13, 3) NOT NULL DEFAULT 0;
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('promotions:manage', 'Create and manage platform-wide and vendor promotions', 'platform');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE name = 'promotions:manage';
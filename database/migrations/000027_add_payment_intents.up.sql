@@ -0,0 +1,18 @@
+-- A payment intent is an amount authorized at the payment provider for an
+-- order. Checkout only places the order once it is authorized, the vendor
+-- accepting the order captures it and cancelling the order voids or refunds it.
+CREATE TABLE payment_intents (
+    id uuid PRIMARY KEY,
+    order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider varchar(20) NOT NULL,
+    provider_payment_id varchar(100) NOT NULL,
+    amount decimal(13, 3) NOT NULL CHECK (amount > 0),
+    captured_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (captured_amount >= 0 AND captured_amount <= amount),
+    refunded_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0 AND refunded_amount <= captured_amount),
+    status varchar(20) NOT NULL CHECK (status IN ('authorized', 'captured', 'refunded', 'voided', 'failed')),
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, provider_payment_id)
+);
+
+CREATE INDEX payment_intents_order_id_idx ON payment_intents (order_id);
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE name = 'payments:collect';
+
+DROP TABLE IF EXISTS cash_payments;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS cash_due,
+    DROP COLUMN IF EXISTS payment_type;
@@ -0,0 +1,31 @@
+-- How the customer pays: the whole order by card, in cash on delivery, or
+-- split between the two. cash_due is the part collected in cash, the rest is
+-- authorized on the card at checkout.
+ALTER TABLE orders
+    ADD COLUMN payment_type varchar(10) NOT NULL DEFAULT 'card' CONSTRAINT orders_payment_type_check CHECK (payment_type IN ('card', 'cash', 'split')),
+    ADD COLUMN cash_due decimal(13, 3) NOT NULL DEFAULT 0 CHECK (cash_due >= 0);
+
+-- Cash the vendor's cashier received for an order. tendered is what the
+-- customer handed over, amount the part applied to the order and
+-- change_given what was handed back.
+CREATE TABLE cash_payments (
+    id uuid PRIMARY KEY,
+    order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount decimal(13, 3) NOT NULL CHECK (amount > 0),
+    tendered decimal(13, 3) NOT NULL,
+    change_given decimal(13, 3) NOT NULL CHECK (change_given >= 0),
+    recorded_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    CHECK (tendered = amount + change_given)
+);
+
+CREATE INDEX cash_payments_order_id_idx ON cash_payments (order_id);
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('payments:collect', 'Record cash received for orders', 'vendor');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.name = 'payments:collect'
+WHERE roles.id IN (2, 4, 5);
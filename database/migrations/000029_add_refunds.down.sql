@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name = 'refunds:manage';
+
+ALTER TABLE orders DROP COLUMN IF EXISTS refunded_total;
+
+ALTER TABLE order_item DROP COLUMN IF EXISTS refunded_quantity;
+
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
@@ -0,0 +1,43 @@
+-- A refund gives back part of what an order charged: some quantity of its
+-- lines and possibly the delivery. amount is what the order no longer owes,
+-- of which card_amount was refunded on payment_intent_id and cash_amount
+-- handed back in cash. The rest was cash that had not been collected yet.
+CREATE TABLE refunds (
+    id uuid PRIMARY KEY,
+    order_id uuid NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    payment_intent_id uuid REFERENCES payment_intents(id) ON DELETE SET NULL,
+    reason text NOT NULL,
+    amount decimal(13, 3) NOT NULL CHECK (amount > 0),
+    tax_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (tax_amount >= 0),
+    delivery_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (delivery_amount >= 0),
+    card_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (card_amount >= 0),
+    cash_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (cash_amount >= 0),
+    refunded_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    CONSTRAINT refunds_tender_check CHECK (card_amount + cash_amount <= amount)
+);
+
+CREATE INDEX refunds_order_id_idx ON refunds (order_id);
+
+-- The quantity of each line a refund cancelled, with its share of the line
+CREATE TABLE refund_items (
+    refund_id uuid NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    item_id uuid NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    quantity integer NOT NULL CHECK (quantity > 0),
+    amount decimal(13, 3) NOT NULL CHECK (amount >= 0),
+    tax_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (tax_amount >= 0),
+    PRIMARY KEY (refund_id, item_id)
+);
+
+ALTER TABLE order_item
+    ADD COLUMN refunded_quantity integer NOT NULL DEFAULT 0 CHECK (refunded_quantity >= 0 AND refunded_quantity <= quantity);
+
+-- refunded_total sums the refunds, the order owes order_total_cost less it.
+-- cash_due goes down when a refund waives cash that was not collected yet.
+ALTER TABLE orders ADD COLUMN refunded_total decimal(13, 3) NOT NULL DEFAULT 0 CHECK (refunded_total >= 0 AND refunded_total <= order_total_cost);
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('refunds:manage', 'Refund and cancel the lines of any order', 'platform');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE name = 'refunds:manage';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+
+DROP FUNCTION IF EXISTS forbid_ledger_changes();
+DROP FUNCTION IF EXISTS check_journal_entry_balanced();
@@ -0,0 +1,75 @@
+-- The ledger records every movement of money as a journal entry whose
+-- postings balance. Accounts belong to the platform (the nil owner id), a
+-- vendor or a customer and hold one currency. Owners are not foreign keys so
+-- the ledger outlives the rows it talks about.
+CREATE TABLE ledger_accounts (
+    id uuid PRIMARY KEY,
+    owner_type varchar(20) NOT NULL CHECK (owner_type IN ('platform', 'vendor', 'customer')),
+    owner_id uuid NOT NULL,
+    name varchar(30) NOT NULL,
+    kind varchar(20) NOT NULL CONSTRAINT ledger_accounts_kind_check CHECK (kind IN ('asset', 'liability', 'revenue')),
+    currency char(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (owner_type, owner_id, name, currency)
+);
+
+CREATE TABLE journal_entries (
+    id uuid PRIMARY KEY,
+    kind varchar(20) NOT NULL CONSTRAINT journal_entries_kind_check CHECK (kind IN ('order_payment', 'refund', 'payout')),
+    order_id uuid,
+    reference_id uuid,
+    description text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX journal_entries_order_id_idx ON journal_entries (order_id);
+
+-- Debits are positive and credits negative
+CREATE TABLE ledger_postings (
+    id uuid PRIMARY KEY,
+    entry_id uuid NOT NULL REFERENCES journal_entries(id),
+    account_id uuid NOT NULL REFERENCES ledger_accounts(id),
+    amount decimal(13, 3) NOT NULL CHECK (amount <> 0),
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ledger_postings_entry_id_idx ON ledger_postings (entry_id);
+CREATE INDEX ledger_postings_account_id_idx ON ledger_postings (account_id, created_at);
+
+-- The postings of an entry must add up to zero in every currency once the
+-- transaction that wrote them commits
+CREATE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM ledger_postings
+        JOIN ledger_accounts ON ledger_accounts.id = ledger_postings.account_id
+        WHERE ledger_postings.entry_id = NEW.entry_id
+        GROUP BY ledger_accounts.currency
+        HAVING SUM(ledger_postings.amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+    AFTER INSERT ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Mistakes are corrected with new entries, never by editing old ones
+CREATE FUNCTION forbid_ledger_changes() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'the ledger is append-only, post a correcting entry instead';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_append_only
+    BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_changes();
+
+CREATE TRIGGER ledger_postings_append_only
+    BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_changes();
@@ -0,0 +1,13 @@
+DELETE FROM permissions WHERE name = 'payouts:read';
+
+DROP TABLE IF EXISTS payout_entries;
+DROP TABLE IF EXISTS payout_lines;
+DROP TABLE IF EXISTS payouts;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS commission_fee,
+    DROP COLUMN IF EXISTS commission_percent;
+
+ALTER TABLE vendors
+    DROP COLUMN IF EXISTS commission_fee,
+    DROP COLUMN IF EXISTS commission_percent;
@@ -0,0 +1,71 @@
+-- The commission the platform keeps on a vendor's orders, a percentage of
+-- what is paid plus a fixed fee per order in the vendor's currency. Vendors
+-- without a percentage pay the platform's COMMISSION_PERCENT.
+ALTER TABLE vendors
+    ADD COLUMN commission_percent decimal(5, 2) CHECK (commission_percent BETWEEN 0 AND 100),
+    ADD COLUMN commission_fee decimal(13, 3) NOT NULL DEFAULT 0 CHECK (commission_fee >= 0);
+
+-- Orders keep the commission of their checkout, those placed before vendors
+-- had one pay the platform's percentage
+ALTER TABLE orders
+    ADD COLUMN commission_percent decimal(5, 2),
+    ADD COLUMN commission_fee decimal(13, 3) NOT NULL DEFAULT 0;
+
+-- A payout statement sums the ledger entries of a vendor's orders up to the
+-- end of a period: net_payout is what the vendor earned, cash_collected the
+-- part they already hold in cash and amount_due what the platform transfers
+-- (negative when the vendor owes the platform). Like the ledger, payouts
+-- outlive the vendor.
+CREATE TABLE payouts (
+    id uuid PRIMARY KEY,
+    vendor_id uuid NOT NULL,
+    currency char(3) NOT NULL,
+    period_start date NOT NULL,
+    period_end date NOT NULL,
+    gross_sales decimal(13, 3) NOT NULL,
+    refunds decimal(13, 3) NOT NULL,
+    commission decimal(13, 3) NOT NULL,
+    net_payout decimal(13, 3) NOT NULL,
+    cash_collected decimal(13, 3) NOT NULL,
+    amount_due decimal(13, 3) NOT NULL,
+    status varchar(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'paid')),
+    approved_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    approved_at timestamp,
+    paid_by uuid REFERENCES users(id) ON DELETE SET NULL,
+    paid_at timestamp,
+    payment_reference text,
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    CHECK (period_start <= period_end),
+    CHECK (net_payout = gross_sales - refunds - commission),
+    CHECK (amount_due = net_payout - cash_collected)
+);
+
+CREATE INDEX payouts_vendor_id_idx ON payouts (vendor_id, period_end);
+
+-- The statement per order
+CREATE TABLE payout_lines (
+    payout_id uuid NOT NULL REFERENCES payouts(id) ON DELETE CASCADE,
+    order_id uuid NOT NULL,
+    gross_sales decimal(13, 3) NOT NULL,
+    refunds decimal(13, 3) NOT NULL,
+    commission decimal(13, 3) NOT NULL,
+    net_payout decimal(13, 3) NOT NULL,
+    PRIMARY KEY (payout_id, order_id)
+);
+
+-- The ledger entries a payout covers, each is paid out once
+CREATE TABLE payout_entries (
+    entry_id uuid PRIMARY KEY REFERENCES journal_entries(id),
+    payout_id uuid NOT NULL REFERENCES payouts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX payout_entries_payout_id_idx ON payout_entries (payout_id);
+
+INSERT INTO permissions (name, description, scope)
+VALUES ('payouts:read', 'See the vendor''s commission and payout statements', 'vendor');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+JOIN permissions ON permissions.name = 'payouts:read'
+WHERE roles.id IN (2, 4);
@@ -0,0 +1,22 @@
+ALTER TABLE journal_entries DROP CONSTRAINT journal_entries_kind_check;
+ALTER TABLE journal_entries
+    ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('order_payment', 'refund', 'payout'));
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_kind_check;
+ALTER TABLE ledger_accounts
+    ADD CONSTRAINT ledger_accounts_kind_check CHECK (kind IN ('asset', 'liability', 'revenue'));
+
+ALTER TABLE refunds DROP CONSTRAINT refunds_tender_check;
+ALTER TABLE refunds DROP COLUMN IF EXISTS wallet_amount;
+ALTER TABLE refunds ADD CONSTRAINT refunds_tender_check CHECK (card_amount + cash_amount <= amount);
+
+ALTER TABLE orders DROP CONSTRAINT orders_payment_type_check;
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS wallet_refunded,
+    DROP COLUMN IF EXISTS wallet_paid,
+    ADD CONSTRAINT orders_payment_type_check CHECK (payment_type IN ('card', 'cash', 'split'));
+
+DROP TABLE IF EXISTS wallet_credits;
+DROP TABLE IF EXISTS wallet_transactions;
+DROP FUNCTION IF EXISTS forbid_wallet_transaction_changes();
+DROP TABLE IF EXISTS wallets;
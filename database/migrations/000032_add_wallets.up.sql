@@ -0,0 +1,84 @@
+-- A customer's stored balance, one wallet per currency. Debits lock the row
+-- so concurrent checkouts can't spend the same money twice.
+CREATE TABLE wallets (
+    id uuid PRIMARY KEY,
+    customer_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    currency char(3) NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+    balance decimal(13, 3) NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    updated_at timestamp NOT NULL DEFAULT NOW(),
+    UNIQUE (customer_id, currency)
+);
+
+-- Every change of a wallet balance, credits are positive and debits
+-- negative. order_id and created_by are not foreign keys so deleting an order
+-- or an admin leaves the history untouched. Top-ups keep the payment that
+-- charged the card at the provider.
+CREATE TABLE wallet_transactions (
+    id uuid PRIMARY KEY,
+    wallet_id uuid NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    kind varchar(20) NOT NULL CHECK (kind IN ('top_up', 'promotion', 'payment', 'refund', 'expiry')),
+    amount decimal(13, 3) NOT NULL CHECK (amount <> 0),
+    balance_after decimal(13, 3) NOT NULL CHECK (balance_after >= 0),
+    order_id uuid,
+    reference_id uuid,
+    provider_payment_id text,
+    description text NOT NULL,
+    expires_at timestamp,
+    created_by uuid,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wallet_transactions_wallet_id_idx ON wallet_transactions (wallet_id, created_at);
+
+CREATE FUNCTION forbid_wallet_transaction_changes() RETURNS trigger AS $$
+BEGIN
+    -- Wallets deleted with their customer take their history along
+    IF TG_OP = 'DELETE' AND NOT EXISTS (SELECT 1 FROM wallets WHERE id = OLD.wallet_id) THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'wallet transactions are append-only, record a new one instead';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER wallet_transactions_append_only
+    BEFORE UPDATE OR DELETE ON wallet_transactions
+    FOR EACH ROW EXECUTE FUNCTION forbid_wallet_transaction_changes();
+
+-- What is left of each promotional credit until it expires, payments spend
+-- the credit that expires first before the rest of the balance
+CREATE TABLE wallet_credits (
+    id uuid PRIMARY KEY,
+    wallet_id uuid NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    transaction_id uuid NOT NULL REFERENCES wallet_transactions(id) ON DELETE CASCADE,
+    amount decimal(13, 3) NOT NULL CHECK (amount > 0),
+    remaining decimal(13, 3) NOT NULL CHECK (remaining >= 0 AND remaining <= amount),
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wallet_credits_wallet_id_idx ON wallet_credits (wallet_id, expires_at);
+
+-- Orders can be paid from the wallet, wholly or in part. wallet_paid is what
+-- checkout took from it, wallet_refunded what went back to it since.
+ALTER TABLE orders DROP CONSTRAINT orders_payment_type_check;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_payment_type_check CHECK (payment_type IN ('card', 'cash', 'split', 'wallet')),
+    ADD COLUMN wallet_paid decimal(13, 3) NOT NULL DEFAULT 0 CHECK (wallet_paid >= 0),
+    ADD COLUMN wallet_refunded decimal(13, 3) NOT NULL DEFAULT 0 CHECK (wallet_refunded >= 0);
+
+ALTER TABLE refunds DROP CONSTRAINT refunds_tender_check;
+ALTER TABLE refunds
+    ADD COLUMN wallet_amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (wallet_amount >= 0),
+    ADD CONSTRAINT refunds_tender_check CHECK (card_amount + cash_amount + wallet_amount <= amount);
+
+-- Customers' wallets are liabilities of the platform, promotional credit is
+-- an expense until it is spent or expires
+ALTER TABLE ledger_accounts DROP CONSTRAINT ledger_accounts_kind_check;
+ALTER TABLE ledger_accounts
+    ADD CONSTRAINT ledger_accounts_kind_check CHECK (kind IN ('asset', 'liability', 'revenue', 'expense'));
+
+ALTER TABLE journal_entries DROP CONSTRAINT journal_entries_kind_check;
+ALTER TABLE journal_entries
+    ADD CONSTRAINT journal_entries_kind_check
+    CHECK (kind IN ('order_payment', 'refund', 'payout', 'wallet_top_up', 'wallet_promotion', 'wallet_expiry'));
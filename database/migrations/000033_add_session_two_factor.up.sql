@@ -0,0 +1,3 @@
+-- Sessions of accounts with 2FA enabled are only accepted once a second
+-- factor was checked. Older sessions can't tell, their users log in again.
+ALTER TABLE sessions ADD COLUMN two_factor_verified boolean NOT NULL DEFAULT false;
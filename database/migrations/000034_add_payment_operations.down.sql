@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS payment_webhook_events;
+DROP TABLE IF EXISTS payment_operations;
+
+-- Checkouts the provider never answered have no payment to keep
+DELETE FROM payment_intents WHERE provider_payment_id IS NULL;
+UPDATE payment_intents SET status = 'failed' WHERE status = 'pending';
+
+ALTER TABLE payment_intents DROP CONSTRAINT payment_intents_status_check;
+ALTER TABLE payment_intents
+    ADD CONSTRAINT payment_intents_status_check CHECK (status IN ('authorized', 'captured', 'refunded', 'voided', 'failed')),
+    ALTER COLUMN provider_payment_id SET NOT NULL,
+    DROP COLUMN IF EXISTS payment_method;
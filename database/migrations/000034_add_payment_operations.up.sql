@@ -0,0 +1,36 @@
+-- The payment provider is only called once the transaction that decided the
+-- call committed. Checkout stores the card payment as a pending intent with
+-- the card token and places the order once the provider authorized it.
+-- Captures, voids and refunds are stored as pending operations whose id is
+-- the idempotency key sent to the provider, they are settled by the request
+-- that made them, the webhook or `resturant settle-payments`, whichever hears
+-- back from the provider first.
+ALTER TABLE payment_intents DROP CONSTRAINT payment_intents_status_check;
+ALTER TABLE payment_intents
+    ADD CONSTRAINT payment_intents_status_check CHECK (status IN ('pending', 'authorized', 'captured', 'refunded', 'voided', 'failed')),
+    ALTER COLUMN provider_payment_id DROP NOT NULL,
+    ADD COLUMN payment_method varchar(100);
+
+CREATE TABLE payment_operations (
+    id uuid PRIMARY KEY,
+    payment_intent_id uuid NOT NULL REFERENCES payment_intents(id) ON DELETE CASCADE,
+    kind varchar(10) NOT NULL CHECK (kind IN ('capture', 'void', 'refund')),
+    amount decimal(13, 3) NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    status varchar(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'declined')),
+    decline_reason varchar(100),
+    created_at timestamp NOT NULL DEFAULT NOW(),
+    settled_at timestamp
+);
+
+CREATE INDEX payment_operations_payment_intent_id_idx ON payment_operations (payment_intent_id);
+CREATE INDEX payment_operations_pending_idx ON payment_operations (created_at) WHERE status = 'pending';
+
+-- The webhook events that were applied, providers deliver them at least once
+CREATE TABLE payment_webhook_events (
+    provider varchar(20) NOT NULL,
+    event_id varchar(100) NOT NULL,
+    type varchar(50) NOT NULL,
+    payment_id varchar(100) NOT NULL,
+    received_at timestamp NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
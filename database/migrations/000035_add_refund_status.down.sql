@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS payment_operations_refund_id_idx;
+ALTER TABLE payment_operations DROP COLUMN IF EXISTS refund_id;
+ALTER TABLE refunds DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+-- A refund is stored before the card part of it is asked for at the
+-- provider, as a payment operation that keeps the refund it belongs to and is
+-- sent with the refund id as idempotency key. The refund stays pending until
+-- the provider answered, a card refund the provider declines goes to the
+-- customer's wallet instead.
+ALTER TABLE refunds
+    ADD COLUMN status varchar(10) NOT NULL DEFAULT 'refunded' CHECK (status IN ('pending', 'refunded'));
+
+ALTER TABLE payment_operations ADD COLUMN refund_id uuid REFERENCES refunds(id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX payment_operations_refund_id_idx ON payment_operations (refund_id);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS ledger_accounts_append_only ON ledger_accounts;
+DROP TRIGGER IF EXISTS ledger_postings_no_truncate ON ledger_postings;
+DROP TRIGGER IF EXISTS journal_entries_no_truncate ON journal_entries;
@@ -0,0 +1,15 @@
+-- The row triggers of 000030 don't fire on TRUNCATE, which would empty the
+-- ledger at once, and accounts could still be moved to another owner or
+-- currency under their postings. `resturant ledger-check` reports any of
+-- these triggers that was disabled or dropped.
+CREATE TRIGGER journal_entries_no_truncate
+    BEFORE TRUNCATE ON journal_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION forbid_ledger_changes();
+
+CREATE TRIGGER ledger_postings_no_truncate
+    BEFORE TRUNCATE ON ledger_postings
+    FOR EACH STATEMENT EXECUTE FUNCTION forbid_ledger_changes();
+
+CREATE TRIGGER ledger_accounts_append_only
+    BEFORE UPDATE ON ledger_accounts
+    FOR EACH ROW EXECUTE FUNCTION forbid_ledger_changes();
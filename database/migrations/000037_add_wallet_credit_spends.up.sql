@@ -0,0 +1,10 @@
+-- What each wallet payment took from each promotional credit, so refunding
+-- the payment gives the credit back with its expiry instead of as regular
+-- balance. restored is how much of it went back to the credit since.
+CREATE TABLE wallet_credit_spends (
+    transaction_id uuid NOT NULL REFERENCES wallet_transactions(id) ON DELETE CASCADE,
+    credit_id uuid NOT NULL REFERENCES wallet_credits(id) ON DELETE CASCADE,
+    amount decimal(13, 3) NOT NULL CHECK (amount > 0),
+    restored decimal(13, 3) NOT NULL DEFAULT 0 CHECK (restored >= 0 AND restored <= amount),
+    PRIMARY KEY (transaction_id, credit_id)
+);
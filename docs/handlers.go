@@ -0,0 +1,40 @@
+package docs
+
+import (
+	"embed"
+	"net/http"
+	"resturant/utils"
+	"sync"
+)
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// swaggerAssets holds the Swagger UI 5.18.2 bundle (Apache License 2.0) so
+// the docs page doesn't load scripts from a CDN
+//
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var swaggerAssets embed.FS
+
+var (
+	specOnce sync.Once
+	spec     *Document
+)
+
+// ServeSpec serves the OpenAPI document as JSON
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	specOnce.Do(func() {
+		spec = Build()
+	})
+	utils.SendJSONResponse(w, http.StatusOK, spec)
+}
+
+// ServeUI serves the Swagger UI page that renders /openapi.json
+func ServeUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(swaggerUI)
+}
+
+// ServeAssets serves the Swagger UI script and stylesheet under /docs/
+var ServeAssets = http.StripPrefix("/docs/", http.FileServerFS(swaggerAssets))
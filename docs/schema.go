@@ -0,0 +1,176 @@
+package docs
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"resturant/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	uuidType  = reflect.TypeOf(uuid.UUID{})
+	moneyType = reflect.TypeOf(models.Money{})
+)
+
+// schemaRegistry collects the component schemas referenced while building the spec
+type schemaRegistry map[string]*Schema
+
+// ref returns a schema for the given value, registering named structs as
+// components and referencing them with $ref
+func (reg schemaRegistry) ref(v interface{}) *Schema {
+	return reg.schemaFor(reflect.TypeOf(v))
+}
+
+func (reg schemaRegistry) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case moneyType:
+		return money()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: reg.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: reg.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return reg.structSchema(t)
+		}
+		if _, ok := reg[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			reg[t.Name()] = &Schema{}
+			*reg[t.Name()] = *reg.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+// structSchema describes the json encoding of a struct
+func (reg schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := reg.structSchema(field.Type)
+			for key, prop := range embedded.Properties {
+				schema.Properties[key] = prop
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := reg.schemaFor(field.Type)
+		schema.Properties[name] = prop
+
+		// Request DTOs (fields with a form tag) are required by their validate
+		// rules, everything else by its json encoding
+		if _, isRequest := field.Tag.Lookup("form"); isRequest {
+			if applyRules(prop, field.Tag.Get("validate")) {
+				schema.Required = append(schema.Required, name)
+			}
+		} else if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// applyRules documents the utils.Validate rules of a field on its schema and
+// reports whether the field is required
+func applyRules(prop *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "required":
+			required = true
+		case "email":
+			prop.Format = "email"
+		case "e164":
+			prop.Pattern = `^\+[1-9][0-9]{1,14}$`
+		case "currency":
+			prop.Pattern = `^[A-Z]{3}$`
+		case "password":
+			minLength := 8
+			prop.MinLength = &minLength
+			prop.Description = "At least 8 characters with upper case and lower case letters and a digit"
+		case "min", "max":
+			if prop.Type != "string" || prop.Format == "decimal" {
+				continue
+			}
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+			if rule == "min" {
+				prop.MinLength = &n
+			} else {
+				prop.MaxLength = &n
+			}
+		case "oneof":
+			prop.Enum = strings.Fields(arg)
+		}
+	}
+	return required
+}
+
+// object builds an inline object schema from property name/schema pairs
+func object(props map[string]*Schema) *Schema {
+	return &Schema{Type: "object", Properties: props}
+}
+
+func str() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func uuidStr() *Schema {
+	return &Schema{Type: "string", Format: "uuid"}
+}
+
+func dateTime() *Schema {
+	return &Schema{Type: "string", Format: "date-time"}
+}
+
+// money documents models.Money, numbers are accepted in requests too
+func money() *Schema {
+	return &Schema{Type: "string", Format: "decimal", Pattern: `^-?[0-9]+(\.[0-9]+)?$`, Description: "Amount in the currency's major unit, e.g. \"12.50\""}
+}
+
+func binary() *Schema {
+	return &Schema{Type: "string", Format: "binary"}
+}
@@ -0,0 +1,1380 @@
+package docs
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"resturant/models"
+	"resturant/payments"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// endpoint describes one registered route of the API
+type endpoint struct {
+	Summary string
+	Tag     string
+	// Auth marks endpoints that need a session bearer token
+	Auth bool
+	// Permission is the permission the caller's roles must grant, it implies Auth
+	Permission string
+	// Request is the request DTO the handler decodes, accepted as JSON and as a form
+	Request interface{}
+	// Files lists the file fields accepted when the body is sent as multipart/form-data
+	Files []string
+	// Query lists the query string parameters the handler reads
+	Query []Parameter
+	// Status is the status code of a successful response
+	Status int
+	// Response is either an inline *Schema or a value whose type describes the body
+	Response interface{}
+	// OtherResponses describes other successful answers by status code
+	OtherResponses map[int]interface{}
+	// Errors lists the error status codes the handler may answer with
+	Errors []int
+}
+
+var messageResponse = object(map[string]*Schema{"message": str()})
+
+var orderStatuses = []string{
+	models.OrderStatusPlaced, models.OrderStatusAccepted, models.OrderStatusPreparing,
+	models.OrderStatusReady, models.OrderStatusCompleted, models.OrderStatusCancelled,
+}
+
+var applicationStatuses = []string{
+	models.ApplicationStatusPending, models.ApplicationStatusApproved, models.ApplicationStatusRejected,
+}
+
+// endpoints is keyed by the full route pattern as registered in main.go.
+// Every registered route must have an entry here, see Check.
+var endpoints = map[string]endpoint{
+	"POST /customer/signup": {
+		Summary:  "Sign up a new customer",
+		Tag:      "customer",
+		Request:  models.SignupRequest{},
+		Files:    []string{"img"},
+		Status:   http.StatusCreated,
+		Response: models.UserResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /customer/login": {
+		Summary:  "Log in as a customer",
+		Tag:      "customer",
+		Request:  models.LoginRequest{},
+		Status:   http.StatusOK,
+		Response: models.UserLoginResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.TwoFactorChallengeResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	"PUT /customer/update/{id}": {
+		Summary:  "Update a customer's name and image, your own unless you hold users:manage",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.UpdateUserRequest{},
+		Files:    []string{"img"},
+		Status:   http.StatusOK,
+		Response: models.UserResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /customer/delete/{id}": {
+		Summary:  "Delete a customer, your own account unless you hold users:manage",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /customer/users": {
+		Summary:    "List all users",
+		Tag:        "customer",
+		Permission: "users:manage",
+		Status:     http.StatusOK,
+		Response:   []models.UserResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /admin/signup": {
+		Summary:    "Create a new admin directly",
+		Tag:        "admin",
+		Permission: "admins:manage",
+		Request:    models.SignupRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusCreated,
+		Response:   models.AdminResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /admin/invitations": {
+		Summary:    "Email an invitation to become an admin",
+		Tag:        "admin",
+		Permission: "admins:manage",
+		Request:    models.InviteAdminRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.AdminInvitationResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /admin/accept-invitation": {
+		Summary:  "Create an admin account from an invitation token",
+		Tag:      "admin",
+		Request:  models.AcceptInvitationRequest{},
+		Status:   http.StatusCreated,
+		Response: models.AdminResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /admin/admins": {
+		Summary:    "List admins",
+		Tag:        "admin",
+		Permission: "admins:manage",
+		Status:     http.StatusOK,
+		Response:   []models.AdminResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"DELETE /admin/admins/{id}/role": {
+		Summary:    "Revoke the admin role of a user and end their sessions",
+		Tag:        "admin",
+		Permission: "admins:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /admin/login": {
+		Summary:  "Log in as an admin",
+		Tag:      "admin",
+		Request:  models.LoginRequest{},
+		Status:   http.StatusOK,
+		Response: models.AdminLoginResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.TwoFactorChallengeResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	"POST /admin/add-vendor": {
+		Summary:    "Add a vendor",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Request:    models.AddVendorRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusCreated,
+		Response:   models.VendorResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /admin/update-vendor/{id}": {
+		Summary:    "Update a vendor",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Request:    models.UpdateVendorRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusOK,
+		Response:   models.VendorResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /admin/delete/{id}": {
+		Summary:    "Delete a vendor and all its data",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/list-vendors": {
+		Summary:    "List all vendors",
+		Tag:        "admin",
+		Permission: "vendors:read",
+		Status:     http.StatusOK,
+		Response:   []models.VendorResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/vendor/{id}": {
+		Summary:    "Get a vendor by id",
+		Tag:        "admin",
+		Permission: "vendors:read",
+		Status:     http.StatusOK,
+		Response:   models.VendorResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/vendor-applications": {
+		Summary:    "List vendor applications, oldest first",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Query: []Parameter{
+			{Name: "status", In: "query", Schema: &Schema{Type: "string", Enum: applicationStatuses, Description: "Defaults to pending"}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.VendorApplicationResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/vendor-applications/{id}": {
+		Summary:    "Get a vendor application",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Status:     http.StatusOK,
+		Response:   models.VendorApplicationResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/vendor-applications/{id}/documents/{document_id}": {
+		Summary:    "Download a document attached to a vendor application",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Status:     http.StatusOK,
+		Response:   binary(),
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /admin/vendor-applications/{id}/approve": {
+		Summary:    "Approve a pending application and create the vendor account",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Status:     http.StatusOK,
+		Response:   models.VendorApplicationResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /admin/vendor-applications/{id}/reject": {
+		Summary:    "Reject a pending application with a reason sent to the applicant",
+		Tag:        "admin",
+		Permission: "vendors:manage",
+		Request:    models.RejectVendorApplicationRequest{},
+		Status:     http.StatusOK,
+		Response:   models.VendorApplicationResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendors/nearby": {
+		Summary: "List the vendors around a point, closest first",
+		Tag:     "vendors",
+		Query: []Parameter{
+			{Name: "lat", In: "query", Required: true, Schema: &Schema{Type: "number", Format: "double"}},
+			{Name: "lng", In: "query", Required: true, Schema: &Schema{Type: "number", Format: "double"}},
+			{Name: "radius", In: "query", Schema: &Schema{Type: "number", Format: "double", Description: "Search radius in km, 5 by default and 50 at most"}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.NearbyVendorResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /vendors/{id}/delivery": {
+		Summary: "Tell whether a vendor delivers to a point and for how much",
+		Tag:     "vendors",
+		Query: []Parameter{
+			{Name: "lat", In: "query", Required: true, Schema: &Schema{Type: "number", Format: "double"}},
+			{Name: "lng", In: "query", Required: true, Schema: &Schema{Type: "number", Format: "double"}},
+			{Name: "subtotal", In: "query", Schema: &Schema{Type: "string", Format: "decimal", Description: "Order value in the vendor's currency, zones whose minimum order it misses are skipped"}},
+		},
+		Status:   http.StatusOK,
+		Response: models.DeliveryQuoteResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /search": {
+		Summary: "Search menu items and vendors",
+		Tag:     "vendors",
+		Query: []Parameter{
+			{Name: "q", In: "query", Required: true, Schema: &Schema{Type: "string", Description: "Words to look for, supports \"quoted phrases\", or and -excluded words"}},
+			{Name: "min_price", In: "query", Schema: money()},
+			{Name: "max_price", In: "query", Schema: money()},
+			{Name: "currency", In: "query", Schema: &Schema{Type: "string", Pattern: `^[A-Z]{3}$`, Description: "Only vendors pricing in this currency"}},
+			{Name: "vendor_id", In: "query", Schema: uuidStr()},
+			{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Format: "int32", Description: "Results per kind, 20 by default and 50 at most"}},
+		},
+		Status:   http.StatusOK,
+		Response: models.SearchResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /payments/webhook": {
+		Summary: "Receive the payment changes notified by the payment provider",
+		Tag:     "payments",
+		Query: []Parameter{
+			{Name: "Payment-Signature", In: "header", Required: true, Schema: &Schema{Type: "string", Description: "Signature of the raw body by the provider"}},
+		},
+		Request:  payments.Event{},
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /auth/logout": {
+		Summary:  "Revoke the current session",
+		Tag:      "auth",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	"POST /auth/forgot-password": {
+		Summary:  "Email a single-use password reset token",
+		Tag:      "auth",
+		Request:  models.ForgotPasswordRequest{},
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /auth/reset-password": {
+		Summary:  "Set a new password with a reset token and revoke all sessions",
+		Tag:      "auth",
+		Request:  models.ResetPasswordRequest{},
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /auth/change-password": {
+		Summary:  "Change the password, revoking all sessions and starting a new one",
+		Tag:      "auth",
+		Auth:     true,
+		Request:  models.ChangePasswordRequest{},
+		Status:   http.StatusOK,
+		Response: models.SessionResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /auth/verify-email": {
+		Summary:  "Confirm an email address with the emailed token",
+		Tag:      "auth",
+		Request:  models.VerifyEmailRequest{},
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /auth/resend-verification": {
+		Summary:  "Send the email verification token again (throttled)",
+		Tag:      "auth",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	"GET /customer/cart": {
+		Summary:  "Get the current cart",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.CartResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /customer/cart/items": {
+		Summary:  "Set the quantity of an item in the cart, 0 removes it",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.CartItemRequest{},
+		Status:   http.StatusOK,
+		Response: models.CartResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /customer/cart/items/{item_id}": {
+		Summary:  "Remove an item from the cart",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.CartResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /customer/cart/coupon": {
+		Summary:  "Apply a coupon code to the cart",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.CouponRequest{},
+		Status:   http.StatusOK,
+		Response: models.CartResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /customer/cart/coupon": {
+		Summary:  "Remove the coupon from the cart",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.CartResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /customer/addresses": {
+		Summary:  "List the saved delivery addresses, the default first",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.CustomerAddress{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /customer/addresses": {
+		Summary:  "Save a delivery address, the first one becomes the default",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.AddressRequest{},
+		Status:   http.StatusCreated,
+		Response: models.CustomerAddress{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /customer/addresses/{id}": {
+		Summary:  "Replace a saved address, past orders keep the old one",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.AddressRequest{},
+		Status:   http.StatusOK,
+		Response: models.CustomerAddress{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /customer/addresses/{id}/default": {
+		Summary:  "Make a saved address the default one",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.CustomerAddress{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /customer/addresses/{id}": {
+		Summary:  "Delete a saved address",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /customer/checkout": {
+		Summary:  "Place an order with the items of the cart",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.CheckoutRequest{},
+		Status:   http.StatusCreated,
+		Response: models.OrderResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError, http.StatusBadGateway},
+	},
+	"GET /customer/wallet": {
+		Summary:  "List the customer's wallets, one per currency, with their promotional credit",
+		Tag:      "customer",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.Wallet{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /customer/wallet/transactions": {
+		Summary: "List the transactions of the customer's wallets, newest first",
+		Tag:     "customer",
+		Auth:    true,
+		Query: []Parameter{
+			{Name: "currency", In: "query", Schema: &Schema{Type: "string"}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.WalletTransaction{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /customer/wallet/top-ups": {
+		Summary:  "Charge the card and add the amount to the wallet",
+		Tag:      "customer",
+		Auth:     true,
+		Request:  models.WalletTopUpRequest{},
+		Status:   http.StatusCreated,
+		Response: models.WalletTransactionResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusInternalServerError, http.StatusBadGateway},
+	},
+	"PUT /admin/users/{id}/require-2fa": {
+		Summary:    "Enforce or stop enforcing two-factor authentication on an account",
+		Tag:        "admin",
+		Permission: "users:manage",
+		Request:    models.RequireTwoFactorRequest{},
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /vendor/login": {
+		Summary:  "Log in as a vendor",
+		Tag:      "vendor",
+		Request:  models.LoginRequest{},
+		Status:   http.StatusOK,
+		Response: models.VendorLoginResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.TwoFactorChallengeResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	"POST /auth/2fa/verify": {
+		Summary:  "Trade a login challenge and an authenticator or recovery code for a session",
+		Tag:      "auth",
+		Request:  models.VerifyLoginRequest{},
+		Status:   http.StatusOK,
+		Response: models.SessionResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	"POST /auth/2fa/enroll": {
+		Summary:  "Start enrolling an authenticator app",
+		Tag:      "auth",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.TwoFactorEnrollmentResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /auth/2fa/confirm": {
+		Summary:  "Enable two-factor authentication with a first code and get recovery codes",
+		Tag:      "auth",
+		Auth:     true,
+		Request:  models.TwoFactorCodeRequest{},
+		Status:   http.StatusOK,
+		Response: models.RecoveryCodesResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /auth/2fa/recovery-codes": {
+		Summary:  "Replace the recovery codes",
+		Tag:      "auth",
+		Auth:     true,
+		Request:  models.TwoFactorCodeRequest{},
+		Status:   http.StatusOK,
+		Response: models.RecoveryCodesResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /auth/2fa/disable": {
+		Summary:  "Disable two-factor authentication",
+		Tag:      "auth",
+		Auth:     true,
+		Request:  models.DisableTwoFactorRequest{},
+		Status:   http.StatusOK,
+		Response: messageResponse,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/permissions": {
+		Summary:    "List the permissions roles can grant",
+		Tag:        "admin",
+		Permission: "roles:manage",
+		Status:     http.StatusOK,
+		Response:   []models.Permission{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/roles": {
+		Summary:    "List the built-in roles with their permissions",
+		Tag:        "admin",
+		Permission: "roles:manage",
+		Status:     http.StatusOK,
+		Response:   []models.RoleResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /admin/roles/{id}/permissions": {
+		Summary:    "Replace the permissions of a built-in role",
+		Tag:        "admin",
+		Permission: "roles:manage",
+		Request:    models.RolePermissionsRequest{},
+		Status:     http.StatusOK,
+		Response:   models.RoleResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /admin/exchange-rates": {
+		Summary:    "List the exchange rates to the base currency",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   []models.ExchangeRateResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /admin/exchange-rates/{currency}": {
+		Summary:    "Set how many units of the base currency one unit of a currency is worth",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.ExchangeRateRequest{},
+		Status:     http.StatusOK,
+		Response:   models.ExchangeRateResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"DELETE /admin/exchange-rates/{currency}": {
+		Summary:    "Delete the exchange rate of a currency",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/reports/sales": {
+		Summary:    "Sum the orders of a period per currency and in the base currency",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "from", In: "query", Schema: &Schema{Type: "string", Format: "date", Description: "First day included"}},
+			{Name: "to", In: "query", Schema: &Schema{Type: "string", Format: "date", Description: "Last day included"}},
+		},
+		Status:   http.StatusOK,
+		Response: models.SalesReportResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/reports/reconciliation": {
+		Summary:    "List the completed and cancelled orders of a period whose payments don't match their total",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "from", In: "query", Schema: &Schema{Type: "string", Format: "date", Description: "First day included"}},
+			{Name: "to", In: "query", Schema: &Schema{Type: "string", Format: "date", Description: "Last day included"}},
+		},
+		Status:   http.StatusOK,
+		Response: models.ReconciliationReportResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/ledger/accounts": {
+		Summary:    "List the ledger accounts with their balance on their normal side",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "owner_type", In: "query", Schema: &Schema{Type: "string", Enum: []string{models.LedgerOwnerPlatform, models.LedgerOwnerVendor, models.LedgerOwnerCustomer}}},
+			{Name: "owner_id", In: "query", Schema: &Schema{Type: "string", Format: "uuid"}},
+			{Name: "currency", In: "query", Schema: &Schema{Type: "string", Description: "ISO 4217 code"}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.LedgerAccount{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/ledger/accounts/{id}/postings": {
+		Summary:    "List the postings of a ledger account, newest first",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   []models.AccountPostingResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/ledger/entries": {
+		Summary:    "List the latest 100 journal entries with their postings",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "order_id", In: "query", Schema: &Schema{Type: "string", Format: "uuid"}},
+			{Name: "kind", In: "query", Schema: &Schema{Type: "string", Enum: []string{models.EntryOrderPayment, models.EntryRefund, models.EntryPayout, models.EntryWalletTopUp, models.EntryWalletPromotion, models.EntryWalletExpiry}}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.JournalEntry{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/ledger/check": {
+		Summary:    "Check that the ledger balances, is append-only and matches the orders, refunds, wallets and payouts",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   models.LedgerCheckResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/vendors/{id}/commission": {
+		Summary:    "Get the commission percentage and fixed fee a vendor pays",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   models.VendorCommissionResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /admin/vendors/{id}/commission": {
+		Summary:    "Set the commission of a vendor, without a percent the platform's applies",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.VendorCommissionRequest{},
+		Status:     http.StatusOK,
+		Response:   models.VendorCommissionResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /admin/vendors/{id}/currency": {
+		Summary:    "Change the currency a vendor prices its menu in",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.VendorCurrencyRequest{},
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /admin/payouts": {
+		Summary:    "List the payout statements, newest first",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "vendor_id", In: "query", Schema: &Schema{Type: "string", Format: "uuid"}},
+			{Name: "status", In: "query", Schema: &Schema{Type: "string", Enum: []string{models.PayoutPending, models.PayoutApproved, models.PayoutPaid}}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.Payout{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /admin/payouts": {
+		Summary:    "Generate the pending payout statements of every vendor, or one, up to the end of a day",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.GeneratePayoutsRequest{},
+		Status:     http.StatusCreated,
+		Response:   []models.Payout{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /admin/payouts/{id}": {
+		Summary:    "Get a payout statement with its lines per order",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   models.Payout{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /admin/payouts/{id}/approve": {
+		Summary:    "Approve a pending payout for payment",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   models.Payout{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /admin/payouts/{id}/paid": {
+		Summary:    "Mark an approved payout as paid and record it in the ledger",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.PayoutPaidRequest{},
+		Status:     http.StatusOK,
+		Response:   models.Payout{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /admin/customers/{id}/wallet": {
+		Summary:    "List the wallets of a customer with their promotional credit",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   []models.Wallet{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/customers/{id}/wallet/transactions": {
+		Summary:    "List the transactions of a customer's wallets, newest first",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Query: []Parameter{
+			{Name: "currency", In: "query", Schema: &Schema{Type: "string"}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.WalletTransaction{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/tax-jurisdictions": {
+		Summary:    "List the tax jurisdictions with their rates",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   []models.TaxJurisdiction{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /admin/tax-jurisdictions": {
+		Summary:    "Create a tax jurisdiction with its food, alcohol and delivery rates",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.TaxJurisdictionRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.TaxJurisdiction{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /admin/tax-jurisdictions/{id}": {
+		Summary:    "Update a tax jurisdiction and replace its rates",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.TaxJurisdictionRequest{},
+		Status:     http.StatusOK,
+		Response:   models.TaxJurisdiction{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /admin/tax-jurisdictions/{id}": {
+		Summary:    "Delete a tax jurisdiction, its vendors stop charging tax",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /admin/vendors/{id}/tax-jurisdiction": {
+		Summary:    "Assign the tax jurisdiction of a vendor, null to charge no tax",
+		Tag:        "admin",
+		Permission: "finance:manage",
+		Request:    models.VendorTaxJurisdictionRequest{},
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/promotions": {
+		Summary:    "List every promotion, newest first",
+		Tag:        "admin",
+		Permission: "promotions:manage",
+		Status:     http.StatusOK,
+		Response:   []models.Promotion{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /admin/promotions": {
+		Summary:    "Create a promotion, platform-wide unless a vendor_id is given",
+		Tag:        "admin",
+		Permission: "promotions:manage",
+		Request:    models.PromotionRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.Promotion{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /admin/promotions/{id}": {
+		Summary:    "Replace a promotion",
+		Tag:        "admin",
+		Permission: "promotions:manage",
+		Request:    models.PromotionRequest{},
+		Status:     http.StatusOK,
+		Response:   models.Promotion{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /admin/promotions/{id}": {
+		Summary:    "Delete a promotion, orders placed with it keep their discount",
+		Tag:        "admin",
+		Permission: "promotions:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /admin/customers/{id}/wallet/credits": {
+		Summary:    "Give a customer promotional wallet credit that expires",
+		Tag:        "admin",
+		Permission: "promotions:manage",
+		Request:    models.WalletPromotionRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.WalletTransactionResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /admin/orders/{id}/refunds": {
+		Summary:    "List the refunds of any order, oldest first",
+		Tag:        "admin",
+		Permission: "refunds:manage",
+		Status:     http.StatusOK,
+		Response:   []models.Refund{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /admin/orders/{id}/refunds": {
+		Summary:    "Cancel and refund lines of any order, by quantity, or the whole order",
+		Tag:        "admin",
+		Permission: "refunds:manage",
+		Request:    models.RefundRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.RefundResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.RefundResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendor/roles": {
+		Summary:    "List the roles the vendor can give its staff",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Status:     http.StatusOK,
+		Response:   []models.RoleResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/roles": {
+		Summary:    "Create a custom staff role",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Request:    models.RoleRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.RoleResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /vendor/roles/{id}": {
+		Summary:    "Rename a custom staff role and replace its permissions",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Request:    models.RoleRequest{},
+		Status:     http.StatusOK,
+		Response:   models.RoleResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/roles/{id}": {
+		Summary:    "Delete a custom staff role nobody holds",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /vendor/staff/accept-invitation": {
+		Summary:  "Create a staff account from an invitation token",
+		Tag:      "vendor",
+		Request:  models.AcceptInvitationRequest{},
+		Status:   http.StatusCreated,
+		Response: models.UserResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /vendor/apply": {
+		Summary:  "Apply to become a vendor, documents may be repeated",
+		Tag:      "vendor",
+		Request:  models.VendorApplicationRequest{},
+		Files:    []string{"img", "documents"},
+		Status:   http.StatusCreated,
+		Response: models.VendorApplicationResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendor/profile": {
+		Summary:  "Get the vendor's public profile",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.VendorResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /vendor/profile": {
+		Summary:    "Update the vendor's public profile",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Request:    models.UpdateVendorProfileRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusOK,
+		Response:   models.VendorResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /vendor/hours": {
+		Summary:  "Get the vendor's time zone and weekly opening hours",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: models.OpeningHoursResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /vendor/hours": {
+		Summary:    "Replace the vendor's time zone and weekly opening hours",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Request:    models.OpeningHoursRequest{},
+		Status:     http.StatusOK,
+		Response:   models.OpeningHoursResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /vendor/closures": {
+		Summary:  "List the vendor's closures from today on",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.VendorClosure{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/closures": {
+		Summary:    "Close the vendor for a whole day",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Request:    models.ClosureRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.VendorClosure{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/closures/{id}": {
+		Summary:    "Remove a closure",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/delivery-zones": {
+		Summary:  "List the vendor's delivery zones",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.DeliveryZone{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/delivery-zones": {
+		Summary:    "Add a delivery zone",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Request:    models.DeliveryZoneRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.DeliveryZone{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /vendor/delivery-zones/{id}": {
+		Summary:    "Replace a delivery zone",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Request:    models.DeliveryZoneRequest{},
+		Status:     http.StatusOK,
+		Response:   models.DeliveryZone{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/delivery-zones/{id}": {
+		Summary:    "Remove a delivery zone",
+		Tag:        "vendor",
+		Permission: "profile:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/items": {
+		Summary:  "List the vendor's menu",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.Item{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/items": {
+		Summary:    "Add a menu item",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Request:    models.ItemRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusCreated,
+		Response:   models.Item{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"PUT /vendor/items/{id}": {
+		Summary:    "Update a menu item",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Request:    models.UpdateItemRequest{},
+		Files:      []string{"img"},
+		Status:     http.StatusOK,
+		Response:   models.Item{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/items/{id}": {
+		Summary:    "Remove a menu item, past orders keep it",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/promotions": {
+		Summary:  "List the vendor's promotions, newest first",
+		Tag:      "vendor",
+		Auth:     true,
+		Status:   http.StatusOK,
+		Response: []models.Promotion{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/promotions": {
+		Summary:    "Create a promotion of the vendor",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Request:    models.PromotionRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.Promotion{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /vendor/promotions/{id}": {
+		Summary:    "Replace one of the vendor's promotions",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Request:    models.PromotionRequest{},
+		Status:     http.StatusOK,
+		Response:   models.Promotion{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/promotions/{id}": {
+		Summary:    "Delete one of the vendor's promotions",
+		Tag:        "vendor",
+		Permission: "menu:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/orders": {
+		Summary:    "List the vendor's orders, newest first",
+		Tag:        "vendor",
+		Permission: "orders:read",
+		Query: []Parameter{
+			{Name: "status", In: "query", Schema: &Schema{Type: "string", Enum: orderStatuses}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.OrderResponse{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /vendor/orders/{id}": {
+		Summary:    "Get one of the vendor's orders",
+		Tag:        "vendor",
+		Permission: "orders:read",
+		Status:     http.StatusOK,
+		Response:   models.OrderResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /vendor/orders/{id}/status": {
+		Summary:    "Move an order to its next status",
+		Tag:        "vendor",
+		Permission: "orders:update",
+		Request:    models.OrderStatusRequest{},
+		Status:     http.StatusOK,
+		Response:   models.OrderResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.OrderResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendor/orders/{id}/balance": {
+		Summary:    "Reconcile what an order was paid by card and in cash with what it owes",
+		Tag:        "vendor",
+		Permission: "orders:read",
+		Status:     http.StatusOK,
+		Response:   models.OrderBalanceResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /vendor/orders/{id}/cash": {
+		Summary:    "Record the cash a customer handed over for an order and the change given",
+		Tag:        "vendor",
+		Permission: "payments:collect",
+		Request:    models.CashPaymentRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.CashPaymentResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendor/orders/{id}/refunds": {
+		Summary:    "List the refunds of one of the vendor's orders, oldest first",
+		Tag:        "vendor",
+		Permission: "orders:read",
+		Status:     http.StatusOK,
+		Response:   []models.Refund{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /vendor/orders/{id}/refunds": {
+		Summary:    "Cancel and refund lines of one of the vendor's orders, by quantity, or the whole order",
+		Tag:        "vendor",
+		Permission: "orders:refund",
+		Request:    models.RefundRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.RefundResponse{},
+		OtherResponses: map[int]interface{}{
+			http.StatusAccepted: models.RefundResponse{},
+		},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /vendor/commission": {
+		Summary:    "Get the commission percentage and fixed fee the vendor pays",
+		Tag:        "vendor",
+		Permission: "payouts:read",
+		Status:     http.StatusOK,
+		Response:   models.VendorCommissionResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/payouts": {
+		Summary:    "List the vendor's payout statements, newest first",
+		Tag:        "vendor",
+		Permission: "payouts:read",
+		Query: []Parameter{
+			{Name: "status", In: "query", Schema: &Schema{Type: "string", Enum: []string{models.PayoutPending, models.PayoutApproved, models.PayoutPaid}}},
+		},
+		Status:   http.StatusOK,
+		Response: []models.Payout{},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /vendor/payouts/{id}": {
+		Summary:    "Get one of the vendor's payout statements with its lines per order",
+		Tag:        "vendor",
+		Permission: "payouts:read",
+		Status:     http.StatusOK,
+		Response:   models.Payout{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /vendor/staff": {
+		Summary:    "List the vendor's staff with their role",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Status:     http.StatusOK,
+		Response:   []models.StaffResponse{},
+		Errors:     []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /vendor/staff/invitations": {
+		Summary:    "Email an invitation to join the vendor's staff with a role",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Request:    models.InviteStaffRequest{},
+		Status:     http.StatusCreated,
+		Response:   models.StaffInvitationResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /vendor/staff/{id}/role": {
+		Summary:    "Give a staff member another role",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Request:    models.StaffRoleRequest{},
+		Status:     http.StatusOK,
+		Response:   models.StaffResponse{},
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /vendor/staff/{id}": {
+		Summary:    "Remove a staff member and end their sessions",
+		Tag:        "vendor",
+		Permission: "staff:manage",
+		Status:     http.StatusOK,
+		Response:   messageResponse,
+		Errors:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+}
+
+var pathParam = regexp.MustCompile(`{([^}.]+)(\.\.\.)?}`)
+
+// Build assembles the OpenAPI document from the endpoint descriptions
+func Build() *Document {
+	reg := schemaRegistry{}
+	reg["Error"] = object(map[string]*Schema{
+		"massage": str(),
+		"errors":  {Type: "object", Description: "Per-field validation errors", AdditionalProperties: str()},
+	})
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Restaurant Management System API",
+			Description: "Backend APIs for managing vendors, customers and admins.",
+			Version:     "1.0.0",
+		},
+		Paths: map[string]PathItem{},
+	}
+
+	for pattern, ep := range endpoints {
+		method, path, _ := strings.Cut(pattern, " ")
+		op := &Operation{
+			Summary:   ep.Summary,
+			Responses: map[string]Response{},
+		}
+		if ep.Tag != "" {
+			op.Tags = []string{ep.Tag}
+		}
+		if ep.Auth || ep.Permission != "" {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+		if ep.Permission != "" {
+			op.Description = fmt.Sprintf("Requires the `%s` permission.", ep.Permission)
+		}
+
+		for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: str()})
+		}
+		op.Parameters = append(op.Parameters, ep.Query...)
+
+		if ep.Request != nil {
+			op.RequestBody = requestBody(reg, ep.Request, ep.Files)
+		}
+
+		op.Responses[strconv.Itoa(ep.Status)] = response(reg, ep.Status, ep.Response)
+		for status, body := range ep.OtherResponses {
+			op.Responses[strconv.Itoa(status)] = response(reg, status, body)
+		}
+
+		for _, status := range ep.Errors {
+			op.Responses[strconv.Itoa(status)] = Response{
+				Description: http.StatusText(status),
+				Content:     map[string]MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+	}
+
+	doc.Components.Schemas = reg
+	doc.Components.SecuritySchemes = map[string]SecurityScheme{
+		"bearerAuth": {
+			Type:        "http",
+			Scheme:      "bearer",
+			Description: "Session token returned by the login endpoints",
+		},
+	}
+	return doc
+}
+
+// response documents a JSON response body, given as an inline *Schema or as
+// a Go value, binary() bodies are documented as a file download
+func response(reg schemaRegistry, status int, body interface{}) Response {
+	schema, ok := body.(*Schema)
+	if !ok && body != nil {
+		schema = reg.ref(body)
+	}
+	response := Response{Description: http.StatusText(status)}
+	if schema != nil {
+		contentType := "application/json"
+		if schema.Format == "binary" {
+			contentType = "application/octet-stream"
+		}
+		response.Content = map[string]MediaType{contentType: {Schema: schema}}
+	}
+	return response
+}
+
+// requestBody documents a request DTO as a JSON body and as form data,
+// multipart when the endpoint accepts files
+func requestBody(reg schemaRegistry, request interface{}, files []string) *RequestBody {
+	form := reg.structSchema(reflect.TypeOf(request))
+	formType := "application/x-www-form-urlencoded"
+	if len(files) > 0 {
+		formType = "multipart/form-data"
+		for _, name := range files {
+			form.Properties[name] = binary()
+		}
+	}
+
+	return &RequestBody{
+		Required: true,
+		Content: map[string]MediaType{
+			"application/json": {Schema: reg.ref(request)},
+			formType:           {Schema: form},
+		},
+	}
+}
+
+// sensitiveField matches property names that must never be sent to clients
+var sensitiveField = regexp.MustCompile(`(?i)password|hash`)
+
+// Route is a registered route with the guard its middlewares enforce
+type Route struct {
+	// Pattern is the full pattern, e.g. "POST /customer/signup"
+	Pattern string
+	// Auth is set when the route is behind RequireAuth
+	Auth bool
+	// Permission is the permission checked by RequirePermission, if any
+	Permission string
+}
+
+// Check compares the registered routes with the documented endpoints and
+// reports any route that is missing from the spec, documented but not served
+// or documented with another auth or permission than it is served with, as
+// well as any response body exposing a sensitive field
+func Check(routes []Route) error {
+	registered := map[string]bool{}
+	var problems []string
+	for _, route := range routes {
+		registered[route.Pattern] = true
+		e, ok := endpoints[route.Pattern]
+		if !ok {
+			problems = append(problems, "undocumented route "+route.Pattern)
+			continue
+		}
+		if auth := e.Auth || e.Permission != ""; auth != route.Auth {
+			problems = append(problems, fmt.Sprintf("%s is documented with auth %t but registered with auth %t", route.Pattern, auth, route.Auth))
+		}
+		if e.Permission != route.Permission {
+			problems = append(problems, fmt.Sprintf("%s is documented with permission %q but registered with permission %q", route.Pattern, e.Permission, route.Permission))
+		}
+	}
+	for pattern := range endpoints {
+		if !registered[pattern] {
+			problems = append(problems, "documented route is not registered "+pattern)
+		}
+	}
+
+	doc := Build()
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			for status, response := range op.Responses {
+				for _, media := range response.Content {
+					for _, field := range sensitiveFields(doc, media.Schema, map[string]bool{}) {
+						problems = append(problems, fmt.Sprintf("%s %s responds %s with sensitive field %s", strings.ToUpper(method), path, status, field))
+					}
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi spec is out of date: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sensitiveFields walks a schema, following $refs once, and returns the names
+// of properties matching sensitiveField
+func sensitiveFields(doc *Document, schema *Schema, seen map[string]bool) []string {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		return sensitiveFields(doc, doc.Components.Schemas[name], seen)
+	}
+
+	var fields []string
+	for name, prop := range schema.Properties {
+		if sensitiveField.MatchString(name) {
+			fields = append(fields, name)
+		}
+		fields = append(fields, sensitiveFields(doc, prop, seen)...)
+	}
+	fields = append(fields, sensitiveFields(doc, schema.Items, seen)...)
+	fields = append(fields, sensitiveFields(doc, schema.AdditionalProperties, seen)...)
+	return fields
+}
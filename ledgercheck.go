@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"resturant/controllers"
+	"resturant/utils"
+)
+
+// ledgerCheckCommand prints what breaks the ledger invariants and exits with
+// status 1 when anything does, so it can run from cron or CI
+func ledgerCheckCommand() {
+	check, err := controllers.CheckLedger()
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	fmt.Printf("%d journal entries, %d postings checked\n", check.Entries, check.Postings)
+	for _, problem := range check.Problems {
+		fmt.Println(problem)
+	}
+	if len(check.Problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Ledger balances")
+}
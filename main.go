@@ -8,9 +8,11 @@ import (
 	"os"
 	"path"
 	"resturant/controllers"
+	"resturant/docs"
+	"resturant/mailer"
+	"resturant/payments"
 	"resturant/utils"
 
-	"github.com/go-michi/michi"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -50,6 +52,33 @@ func main() {
 	// Set global db variable in controllers
 	controllers.SetDB(db)
 
+	// Set up the mailer used for password resets and other notifications
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	controllers.SetMailer(mail)
+
+	// Set up the payment provider checkout authorizes orders with
+	provider, err := payments.FromEnv()
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	controllers.SetPaymentProvider(provider)
+
+	// Checkout is blocked for unverified emails unless explicitly disabled
+	controllers.SetCheckoutPolicy(os.Getenv("CHECKOUT_REQUIRE_VERIFIED_EMAIL") != "false")
+
+	// Reports convert amounts to the base currency, USD unless set
+	if err := controllers.SetBaseCurrency(os.Getenv("BASE_CURRENCY")); err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+
+	// The platform keeps a share of every payment, none unless set
+	if err := controllers.SetCommissionRate(os.Getenv("COMMISSION_PERCENT")); err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+
 	// Handle migrations
 	mig, err := migrate.New(
 		"file://"+GetRootPath("database/migrations"),
@@ -65,28 +94,42 @@ func main() {
 		log.Printf("migrations: %s", err.Error())
 	}
 
+	// `resturant bootstrap-admin` creates the first admin and exits
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		bootstrapAdminCommand(os.Args[2:])
+		return
+	}
+	// `resturant ledger-check` verifies the ledger invariants and exits
+	if len(os.Args) > 1 && os.Args[1] == "ledger-check" {
+		ledgerCheckCommand()
+		return
+	}
+	// `resturant settle-payments` settles what the payment provider was not
+	// asked for yet and exits
+	if len(os.Args) > 1 && os.Args[1] == "settle-payments" {
+		settlePaymentsCommand()
+		return
+	}
+	// `resturant generate-payouts` writes the payout statements and exits
+	if len(os.Args) > 1 && os.Args[1] == "generate-payouts" {
+		generatePayoutsCommand(os.Args[2:])
+		return
+	}
+	// The first admin can also come from the environment on an empty database
+	if os.Getenv("BOOTSTRAP_ADMIN_EMAIL") != "" {
+		bootstrapAdminFromEnv()
+	}
+
 	// Initialize the router and define routes
-	r := michi.NewRouter()
-	r.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
-	r.Route("/customer", func(sub *michi.Router) {
-		sub.HandleFunc("POST signup", controllers.Signup)
-		sub.HandleFunc("POST login", controllers.Login)
-		sub.HandleFunc("PUT update/{id}", controllers.UpdateUser)
-		sub.HandleFunc("DELETE delete/{id}", controllers.DeleteUser)
-		sub.HandleFunc("GET users", controllers.GetAllUsers)
-
-	})
-
-	r.Route("/admin", func(sub *michi.Router) {
-		sub.HandleFunc("POST signup", controllers.AdminSignup)
-		sub.HandleFunc("POST login", controllers.AdminLogin)
-		sub.HandleFunc("POST add-vendor", controllers.AddVendor)
-		sub.HandleFunc("PUT update-vendor/{id}", controllers.UpdateVendor)
-		sub.HandleFunc("DELETE delete/{id}", controllers.DeleteVendor)
-		sub.HandleFunc("GET list-vendors", controllers.GetAllVendors)
-		sub.HandleFunc("GET vendor/{id}", controllers.GetVendorById)
-
-	})
+	r := newRouter()
+
+	// Make sure every route is described in the OpenAPI spec
+	if err := docs.Check(routes); err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	r.HandleFunc("GET /openapi.json", docs.ServeSpec)
+	r.HandleFunc("GET /docs", docs.ServeUI)
+	r.Handle("GET /docs/swagger-ui/", docs.ServeAssets)
 
 	// Enable CORS
 	corsOptions := handlers.CORS(
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,16 +13,40 @@ type User struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"password" db:"password"`
+	Password  string    `json:"-" db:"password"`
 	Img       string    `json:"img,omitempty" db:"img"`
 	Phone     string    `json:"phone,omitempty" db:"phone"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	EmailVerified   bool       `json:"email_verified" db:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+
+	TOTPSecret   *string `json:"-" db:"totp_secret"`
+	TOTPEnabled  bool    `json:"totp_enabled" db:"totp_enabled"`
+	TOTPRequired bool    `json:"totp_required" db:"totp_required"`
+	TOTPLastStep int64   `json:"-" db:"totp_last_step"`
 }
 
 type Role struct {
-	ID   int    `json:"id" db:"id"`
-	Name string `json:"name" db:"name"`
+	ID       int        `json:"id" db:"id"`
+	Name     string     `json:"name" db:"name"`
+	Scope    string     `json:"scope" db:"scope"`
+	VendorID *uuid.UUID `json:"vendor_id,omitempty" db:"vendor_id"`
+}
+
+// Role and permission scopes: platform permissions can only be granted to
+// platform roles and vendor permissions to vendor roles
+const (
+	ScopePlatform = "platform"
+	ScopeVendor   = "vendor"
+)
+
+type Permission struct {
+	ID          int    `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+	Scope       string `json:"scope" db:"scope"`
 }
 
 type UserRole struct {
@@ -28,22 +55,28 @@ type UserRole struct {
 }
 
 type Item struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Img       string    `json:"img,omitempty" db:"img"`
-	Price     float64   `json:"price" db:"price"`
-	VendorID  uuid.UUID `json:"vendor_id" db:"vendor_id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Description string     `json:"description" db:"description"`
+	Img         string     `json:"img,omitempty" db:"img"`
+	Price       Money      `json:"price" db:"price"`
+	TaxCategory string     `json:"tax_category" db:"tax_category"`
+	VendorID    uuid.UUID  `json:"vendor_id" db:"vendor_id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time `json:"-" db:"deleted_at"`
 }
 
 type Cart struct {
-	ID         uuid.UUID `json:"id" db:"id"`
-	UserID     uuid.UUID `json:"user_id" db:"user_id"`
-	TotalPrice float64   `json:"total_price" db:"total_price"`
-	Quantity   int       `json:"quantity" db:"quantity"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	TotalPrice   Money      `json:"total_price" db:"total_price"`
+	Currency     *string    `json:"currency" db:"currency"`
+	Quantity     int        `json:"quantity" db:"quantity"`
+	PromotionID  *uuid.UUID `json:"promotion_id" db:"promotion_id"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	CheckedOutAt *time.Time `json:"checked_out_at,omitempty" db:"checked_out_at"`
 }
 
 type CartItem struct {
@@ -53,19 +86,91 @@ type CartItem struct {
 }
 
 type Order struct {
-	ID             uuid.UUID `json:"id" db:"id"`
-	OrderTotalCost float64   `json:"order_total_cost" db:"order_total_cost"`
-	CartID         uuid.UUID `json:"cart_id" db:"cart_id"`
-	CustomerID     uuid.UUID `json:"customer_id" db:"customer_id"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	ID                   uuid.UUID  `json:"id" db:"id"`
+	OrderTotalCost       Money      `json:"order_total_cost" db:"order_total_cost"`
+	Currency             string     `json:"currency" db:"currency"`
+	CartID               uuid.UUID  `json:"cart_id" db:"cart_id"`
+	CustomerID           uuid.UUID  `json:"customer_id" db:"customer_id"`
+	VendorID             uuid.UUID  `json:"vendor_id" db:"vendor_id"`
+	Status               string     `json:"status" db:"status"`
+	DeliveryFee          Money      `json:"delivery_fee" db:"delivery_fee"`
+	PricesIncludeTax     bool       `json:"prices_include_tax" db:"prices_include_tax"`
+	DeliveryTaxRate      string     `json:"delivery_tax_rate" db:"delivery_tax_rate"`
+	DeliveryTax          Money      `json:"delivery_tax" db:"delivery_tax"`
+	TaxTotal             Money      `json:"tax_total" db:"tax_total"`
+	PromotionID          *uuid.UUID `json:"promotion_id" db:"promotion_id"`
+	CouponCode           *string    `json:"coupon_code" db:"coupon_code"`
+	DiscountTotal        Money      `json:"discount_total" db:"discount_total"`
+	DeliveryDiscount     Money      `json:"delivery_discount" db:"delivery_discount"`
+	DeliveryZoneID       *uuid.UUID `json:"delivery_zone_id" db:"delivery_zone_id"`
+	DeliveryLatitude     *float64   `json:"delivery_latitude" db:"delivery_latitude"`
+	DeliveryLongitude    *float64   `json:"delivery_longitude" db:"delivery_longitude"`
+	AddressID            *uuid.UUID `json:"address_id" db:"address_id"`
+	DeliveryAddress      string     `json:"delivery_address" db:"delivery_address"`
+	DeliveryInstructions string     `json:"delivery_instructions" db:"delivery_instructions"`
+	PaymentType          string     `json:"payment_type" db:"payment_type"`
+	CashDue              Money      `json:"cash_due" db:"cash_due"`
+	RefundedTotal        Money      `json:"refunded_total" db:"refunded_total"`
+	WalletPaid           Money      `json:"wallet_paid" db:"wallet_paid"`
+	WalletRefunded       Money      `json:"wallet_refunded" db:"wallet_refunded"`
+	// CommissionPercent and CommissionFee are the vendor's commission at
+	// checkout, the platform's percentage when nil
+	CommissionPercent *string   `json:"-" db:"commission_percent"`
+	CommissionFee     Money     `json:"-" db:"commission_fee"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Payment types, how the customer pays an order. A split order is paid partly
+// by card and the rest in cash on delivery, a wallet order from the
+// customer's wallet. Any of them can take part of the total from the wallet.
+const (
+	PaymentTypeCard   = "card"
+	PaymentTypeCash   = "cash"
+	PaymentTypeSplit  = "split"
+	PaymentTypeWallet = "wallet"
+)
+
+const (
+	OrderStatusPlaced    = "placed"
+	OrderStatusAccepted  = "accepted"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+
+	// Orders paid by card wait for the authorization in pending_payment and
+	// end in payment_failed when it does not come, vendors never see them
+	OrderStatusPendingPayment = "pending_payment"
+	OrderStatusPaymentFailed  = "payment_failed"
+)
+
+// UnplacedOrderStatuses are the statuses of checkouts that were not placed
+var UnplacedOrderStatuses = []string{OrderStatusPendingPayment, OrderStatusPaymentFailed}
+
+// OrderStatusTransitions lists the statuses the vendor can move an order to from each status
+var OrderStatusTransitions = map[string][]string{
+	OrderStatusPlaced:    {OrderStatusAccepted, OrderStatusCancelled},
+	OrderStatusAccepted:  {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady},
+	OrderStatusReady:     {OrderStatusCompleted},
 }
 
 type OrderItem struct {
 	OrderID  uuid.UUID `json:"order_id" db:"order_id"`
 	ItemID   uuid.UUID `json:"item_id" db:"item_id"`
 	Quantity int       `json:"quantity" db:"quantity"`
-	Price    float64   `json:"price" db:"price"`
+	Price    Money     `json:"price" db:"price"`
+	// Discount is what a promotion took off the whole line, the tax is
+	// charged on the rest
+	Discount Money `json:"discount" db:"discount"`
+	// TaxRate is the percentage charged on the line, TaxAmount the tax of the
+	// whole line
+	TaxCategory string `json:"tax_category" db:"tax_category"`
+	TaxRate     string `json:"tax_rate" db:"tax_rate"`
+	TaxAmount   Money  `json:"tax_amount" db:"tax_amount"`
+	// RefundedQuantity is how many of the line were cancelled and refunded
+	RefundedQuantity int `json:"refunded_quantity" db:"refunded_quantity"`
 }
 
 type Vendor struct {
@@ -75,5 +180,530 @@ type Vendor struct {
 	Phone       string    `json:"Phone" db:"phone"`
 	Img         string    `json:"Img" db:"img"`
 	Description string    `json:"Description" db:"description"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	Address     string    `json:"Address" db:"address"`
+	Cuisine     string    `json:"Cuisine" db:"cuisine"`
+	Latitude    *float64  `json:"Latitude" db:"latitude"`
+	Longitude   *float64  `json:"Longitude" db:"longitude"`
+	TimeZone    string    `json:"TimeZone" db:"time_zone"`
+	Currency    string    `json:"Currency" db:"currency"`
+
+	TaxJurisdictionID *uuid.UUID `json:"TaxJurisdictionID" db:"tax_jurisdiction_id"`
+	PricesIncludeTax  bool       `json:"PricesIncludeTax" db:"prices_include_tax"`
+	IsOpenNow         bool       `json:"IsOpenNow" db:"is_open_now"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+// OpeningInterval is a weekly opening interval in the vendor's time zone.
+// Weekday 0 is Sunday, times are HH:MM and an interval closing at or before
+// its opening time ends the next day.
+type OpeningInterval struct {
+	Weekday  int    `json:"weekday" db:"weekday" validate:"min=0,max=6"`
+	OpensAt  string `json:"opens_at" db:"opens_at" validate:"required"`
+	ClosesAt string `json:"closes_at" db:"closes_at" validate:"required"`
+}
+
+// CustomerAddress is a delivery address saved in a customer's address book
+type CustomerAddress struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	UserID       uuid.UUID `json:"user_id" db:"user_id"`
+	Label        string    `json:"label" db:"label"`
+	Address      string    `json:"address" db:"address"`
+	Latitude     *float64  `json:"latitude" db:"latitude"`
+	Longitude    *float64  `json:"longitude" db:"longitude"`
+	Instructions string    `json:"instructions" db:"instructions"`
+	IsDefault    bool      `json:"is_default" db:"is_default"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+const (
+	DeliveryZoneRadius  = "radius"
+	DeliveryZonePolygon = "polygon"
+)
+
+// DeliveryZone is an area a vendor delivers to, either RadiusKm around the
+// center or the inside of Polygon
+type DeliveryZone struct {
+	ID              uuid.UUID `json:"id" db:"id"`
+	VendorID        uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	Name            string    `json:"name" db:"name"`
+	Kind            string    `json:"kind" db:"kind"`
+	CenterLatitude  *float64  `json:"center_latitude,omitempty" db:"center_latitude"`
+	CenterLongitude *float64  `json:"center_longitude,omitempty" db:"center_longitude"`
+	RadiusKm        *float64  `json:"radius_km,omitempty" db:"radius_km"`
+	Polygon         Polygon   `json:"polygon,omitempty" db:"polygon"`
+	Fee             Money     `json:"fee" db:"fee"`
+	MinOrder        Money     `json:"min_order" db:"min_order"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Polygon is a list of [latitude, longitude] points, stored as JSON
+type Polygon [][2]float64
+
+func (p Polygon) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	// Sent as text, lib/pq would encode []byte as bytea
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+func (p *Polygon) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, p)
+	case string:
+		return json.Unmarshal([]byte(src), p)
+	}
+	return fmt.Errorf("cannot scan %T into Polygon", src)
+}
+
+// VendorClosure closes a vendor for one local date
+type VendorClosure struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	VendorID  uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	Date      string    `json:"date" db:"date"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type VendorApplication struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Phone           string     `json:"phone" db:"phone"`
+	Password        string     `json:"-" db:"password"`
+	Description     string     `json:"description" db:"description"`
+	Address         string     `json:"address" db:"address"`
+	Cuisine         string     `json:"cuisine" db:"cuisine"`
+	Logo            string     `json:"logo" db:"logo"`
+	Status          string     `json:"status" db:"status"`
+	RejectionReason *string    `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	ReviewedBy      *uuid.UUID `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	VendorID        *uuid.UUID `json:"vendor_id,omitempty" db:"vendor_id"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+const (
+	ApplicationStatusPending  = "pending"
+	ApplicationStatusApproved = "approved"
+	ApplicationStatusRejected = "rejected"
+)
+
+type VendorApplicationDocument struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	ApplicationID uuid.UUID `json:"application_id" db:"application_id"`
+	Filename      string    `json:"filename" db:"filename"`
+	Path          string    `json:"-" db:"path"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+type Session struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	// TwoFactorVerified is set when a second factor was checked for the session
+	TwoFactorVerified bool `json:"two_factor_verified" db:"two_factor_verified"`
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+type EmailVerification struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+type AdminInvitation struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Email      string     `json:"email" db:"email"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	InvitedBy  *uuid.UUID `json:"invited_by,omitempty" db:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+type VendorStaff struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	VendorID  uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type StaffInvitation struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	VendorID   uuid.UUID  `json:"vendor_id" db:"vendor_id"`
+	RoleID     int        `json:"role_id" db:"role_id"`
+	Email      string     `json:"email" db:"email"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	InvitedBy  *uuid.UUID `json:"invited_by,omitempty" db:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	CodeHash  string     `json:"-" db:"code_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+type LoginChallenge struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	Attempts  int        `json:"attempts" db:"attempts"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+// Tax categories, items are food or alcohol and delivery fees are taxed as delivery
+const (
+	TaxCategoryFood     = "food"
+	TaxCategoryAlcohol  = "alcohol"
+	TaxCategoryDelivery = "delivery"
+)
+
+// TaxJurisdiction holds the tax rates of an area
+type TaxJurisdiction struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Code      string    `json:"code" db:"code"`
+	Name      string    `json:"name" db:"name"`
+	Rates     []TaxRate `json:"rates" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TaxRate is the percentage charged on a category, e.g. 8.875
+type TaxRate struct {
+	Category string `json:"category" db:"category"`
+	Rate     string `json:"rate" db:"rate"`
+}
+
+// Promotion kinds
+const (
+	PromotionPercentage   = "percentage"
+	PromotionFixed        = "fixed"
+	PromotionFreeDelivery = "free_delivery"
+	PromotionBuyXGetY     = "buy_x_get_y"
+)
+
+// Promotion is a discount customers redeem with its code, platform-wide when
+// it has no vendor. Percent is set for percentage promotions, Amount for fixed
+// ones and the item and quantities for buy-x-get-y ones. Uses counts the
+// orders placed with it that were not cancelled.
+type Promotion struct {
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	Code               string     `json:"code" db:"code"`
+	Description        string     `json:"description" db:"description"`
+	VendorID           *uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	Kind               string     `json:"kind" db:"kind"`
+	Percent            *string    `json:"percent" db:"percent"`
+	Amount             *Money     `json:"amount" db:"amount"`
+	ItemID             *uuid.UUID `json:"item_id" db:"item_id"`
+	BuyQuantity        *int       `json:"buy_quantity" db:"buy_quantity"`
+	GetQuantity        *int       `json:"get_quantity" db:"get_quantity"`
+	MinSpend           Money      `json:"min_spend" db:"min_spend"`
+	Currency           *string    `json:"currency" db:"currency"`
+	StartsAt           *time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt             *time.Time `json:"ends_at" db:"ends_at"`
+	MaxUses            *int       `json:"max_uses" db:"max_uses"`
+	MaxUsesPerCustomer *int       `json:"max_uses_per_customer" db:"max_uses_per_customer"`
+	Active             bool       `json:"active" db:"active"`
+	Uses               int        `json:"uses" db:"uses"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Payment intent statuses
+const (
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentRefunded   = "refunded"
+	PaymentVoided     = "voided"
+	PaymentFailed     = "failed"
+)
+
+// PaymentIntent is an amount authorized at the payment provider for an order,
+// then captured or voided. ProviderPaymentID is the provider's reference, nil
+// while the authorization is pending. PaymentMethod is the card token the
+// authorization is retried with.
+type PaymentIntent struct {
+	ID                uuid.UUID `json:"id" db:"id"`
+	OrderID           uuid.UUID `json:"order_id" db:"order_id"`
+	Provider          string    `json:"provider" db:"provider"`
+	ProviderPaymentID *string   `json:"provider_payment_id" db:"provider_payment_id"`
+	PaymentMethod     string    `json:"-" db:"payment_method"`
+	Amount            Money     `json:"amount" db:"amount"`
+	CapturedAmount    Money     `json:"captured_amount" db:"captured_amount"`
+	RefundedAmount    Money     `json:"refunded_amount" db:"refunded_amount"`
+	Status            string    `json:"status" db:"status"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Payment operation kinds and statuses
+const (
+	PaymentOperationCapture = "capture"
+	PaymentOperationVoid    = "void"
+	PaymentOperationRefund  = "refund"
+
+	PaymentOperationPending   = "pending"
+	PaymentOperationSucceeded = "succeeded"
+	PaymentOperationDeclined  = "declined"
+)
+
+// Refund statuses
+const (
+	RefundPending  = "pending"
+	RefundRefunded = "refunded"
+)
+
+// PaymentOperation is a capture, void or refund of a payment intent, stored
+// before the provider is asked for it. Its ID, or the ID of the refund it
+// makes, is the idempotency key of the request, so asking again after a
+// failure never moves the money twice.
+type PaymentOperation struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	PaymentIntentID uuid.UUID  `json:"payment_intent_id" db:"payment_intent_id"`
+	RefundID        *uuid.UUID `json:"refund_id" db:"refund_id"`
+	Kind            string     `json:"kind" db:"kind"`
+	Amount          Money      `json:"amount" db:"amount"`
+	Status          string     `json:"status" db:"status"`
+	DeclineReason   *string    `json:"decline_reason" db:"decline_reason"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	SettledAt       *time.Time `json:"settled_at" db:"settled_at"`
+}
+
+// CashPayment is cash the vendor received for an order. Tendered is what the
+// customer handed over, Amount the part applied to the order and ChangeGiven
+// what was handed back.
+type CashPayment struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	OrderID     uuid.UUID  `json:"order_id" db:"order_id"`
+	Amount      Money      `json:"amount" db:"amount"`
+	Tendered    Money      `json:"tendered" db:"tendered"`
+	ChangeGiven Money      `json:"change_given" db:"change_given"`
+	RecordedBy  *uuid.UUID `json:"recorded_by" db:"recorded_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Refund gives back part of what an order charged, some quantity of its lines
+// and possibly the delivery. Amount is what the order no longer owes, of which
+// CardAmount was refunded on the payment PaymentIntentID and CashAmount handed
+// back in cash; the rest was cash that had not been collected yet. It is
+// pending until the provider answered for the card part.
+type Refund struct {
+	ID              uuid.UUID    `json:"id" db:"id"`
+	OrderID         uuid.UUID    `json:"order_id" db:"order_id"`
+	PaymentIntentID *uuid.UUID   `json:"payment_intent_id" db:"payment_intent_id"`
+	Status          string       `json:"status" db:"status"`
+	Reason          string       `json:"reason" db:"reason"`
+	Amount          Money        `json:"amount" db:"amount"`
+	TaxAmount       Money        `json:"tax_amount" db:"tax_amount"`
+	DeliveryAmount  Money        `json:"delivery_amount" db:"delivery_amount"`
+	CardAmount      Money        `json:"card_amount" db:"card_amount"`
+	CashAmount      Money        `json:"cash_amount" db:"cash_amount"`
+	WalletAmount    Money        `json:"wallet_amount" db:"wallet_amount"`
+	RefundedBy      *uuid.UUID   `json:"refunded_by" db:"refunded_by"`
+	Items           []RefundItem `json:"items" db:"-"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+}
+
+// RefundItem is the quantity of an order line a refund cancelled, with its
+// share of the line and of the line's tax
+type RefundItem struct {
+	RefundID  uuid.UUID `json:"-" db:"refund_id"`
+	ItemID    uuid.UUID `json:"item_id" db:"item_id"`
+	Quantity  int       `json:"quantity" db:"quantity"`
+	Amount    Money     `json:"amount" db:"amount"`
+	TaxAmount Money     `json:"tax_amount" db:"tax_amount"`
+}
+
+// Owners of ledger accounts, the platform's accounts have the nil owner id
+const (
+	LedgerOwnerPlatform = "platform"
+	LedgerOwnerVendor   = "vendor"
+	LedgerOwnerCustomer = "customer"
+)
+
+// Ledger account names. The platform's cash is the money held at the payment
+// provider and a vendor's cash the money it collected in cash for orders. A
+// vendor's payable is what the platform owes it, a customer's wallet the
+// balance they can spend and the platform's promotions the credit it gave away.
+const (
+	AccountCash       = "cash"
+	AccountCommission = "commission"
+	AccountPayable    = "payable"
+	AccountWallet     = "wallet"
+	AccountPromotions = "promotions"
+)
+
+// Ledger account kinds, the side a balance normally sits on
+const (
+	AccountAsset     = "asset"
+	AccountLiability = "liability"
+	AccountRevenue   = "revenue"
+	AccountExpense   = "expense"
+)
+
+// Journal entry kinds
+const (
+	EntryOrderPayment    = "order_payment"
+	EntryRefund          = "refund"
+	EntryPayout          = "payout"
+	EntryWalletTopUp     = "wallet_top_up"
+	EntryWalletPromotion = "wallet_promotion"
+	EntryWalletExpiry    = "wallet_expiry"
+)
+
+// LedgerAccount holds a balance of the platform, a vendor or a customer in
+// one currency. Balance is on the account's normal side: what the platform
+// holds on assets, owes on liabilities, earned on revenue and spent on
+// expenses.
+type LedgerAccount struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	OwnerType string    `json:"owner_type" db:"owner_type"`
+	OwnerID   uuid.UUID `json:"owner_id" db:"owner_id"`
+	Name      string    `json:"name" db:"name"`
+	Kind      string    `json:"kind" db:"kind"`
+	Currency  string    `json:"currency" db:"currency"`
+	Balance   Money     `json:"balance" db:"balance"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// JournalEntry is one movement of money, its postings add up to zero.
+// ReferenceID is the payment, cash payment, refund or payout it records.
+type JournalEntry struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	Kind        string          `json:"kind" db:"kind"`
+	OrderID     *uuid.UUID      `json:"order_id" db:"order_id"`
+	ReferenceID *uuid.UUID      `json:"reference_id" db:"reference_id"`
+	Description string          `json:"description" db:"description"`
+	Postings    []LedgerPosting `json:"postings" db:"-"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// LedgerPosting debits (a positive amount) or credits (a negative one) an account
+type LedgerPosting struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	EntryID   uuid.UUID `json:"entry_id" db:"entry_id"`
+	AccountID uuid.UUID `json:"account_id" db:"account_id"`
+	Amount    Money     `json:"amount" db:"amount"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Payout statuses, a statement is approved before it is paid
+const (
+	PayoutPending  = "pending"
+	PayoutApproved = "approved"
+	PayoutPaid     = "paid"
+)
+
+// Payout is the statement of what a vendor earned from the ledger entries of
+// their orders up to the end of a period. AmountDue is what the platform
+// transfers: the net payout less the cash the vendor already collected,
+// negative when the vendor owes the platform.
+type Payout struct {
+	ID               uuid.UUID    `json:"id" db:"id"`
+	VendorID         uuid.UUID    `json:"vendor_id" db:"vendor_id"`
+	Currency         string       `json:"currency" db:"currency"`
+	PeriodStart      string       `json:"period_start" db:"period_start"`
+	PeriodEnd        string       `json:"period_end" db:"period_end"`
+	GrossSales       Money        `json:"gross_sales" db:"gross_sales"`
+	Refunds          Money        `json:"refunds" db:"refunds"`
+	Commission       Money        `json:"commission" db:"commission"`
+	NetPayout        Money        `json:"net_payout" db:"net_payout"`
+	CashCollected    Money        `json:"cash_collected" db:"cash_collected"`
+	AmountDue        Money        `json:"amount_due" db:"amount_due"`
+	Status           string       `json:"status" db:"status"`
+	ApprovedBy       *uuid.UUID   `json:"approved_by" db:"approved_by"`
+	ApprovedAt       *time.Time   `json:"approved_at" db:"approved_at"`
+	PaidBy           *uuid.UUID   `json:"paid_by" db:"paid_by"`
+	PaidAt           *time.Time   `json:"paid_at" db:"paid_at"`
+	PaymentReference *string      `json:"payment_reference" db:"payment_reference"`
+	Lines            []PayoutLine `json:"lines,omitempty" db:"-"`
+	CreatedAt        time.Time    `json:"created_at" db:"created_at"`
+}
+
+// PayoutLine is the part of a payout statement that comes from one order
+type PayoutLine struct {
+	OrderID    uuid.UUID `json:"order_id" db:"order_id"`
+	GrossSales Money     `json:"gross_sales" db:"gross_sales"`
+	Refunds    Money     `json:"refunds" db:"refunds"`
+	Commission Money     `json:"commission" db:"commission"`
+	NetPayout  Money     `json:"net_payout" db:"net_payout"`
+}
+
+// Wallet transaction kinds. Promotions are credit given by the platform
+// that expires, expiry takes back what was not spent of it.
+const (
+	WalletTopUp     = "top_up"
+	WalletPromotion = "promotion"
+	WalletPayment   = "payment"
+	WalletRefund    = "refund"
+	WalletExpiry    = "expiry"
+)
+
+// Wallet is the balance a customer holds in one currency. Promotional is the
+// part of it that expires, detailed in Credits.
+type Wallet struct {
+	ID          uuid.UUID      `json:"id" db:"id"`
+	CustomerID  uuid.UUID      `json:"customer_id" db:"customer_id"`
+	Currency    string         `json:"currency" db:"currency"`
+	Balance     Money          `json:"balance" db:"balance"`
+	Promotional Money          `json:"promotional" db:"-"`
+	Credits     []WalletCredit `json:"credits" db:"-"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// WalletTransaction is a change of a wallet balance, positive for credits.
+// ProviderPaymentID is the payment that charged the card for a top-up.
+type WalletTransaction struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	WalletID          uuid.UUID  `json:"wallet_id" db:"wallet_id"`
+	Kind              string     `json:"kind" db:"kind"`
+	Amount            Money      `json:"amount" db:"amount"`
+	BalanceAfter      Money      `json:"balance_after" db:"balance_after"`
+	OrderID           *uuid.UUID `json:"order_id" db:"order_id"`
+	ReferenceID       *uuid.UUID `json:"reference_id" db:"reference_id"`
+	ProviderPaymentID *string    `json:"provider_payment_id" db:"provider_payment_id"`
+	Description       string     `json:"description" db:"description"`
+	ExpiresAt         *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedBy         *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+// WalletCredit is what is left of a promotional credit until it expires
+type WalletCredit struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	TransactionID uuid.UUID `json:"transaction_id" db:"transaction_id"`
+	Amount        Money     `json:"amount" db:"amount"`
+	Remaining     Money     `json:"remaining" db:"remaining"`
+	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
@@ -0,0 +1,374 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of vendors that did not pick one and the
+// default base currency of reports
+const DefaultCurrency = "USD"
+
+// maxExponent is the most decimals a currency has, amounts without a currency
+// (read from requests before the currency they are in is known) keep that many
+const maxExponent = 3
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth of the major one
+var currencyExponents = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyExponent is the number of decimals of the currency's minor unit
+func CurrencyExponent(currency string) int {
+	if currency == "" {
+		return maxExponent
+	}
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Errors of the checked arithmetic, the unchecked methods panic with them
+var (
+	ErrCurrencyMismatch = errors.New("money: amounts are in different currencies")
+	ErrOverflow         = errors.New("money: amount is out of range")
+)
+
+// Money is an amount in the minor units of its currency (cents for USD), kept
+// as an integer so sums never drift. It is stored in decimal columns and
+// encoded in JSON as a decimal string such as "12.50". Every rounding goes
+// through MulRatio, MulRat or Exchange.
+//
+// Add, Sub, Cmp and the multiplications panic on amounts of different
+// currencies or results that don't fit an int64, which callers rule out by
+// checking currencies and bounds first. The Checked variants return the error
+// instead, for amounts whose currencies or size were not checked.
+//
+// An amount without a currency, as decoded from a request, is placed in one
+// with In before it is used.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads a decimal amount such as "12.5" exactly, it fails rather
+// than round when the amount has more decimals than the currency
+func ParseMoney(s string, currency string) (Money, error) {
+	exponent := CurrencyExponent(currency)
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimLeft(s, "+-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" || len(s)-len(digits) > 1 {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if trimmed := strings.TrimRight(fraction, "0"); len(trimmed) > exponent {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimals", s, exponent)
+	}
+	fraction = (fraction + strings.Repeat("0", exponent))[:exponent]
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if whole+fraction == "" {
+		amount, err = 0, nil
+	}
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String formats the amount as a decimal with the currency's decimals
+func (m Money) String() string {
+	exponent := CurrencyExponent(m.Currency)
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// Float64 is the amount in major units, only meant for bounds checks
+func (m Money) Float64() float64 {
+	f, _ := strconv.ParseFloat(m.String(), 64)
+	return f
+}
+
+// In places the amount in a currency, it fails when the amount already has
+// another currency or more decimals than the currency allows
+func (m Money) In(currency string) (Money, error) {
+	if m.Currency == currency {
+		return m, nil
+	}
+	if m.Currency != "" {
+		return Money{}, fmt.Errorf("amount is in %s, not %s", m.Currency, currency)
+	}
+	amount, err := rescale(m.Amount, CurrencyExponent(m.Currency), CurrencyExponent(currency))
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %s has more than %d decimals", m, CurrencyExponent(currency))
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// rescale moves an amount between minor units without dropping digits
+func rescale(amount int64, from, to int) (int64, error) {
+	for ; from < to; from++ {
+		if amount > math.MaxInt64/10 || amount < math.MinInt64/10 {
+			return 0, ErrOverflow
+		}
+		amount *= 10
+	}
+	for ; from > to; from-- {
+		if amount%10 != 0 {
+			return 0, fmt.Errorf("amount does not fit %d decimals", to)
+		}
+		amount /= 10
+	}
+	return amount, nil
+}
+
+// align brings two amounts to the same currency, one without a currency
+// takes the other one's
+func (m Money) align(other Money) (Money, Money, error) {
+	var err error
+	switch {
+	case m.Currency == other.Currency:
+		return m, other, nil
+	case m.Currency == "":
+		m, err = m.In(other.Currency)
+	case other.Currency == "":
+		other, err = other.In(m.Currency)
+	default:
+		err = fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return m, other, err
+}
+
+// must returns the result of a checked operation, panicking on its error
+func must[T any](result T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (m Money) Add(other Money) Money {
+	return must(m.CheckedAdd(other))
+}
+
+func (m Money) Sub(other Money) Money {
+	return must(m.CheckedSub(other))
+}
+
+// CheckedAdd adds two amounts, it fails when their currencies differ or the
+// sum overflows
+func (m Money) CheckedAdd(other Money) (Money, error) {
+	m, other, err := m.align(other)
+	if err != nil {
+		return Money{}, err
+	}
+	if other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount || other.Amount < 0 && m.Amount < math.MinInt64-other.Amount {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrOverflow, m, other)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// CheckedSub subtracts an amount, it fails when the currencies differ or the
+// difference overflows
+func (m Money) CheckedSub(other Money) (Money, error) {
+	m, other, err := m.align(other)
+	if err != nil {
+		return Money{}, err
+	}
+	if other.Amount < 0 && m.Amount > math.MaxInt64+other.Amount || other.Amount > 0 && m.Amount < math.MinInt64+other.Amount {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrOverflow, m, other)
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int64) Money {
+	return must(m.CheckedMul(quantity))
+}
+
+// CheckedMul multiplies the amount by a quantity, it fails when the product
+// overflows
+func (m Money) CheckedMul(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %s * %d", ErrOverflow, m, quantity)
+	}
+	return Money{Amount: product.Int64(), Currency: m.Currency}, nil
+}
+
+// MulRatio multiplies the amount by num/den, rounding half away from zero to
+// the minor unit
+func (m Money) MulRatio(num, den int64) Money {
+	return m.MulRat(big.NewRat(num, den))
+}
+
+// MulRat multiplies the amount by a rational factor such as a tax rate,
+// rounding half away from zero to the minor unit
+func (m Money) MulRat(factor *big.Rat) Money {
+	return must(m.CheckedMulRat(factor))
+}
+
+// CheckedMulRat is MulRat failing when the result overflows
+func (m Money) CheckedMulRat(factor *big.Rat) (Money, error) {
+	amount, err := round(new(big.Rat).SetInt64(m.Amount), factor)
+	if err != nil {
+		return Money{}, fmt.Errorf("%s * %s: %w", m, factor.RatString(), err)
+	}
+	return Money{Amount: amount, Currency: m.Currency}, nil
+}
+
+// Exchange converts the amount to another currency at rate units of that
+// currency per unit of this one, rounding half away from zero
+func (m Money) Exchange(currency string, rate *big.Rat) Money {
+	return must(m.CheckedExchange(currency, rate))
+}
+
+// CheckedExchange is Exchange failing when the converted amount overflows
+func (m Money) CheckedExchange(currency string, rate *big.Rat) (Money, error) {
+	// Minor units of m times the rate, moved to the minor units of currency
+	scale := new(big.Rat).SetFrac(pow10(CurrencyExponent(currency)), pow10(CurrencyExponent(m.Currency)))
+	amount, err := round(new(big.Rat).SetInt64(m.Amount), new(big.Rat).Mul(rate, scale))
+	if err != nil {
+		return Money{}, fmt.Errorf("%s at %s %s: %w", m, rate.RatString(), currency, err)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// round returns amount * factor rounded half away from zero, it is the only
+// place amounts are rounded
+func round(amount, factor *big.Rat) (int64, error) {
+	product := new(big.Rat).Mul(amount, factor)
+	quotient, remainder := new(big.Int).QuoRem(product.Num(), product.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(product.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(product.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return quotient.Int64(), nil
+}
+
+// Cmp compares two amounts of the same currency, it returns -1, 0 or 1
+func (m Money) Cmp(other Money) int {
+	return must(m.CheckedCmp(other))
+}
+
+// CheckedCmp is Cmp failing when the currencies differ
+func (m Money) CheckedCmp(other Money) (int, error) {
+	m, other, err := m.align(other)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts the amount as a string ("12.50") or as a number (12.5)
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	parsed, err := ParseMoney(s, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText reads form values
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text), m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a decimal column without losing precision. The currency comes
+// after the amount, as in "12.50 USD", when the query selects it with the
+// amount; otherwise the amount keeps the currency of m.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		*m = Money{Currency: m.Currency}
+		return nil
+	case []byte:
+		s = string(src)
+	case string:
+		s = src
+	case int64:
+		s = strconv.FormatInt(src, 10)
+	case float64:
+		s = strconv.FormatFloat(src, 'f', -1, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	currency := m.Currency
+	if amount, code, ok := strings.Cut(strings.TrimSpace(s), " "); ok {
+		s, currency = amount, code
+	}
+	parsed, err := ParseMoney(s, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as a decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestMoneyScanValue(t *testing.T) {
+	tests := []struct {
+		currency string
+		column   interface{}
+		want     Money
+		value    string
+	}{
+		{"USD", []byte("12.50"), NewMoney(1250, "USD"), "12.50"},
+		{"USD", "12.5", NewMoney(1250, "USD"), "12.50"},
+		{"USD", "-0.05", NewMoney(-5, "USD"), "-0.05"},
+		{"JPY", []byte("1200"), NewMoney(1200, "JPY"), "1200"},
+		{"JPY", int64(7), NewMoney(7, "JPY"), "7"},
+		{"KWD", "3.125", NewMoney(3125, "KWD"), "3.125"},
+		{"KWD", "0.001", NewMoney(1, "KWD"), "0.001"},
+		{"", "12.50 USD", NewMoney(1250, "USD"), "12.50"},
+		{"USD", "900 JPY", NewMoney(900, "JPY"), "900"},
+		{"", "1.5", NewMoney(1500, ""), "1.500"},
+		{"USD", nil, NewMoney(0, "USD"), "0.00"},
+	}
+	for _, tt := range tests {
+		m := Money{Currency: tt.currency}
+		if err := m.Scan(tt.column); err != nil {
+			t.Errorf("Scan(%v) into %s error = %v", tt.column, tt.currency, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("Scan(%v) into %s = %#v, want %#v", tt.column, tt.currency, m, tt.want)
+		}
+		value, err := m.Value()
+		if err != nil || value != tt.value {
+			t.Errorf("%#v.Value() = %v, %v, want %s", m, value, err, tt.value)
+		}
+
+		// What is stored reads back the same
+		again := Money{Currency: m.Currency}
+		if err := again.Scan(value); err != nil || again != m {
+			t.Errorf("Scan(%v) after Value() = %#v, %v, want %#v", value, again, err, m)
+		}
+	}
+}
+
+func TestMoneyScanErrors(t *testing.T) {
+	for _, column := range []interface{}{"12.505", "1.5", "abc", "1.2.3", "--1", true, "99999999999999999999"} {
+		m := Money{Currency: "USD"}
+		if column == "1.5" {
+			m.Currency = "JPY"
+		}
+		if err := m.Scan(column); err == nil {
+			t.Errorf("Scan(%v) into %s = %#v, want an error", column, m.Currency, m)
+		}
+	}
+}
+
+func TestMoneyIn(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"12.5", "USD", NewMoney(1250, "USD"), false},
+		{"12.505", "USD", Money{}, true},
+		{"12.505", "KWD", NewMoney(12505, "KWD"), false},
+		{"1200", "JPY", NewMoney(1200, "JPY"), false},
+		{"1200.5", "JPY", Money{}, true},
+		{"1200.000", "JPY", NewMoney(1200, "JPY"), false},
+	}
+	for _, tt := range tests {
+		// Request amounts are decoded without a currency
+		m, err := ParseMoney(tt.amount, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := m.In(tt.currency)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s.In(%s) = %#v, %v, want %#v", tt.amount, tt.currency, got, err, tt.want)
+		}
+	}
+
+	if _, err := NewMoney(100, "USD").In("EUR"); err == nil {
+		t.Error("In() moved an amount in USD to EUR")
+	}
+}
+
+func TestMoneyRounding(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		factor *big.Rat
+		want   int64
+	}{
+		{"half up", NewMoney(5, "USD"), big.NewRat(1, 2), 3},
+		{"below half", NewMoney(149, "USD"), big.NewRat(1, 100), 1},
+		{"half", NewMoney(150, "USD"), big.NewRat(1, 100), 2},
+		{"negative half", NewMoney(-5, "USD"), big.NewRat(1, 2), -3},
+		{"negative below half", NewMoney(-149, "USD"), big.NewRat(1, 100), -1},
+		{"tax rate", NewMoney(1999, "USD"), big.NewRat(2, 25), 160},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.MulRat(tt.factor); got.Amount != tt.want || got.Currency != tt.amount.Currency {
+			t.Errorf("%s: %s.MulRat(%s) = %#v, want %d", tt.name, tt.amount, tt.factor.RatString(), got, tt.want)
+		}
+	}
+
+	if got := NewMoney(1000, "USD").MulRatio(1, 3); got.Amount != 333 {
+		t.Errorf("MulRatio(1, 3) = %d, want 333", got.Amount)
+	}
+}
+
+func TestMoneyExchange(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		currency string
+		rate     string
+		want     Money
+	}{
+		{NewMoney(1250, "USD"), "EUR", "0.9", NewMoney(1125, "EUR")},
+		{NewMoney(1250, "USD"), "JPY", "151.37", NewMoney(1892, "JPY")},
+		{NewMoney(1000, "JPY"), "USD", "0.0066", NewMoney(660, "USD")},
+		{NewMoney(1000, "USD"), "KWD", "0.3075", NewMoney(3075, "KWD")},
+		{NewMoney(1, "KWD"), "USD", "3.25", NewMoney(0, "USD")},
+		{NewMoney(2, "KWD"), "USD", "3.25", NewMoney(1, "USD")},
+	}
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		if got := tt.amount.Exchange(tt.currency, rate); got != tt.want {
+			t.Errorf("%s %s at %s = %#v, want %#v", tt.amount, tt.amount.Currency, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyChecked(t *testing.T) {
+	usd := NewMoney(100, "USD")
+	eur := NewMoney(100, "EUR")
+	max := NewMoney(math.MaxInt64, "USD")
+	min := NewMoney(math.MinInt64, "USD")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"add currencies", second(usd.CheckedAdd(eur)), ErrCurrencyMismatch},
+		{"sub currencies", second(usd.CheckedSub(eur)), ErrCurrencyMismatch},
+		{"cmp currencies", second(usd.CheckedCmp(eur)), ErrCurrencyMismatch},
+		{"add overflow", second(max.CheckedAdd(NewMoney(1, "USD"))), ErrOverflow},
+		{"add underflow", second(min.CheckedAdd(NewMoney(-1, "USD"))), ErrOverflow},
+		{"sub overflow", second(max.CheckedSub(NewMoney(-1, "USD"))), ErrOverflow},
+		{"sub underflow", second(min.CheckedSub(NewMoney(1, "USD"))), ErrOverflow},
+		{"mul overflow", second(max.CheckedMul(2)), ErrOverflow},
+		{"mul underflow", second(min.CheckedMul(-1)), ErrOverflow},
+		{"rounding overflow", second(max.CheckedMulRat(big.NewRat(3, 2))), ErrOverflow},
+		{"exchange overflow", second(max.CheckedExchange("JPY", big.NewRat(150, 1))), ErrOverflow},
+		{"add at the limit", second(max.CheckedAdd(NewMoney(-1, "USD"))), nil},
+		{"sub at the limit", second(min.CheckedSub(NewMoney(-1, "USD"))), nil},
+		{"mul at the limit", second(NewMoney(math.MaxInt64/2, "USD").CheckedMul(2)), nil},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) || tt.want == nil && tt.err != nil {
+			t.Errorf("%s: error = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+
+	// An amount without a currency takes the other one's
+	sum, err := NewMoney(1500, "").CheckedAdd(usd)
+	if err != nil || sum != NewMoney(250, "USD") {
+		t.Errorf("CheckedAdd() = %#v, %v, want 2.50 USD", sum, err)
+	}
+	if _, err := NewMoney(1505, "").CheckedAdd(usd); err == nil {
+		t.Error("CheckedAdd() dropped the decimals USD does not have")
+	}
+}
+
+func TestMoneyPanicsOnMismatch(t *testing.T) {
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("Add() recovered %v, want %v", err, ErrCurrencyMismatch)
+		}
+	}()
+	NewMoney(100, "USD").Add(NewMoney(100, "EUR"))
+}
+
+func second[T any](_ T, err error) error {
+	return err
+}
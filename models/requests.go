@@ -0,0 +1,324 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Request DTOs are decoded from either a JSON body or form values (see
+// utils.DecodeRequest) and checked with utils.Validate. The form tag names the
+// form field, the validate tag lists the rules applied to the value.
+
+type SignupRequest struct {
+	Username string `json:"username" form:"username" validate:"required"`
+	Email    string `json:"email" form:"email" validate:"required,email"`
+	Phone    string `json:"phone" form:"phone" validate:"required,e164"`
+	Password string `json:"password" form:"password" validate:"required,password"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" form:"email" validate:"required,email"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
+type UpdateUserRequest struct {
+	Username string `json:"username" form:"username" validate:"max=255"`
+}
+
+type AddVendorRequest struct {
+	Username    string `json:"username" form:"username" validate:"required,max=255"`
+	Email       string `json:"email" form:"email" validate:"required,email"`
+	Phone       string `json:"phone" form:"phone" validate:"required,e164"`
+	Description string `json:"description" form:"description" validate:"required"`
+}
+
+type UpdateVendorRequest struct {
+	Name        string `json:"name" form:"name" validate:"max=255"`
+	Description string `json:"description" form:"description"`
+	Phone       string `json:"phone" form:"phone" validate:"omitempty,e164"`
+}
+
+type VendorApplicationRequest struct {
+	Username    string `json:"username" form:"username" validate:"required,max=255"`
+	Email       string `json:"email" form:"email" validate:"required,email"`
+	Phone       string `json:"phone" form:"phone" validate:"required,e164"`
+	Password    string `json:"password" form:"password" validate:"required,password"`
+	Description string `json:"description" form:"description" validate:"required"`
+	Address     string `json:"address" form:"address" validate:"required"`
+	Cuisine     string `json:"cuisine" form:"cuisine" validate:"required,max=100"`
+}
+
+type RejectVendorApplicationRequest struct {
+	Reason string `json:"reason" form:"reason" validate:"required"`
+}
+
+// OpeningHoursRequest replaces the weekly schedule of a vendor, hours can
+// only be sent as JSON
+type OpeningHoursRequest struct {
+	TimeZone string            `json:"time_zone" form:"time_zone" validate:"required,max=64"`
+	Hours    []OpeningInterval `json:"hours" form:"-" validate:"max=50"`
+}
+
+// DeliveryZoneRequest describes a delivery zone, radius zones are centered
+// on the vendor's location unless a center is given. The polygon can only be
+// sent as JSON.
+type DeliveryZoneRequest struct {
+	Name            string   `json:"name" form:"name" validate:"required,max=100"`
+	Kind            string   `json:"kind" form:"kind" validate:"required,oneof=radius polygon"`
+	CenterLatitude  *float64 `json:"center_latitude" form:"center_latitude" validate:"min=-90,max=90"`
+	CenterLongitude *float64 `json:"center_longitude" form:"center_longitude" validate:"min=-180,max=180"`
+	RadiusKm        *float64 `json:"radius_km" form:"radius_km" validate:"min=0.1,max=100"`
+	Polygon         Polygon  `json:"polygon" form:"-" validate:"max=500"`
+	Fee             Money    `json:"fee" form:"fee" validate:"min=0,max=99999999"`
+	MinOrder        Money    `json:"min_order" form:"min_order" validate:"min=0,max=99999999"`
+}
+
+// CheckoutRequest picks the delivery address, either a saved address or a
+// point. Without both the default address is used. PaymentMethod is the token
+// of the customer's card at the payment provider, needed when the card is
+// charged. Split orders charge CardAmount to the card and the rest in cash,
+// wallet orders take the whole total from the customer's wallet. WalletAmount
+// takes part of the total from the wallet with the other payment types.
+type CheckoutRequest struct {
+	AddressID     *uuid.UUID `json:"address_id" form:"address_id"`
+	Latitude      *float64   `json:"latitude" form:"latitude" validate:"min=-90,max=90"`
+	Longitude     *float64   `json:"longitude" form:"longitude" validate:"min=-180,max=180"`
+	PaymentType   string     `json:"payment_type" form:"payment_type" validate:"omitempty,oneof=card cash split wallet"`
+	PaymentMethod string     `json:"payment_method" form:"payment_method" validate:"max=100"`
+	CardAmount    Money      `json:"card_amount" form:"card_amount" validate:"min=0,max=99999999"`
+	WalletAmount  Money      `json:"wallet_amount" form:"wallet_amount" validate:"min=0,max=99999999"`
+}
+
+// RefundRequest cancels and refunds order lines: Items lists the quantity of
+// each item to refund and Delivery refunds the delivery charge. Full refunds
+// everything that was not refunded yet. ToWallet credits the customer's
+// wallet instead of refunding the card or handing back cash. Items can only
+// be sent as JSON.
+type RefundRequest struct {
+	Reason   string              `json:"reason" form:"reason" validate:"required,max=500"`
+	Full     bool                `json:"full" form:"full"`
+	Delivery bool                `json:"delivery" form:"delivery"`
+	ToWallet bool                `json:"to_wallet" form:"to_wallet"`
+	Items    []RefundItemRequest `json:"items" form:"-" validate:"max=100"`
+}
+
+type RefundItemRequest struct {
+	ItemID   uuid.UUID `json:"item_id" validate:"required"`
+	Quantity int       `json:"quantity" validate:"required,min=1,max=100"`
+}
+
+// CashPaymentRequest records the cash a customer handed over, the change is
+// worked out from what the order still owes
+type CashPaymentRequest struct {
+	Tendered Money `json:"tendered" form:"tendered" validate:"required,min=0,max=99999999"`
+}
+
+type AddressRequest struct {
+	Label        string   `json:"label" form:"label" validate:"required,max=50"`
+	Address      string   `json:"address" form:"address" validate:"required,max=500"`
+	Latitude     *float64 `json:"latitude" form:"latitude" validate:"min=-90,max=90"`
+	Longitude    *float64 `json:"longitude" form:"longitude" validate:"min=-180,max=180"`
+	Instructions string   `json:"instructions" form:"instructions" validate:"max=500"`
+	IsDefault    bool     `json:"is_default" form:"is_default"`
+}
+
+type ClosureRequest struct {
+	Date   string `json:"date" form:"date" validate:"required"`
+	Reason string `json:"reason" form:"reason" validate:"max=255"`
+}
+
+type UpdateVendorProfileRequest struct {
+	Name        string `json:"name" form:"name" validate:"max=255"`
+	Description string `json:"description" form:"description"`
+	Phone       string `json:"phone" form:"phone" validate:"omitempty,e164"`
+	Address     string `json:"address" form:"address"`
+	Cuisine     string `json:"cuisine" form:"cuisine" validate:"max=100"`
+	// PricesIncludeTax tells whether menu prices and delivery fees contain the tax
+	PricesIncludeTax *bool `json:"prices_include_tax" form:"prices_include_tax"`
+	// Latitude and Longitude are set together
+	Latitude  *float64 `json:"latitude" form:"latitude" validate:"min=-90,max=90"`
+	Longitude *float64 `json:"longitude" form:"longitude" validate:"min=-180,max=180"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" form:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" form:"token" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required,password"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" form:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" form:"new_password" validate:"required,password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+type InviteAdminRequest struct {
+	Email string `json:"email" form:"email" validate:"required,email"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" form:"token" validate:"required"`
+	Username string `json:"username" form:"username" validate:"required,max=255"`
+	Phone    string `json:"phone" form:"phone" validate:"required,e164"`
+	Password string `json:"password" form:"password" validate:"required,password"`
+}
+
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions" form:"permissions"`
+}
+
+type RoleRequest struct {
+	Name        string   `json:"name" form:"name" validate:"required,max=100"`
+	Permissions []string `json:"permissions" form:"permissions"`
+}
+
+type InviteStaffRequest struct {
+	Email  string `json:"email" form:"email" validate:"required,email"`
+	RoleID int    `json:"role_id" form:"role_id" validate:"required"`
+}
+
+type StaffRoleRequest struct {
+	RoleID int `json:"role_id" form:"role_id" validate:"required"`
+}
+
+type ItemRequest struct {
+	Name        string `json:"name" form:"name" validate:"required,max=255"`
+	Description string `json:"description" form:"description" validate:"max=2000"`
+	Price       Money  `json:"price" form:"price" validate:"required,min=0.01,max=99999999"`
+	TaxCategory string `json:"tax_category" form:"tax_category" validate:"omitempty,oneof=food alcohol"`
+}
+
+type UpdateItemRequest struct {
+	Name        string  `json:"name" form:"name" validate:"max=255"`
+	Description *string `json:"description" form:"description" validate:"max=2000"`
+	Price       *Money  `json:"price" form:"price" validate:"min=0.01,max=99999999"`
+	TaxCategory string  `json:"tax_category" form:"tax_category" validate:"omitempty,oneof=food alcohol"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status" form:"status" validate:"required,oneof=accepted preparing ready completed cancelled"`
+}
+
+type CartItemRequest struct {
+	ItemID   uuid.UUID `json:"item_id" form:"item_id" validate:"required"`
+	Quantity int       `json:"quantity" form:"quantity" validate:"min=0,max=100"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" form:"code" validate:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" form:"password" validate:"required"`
+	Code     string `json:"code" form:"code" validate:"required"`
+}
+
+// VerifyLoginRequest completes a login challenge with either an authenticator
+// code or one of the recovery codes
+type VerifyLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" form:"challenge_token" validate:"required"`
+	Code           string `json:"code" form:"code"`
+	RecoveryCode   string `json:"recovery_code" form:"recovery_code"`
+}
+
+// ExchangeRateRequest sets how many units of the base currency one unit of a
+// currency is worth, as a decimal such as "0.2071"
+type ExchangeRateRequest struct {
+	Rate json.Number `json:"rate" form:"rate" validate:"required"`
+}
+
+// TaxJurisdictionRequest creates or replaces a jurisdiction, rates can only
+// be sent as JSON
+type TaxJurisdictionRequest struct {
+	Code  string           `json:"code" form:"code" validate:"required,max=20"`
+	Name  string           `json:"name" form:"name" validate:"required,max=100"`
+	Rates []TaxRateRequest `json:"rates" form:"-" validate:"max=3"`
+}
+
+type TaxRateRequest struct {
+	Category string      `json:"category" validate:"required,oneof=food alcohol delivery"`
+	Rate     json.Number `json:"rate" validate:"required"`
+}
+
+// VendorTaxJurisdictionRequest assigns a jurisdiction to a vendor, none
+// clears it
+type VendorTaxJurisdictionRequest struct {
+	JurisdictionID *uuid.UUID `json:"jurisdiction_id" form:"jurisdiction_id"`
+}
+
+// VendorCurrencyRequest changes the currency a vendor prices its menu in
+type VendorCurrencyRequest struct {
+	Currency string `json:"currency" form:"currency" validate:"required,currency"`
+}
+
+// VendorCommissionRequest sets the commission of a vendor, without a percent
+// the vendor pays the platform's
+type VendorCommissionRequest struct {
+	Percent  json.Number `json:"percent" form:"percent"`
+	FixedFee Money       `json:"fixed_fee" form:"fixed_fee" validate:"min=0,max=99999999"`
+}
+
+// GeneratePayoutsRequest asks for the statements of every vendor, or of one,
+// up to the end of a day
+type GeneratePayoutsRequest struct {
+	VendorID *uuid.UUID `json:"vendor_id" form:"vendor_id"`
+	Until    string     `json:"until" form:"until" validate:"required"`
+}
+
+type PayoutPaidRequest struct {
+	PaymentReference string `json:"payment_reference" form:"payment_reference" validate:"required,max=200"`
+}
+
+// WalletTopUpRequest charges the customer's card to add to their wallet
+type WalletTopUpRequest struct {
+	Amount        Money  `json:"amount" form:"amount" validate:"min=0,max=99999999"`
+	Currency      string `json:"currency" form:"currency" validate:"required,currency"`
+	PaymentMethod string `json:"payment_method" form:"payment_method" validate:"required,max=100"`
+}
+
+// WalletPromotionRequest gives a customer credit that expires
+type WalletPromotionRequest struct {
+	Amount      Money     `json:"amount" form:"amount" validate:"min=0,max=99999999"`
+	Currency    string    `json:"currency" form:"currency" validate:"required,currency"`
+	ExpiresAt   time.Time `json:"expires_at" form:"expires_at" validate:"required"`
+	Description string    `json:"description" form:"description" validate:"max=200"`
+}
+
+type RequireTwoFactorRequest struct {
+	Required bool `json:"required" form:"required"`
+}
+
+// PromotionRequest describes a promotion, only the fields of its kind are
+// kept. Vendors can't set vendor_id, their promotions are always their own.
+// Currency is only read for platform-wide promotions with an amount or a
+// minimum spend.
+type PromotionRequest struct {
+	Code               string      `json:"code" form:"code" validate:"required,max=40"`
+	Description        string      `json:"description" form:"description" validate:"max=500"`
+	VendorID           *uuid.UUID  `json:"vendor_id" form:"vendor_id"`
+	Kind               string      `json:"kind" form:"kind" validate:"required,oneof=percentage fixed free_delivery buy_x_get_y"`
+	Percent            json.Number `json:"percent" form:"percent"`
+	Amount             Money       `json:"amount" form:"amount" validate:"min=0,max=99999999"`
+	ItemID             *uuid.UUID  `json:"item_id" form:"item_id"`
+	BuyQuantity        int         `json:"buy_quantity" form:"buy_quantity" validate:"omitempty,min=1,max=100"`
+	GetQuantity        int         `json:"get_quantity" form:"get_quantity" validate:"omitempty,min=1,max=100"`
+	MinSpend           Money       `json:"min_spend" form:"min_spend" validate:"min=0,max=99999999"`
+	Currency           string      `json:"currency" form:"currency" validate:"omitempty,currency"`
+	StartsAt           *time.Time  `json:"starts_at" form:"starts_at"`
+	EndsAt             *time.Time  `json:"ends_at" form:"ends_at"`
+	MaxUses            int         `json:"max_uses" form:"max_uses" validate:"omitempty,min=1"`
+	MaxUsesPerCustomer int         `json:"max_uses_per_customer" form:"max_uses_per_customer" validate:"omitempty,min=1"`
+	Active             *bool       `json:"active" form:"active"`
+}
+
+type CouponRequest struct {
+	Code string `json:"code" form:"code" validate:"required,max=40"`
+}
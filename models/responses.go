@@ -0,0 +1,572 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Response DTOs are the only types handlers send back to clients. They never
+// carry sensitive columns such as password hashes, whatever the model holds.
+
+type UserResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Img       string    `json:"img,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerified bool `json:"email_verified"`
+}
+
+func NewUserResponse(user User) UserResponse {
+	return UserResponse{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Img:           user.Img,
+		Phone:         user.Phone,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		EmailVerified: user.EmailVerified,
+	}
+}
+
+func NewUserResponses(users []User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, NewUserResponse(user))
+	}
+	return responses
+}
+
+type AdminResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Img       string    `json:"img,omitempty"`
+	Phone     string    `json:"phone,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewAdminResponse(user User) AdminResponse {
+	return AdminResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Img:       user.Img,
+		Phone:     user.Phone,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+type VendorResponse struct {
+	ID                uuid.UUID  `json:"id"`
+	Name              string     `json:"name"`
+	Email             string     `json:"email"`
+	Phone             string     `json:"phone"`
+	Img               string     `json:"img"`
+	Description       string     `json:"description"`
+	Address           string     `json:"address"`
+	Cuisine           string     `json:"cuisine"`
+	Latitude          *float64   `json:"latitude"`
+	Longitude         *float64   `json:"longitude"`
+	TimeZone          string     `json:"time_zone"`
+	Currency          string     `json:"currency"`
+	TaxJurisdictionID *uuid.UUID `json:"tax_jurisdiction_id"`
+	PricesIncludeTax  bool       `json:"prices_include_tax"`
+	IsOpenNow         bool       `json:"is_open_now"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+func NewVendorResponse(vendor Vendor) VendorResponse {
+	return VendorResponse{
+		ID:                vendor.ID,
+		Name:              vendor.Name,
+		Email:             vendor.Email,
+		Phone:             vendor.Phone,
+		Img:               vendor.Img,
+		Description:       vendor.Description,
+		Address:           vendor.Address,
+		Cuisine:           vendor.Cuisine,
+		Latitude:          vendor.Latitude,
+		Longitude:         vendor.Longitude,
+		TimeZone:          vendor.TimeZone,
+		Currency:          vendor.Currency,
+		TaxJurisdictionID: vendor.TaxJurisdictionID,
+		PricesIncludeTax:  vendor.PricesIncludeTax,
+		IsOpenNow:         vendor.IsOpenNow,
+		CreatedAt:         vendor.CreatedAt,
+	}
+}
+
+func NewVendorResponses(vendors []Vendor) []VendorResponse {
+	responses := make([]VendorResponse, 0, len(vendors))
+	for _, vendor := range vendors {
+		responses = append(responses, NewVendorResponse(vendor))
+	}
+	return responses
+}
+
+// NearbyVendorResponse is a vendor with its distance from the searched point
+type NearbyVendorResponse struct {
+	VendorResponse
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// DeliveryQuoteResponse tells whether a vendor delivers to a point and for how much
+type DeliveryQuoteResponse struct {
+	Delivers bool       `json:"delivers"`
+	ZoneID   *uuid.UUID `json:"zone_id,omitempty"`
+	ZoneName string     `json:"zone_name,omitempty"`
+	Fee      Money      `json:"fee"`
+	MinOrder Money      `json:"min_order"`
+	Currency string     `json:"currency"`
+}
+
+// SearchResponse holds the matches of a search, Fuzzy is set when some of them
+// come from the typo tolerant name match instead of the full-text search
+type SearchResponse struct {
+	Query   string               `json:"query"`
+	Fuzzy   bool                 `json:"fuzzy"`
+	Items   []ItemSearchResult   `json:"items"`
+	Vendors []VendorSearchResult `json:"vendors"`
+}
+
+// ItemSearchResult is a matching menu item, Snippet is HTML with the matched
+// words in <mark> tags
+type ItemSearchResult struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Img         string    `json:"img,omitempty" db:"img"`
+	Price       Money     `json:"price" db:"price"`
+	VendorID    uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	VendorName  string    `json:"vendor_name" db:"vendor_name"`
+	Snippet     string    `json:"snippet" db:"snippet"`
+	Rank        float64   `json:"rank" db:"rank"`
+}
+
+type VendorSearchResult struct {
+	ID      uuid.UUID `json:"id" db:"id"`
+	Name    string    `json:"name" db:"name"`
+	Img     string    `json:"img,omitempty" db:"img"`
+	Cuisine string    `json:"cuisine" db:"cuisine"`
+	Snippet string    `json:"snippet" db:"snippet"`
+	Rank    float64   `json:"rank" db:"rank"`
+}
+
+type OpeningHoursResponse struct {
+	TimeZone  string            `json:"time_zone" db:"time_zone"`
+	IsOpenNow bool              `json:"is_open_now" db:"is_open_now"`
+	Hours     []OpeningInterval `json:"hours" db:"-"`
+}
+
+type VendorApplicationResponse struct {
+	ID              uuid.UUID                   `json:"id"`
+	Name            string                      `json:"name"`
+	Email           string                      `json:"email"`
+	Phone           string                      `json:"phone"`
+	Description     string                      `json:"description"`
+	Address         string                      `json:"address"`
+	Cuisine         string                      `json:"cuisine"`
+	Logo            string                      `json:"logo,omitempty"`
+	Status          string                      `json:"status"`
+	RejectionReason *string                     `json:"rejection_reason,omitempty"`
+	ReviewedAt      *time.Time                  `json:"reviewed_at,omitempty"`
+	VendorID        *uuid.UUID                  `json:"vendor_id,omitempty"`
+	Documents       []VendorApplicationDocument `json:"documents"`
+	CreatedAt       time.Time                   `json:"created_at"`
+}
+
+func NewVendorApplicationResponse(application VendorApplication, documents []VendorApplicationDocument) VendorApplicationResponse {
+	return VendorApplicationResponse{
+		ID:              application.ID,
+		Name:            application.Name,
+		Email:           application.Email,
+		Phone:           application.Phone,
+		Description:     application.Description,
+		Address:         application.Address,
+		Cuisine:         application.Cuisine,
+		Logo:            application.Logo,
+		Status:          application.Status,
+		RejectionReason: application.RejectionReason,
+		ReviewedAt:      application.ReviewedAt,
+		VendorID:        application.VendorID,
+		Documents:       documents,
+		CreatedAt:       application.CreatedAt,
+	}
+}
+
+// SessionResponse carries the bearer token of a new session, it is only ever
+// sent once, right after the session is created
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type UserLoginResponse struct {
+	UserResponse
+	SessionResponse
+}
+
+func NewAdminResponses(users []User) []AdminResponse {
+	responses := make([]AdminResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, NewAdminResponse(user))
+	}
+	return responses
+}
+
+type AdminInvitationResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type StaffResponse struct {
+	ID       uuid.UUID `json:"id" db:"id"`
+	Name     string    `json:"name" db:"name"`
+	Email    string    `json:"email" db:"email"`
+	Phone    string    `json:"phone,omitempty" db:"phone"`
+	RoleID   int       `json:"role_id" db:"role_id"`
+	Role     string    `json:"role" db:"role"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+}
+
+type StaffInvitationResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	RoleID    int       `json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AdminLoginResponse struct {
+	AdminResponse
+	SessionResponse
+	// TwoFactorEnrollmentRequired is set when an admin enforced 2FA on the
+	// account and it is not enrolled yet, only /auth/2fa endpoints work until it is
+	TwoFactorEnrollmentRequired bool `json:"two_factor_enrollment_required,omitempty"`
+}
+
+type VendorLoginResponse struct {
+	UserResponse
+	// VendorID is the vendor the user owns or works for
+	VendorID uuid.UUID `json:"vendor_id"`
+	SessionResponse
+	TwoFactorEnrollmentRequired bool `json:"two_factor_enrollment_required,omitempty"`
+}
+
+// TwoFactorChallengeResponse answers a password login when 2FA is enabled,
+// the challenge is traded for a session at /auth/2fa/verify
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse lists recovery codes in clear, only right after they are generated
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type CartItemResponse struct {
+	ItemID      uuid.UUID `json:"item_id" db:"item_id"`
+	Name        string    `json:"name" db:"name"`
+	Img         string    `json:"img,omitempty" db:"img"`
+	VendorID    uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	Price       Money     `json:"price" db:"price"`
+	TaxCategory string    `json:"tax_category" db:"tax_category"`
+	Quantity    int       `json:"quantity" db:"quantity"`
+	LineTotal   Money     `json:"line_total" db:"line_total"`
+}
+
+type CartResponse struct {
+	ID         uuid.UUID           `json:"id"`
+	Items      []CartItemResponse  `json:"items"`
+	Quantity   int                 `json:"quantity"`
+	TotalPrice Money               `json:"total_price"`
+	Currency   *string             `json:"currency"`
+	Coupon     *CartCouponResponse `json:"coupon"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// CartCouponResponse is the coupon applied to a cart and what it takes off the
+// items right now. Free delivery is only known at checkout, once the delivery
+// zone is. Unavailable tells why the coupon would be refused at checkout.
+type CartCouponResponse struct {
+	Code         string `json:"code"`
+	Description  string `json:"description"`
+	Discount     Money  `json:"discount"`
+	FreeDelivery bool   `json:"free_delivery"`
+	Unavailable  string `json:"unavailable,omitempty"`
+}
+
+type OrderItemResponse struct {
+	ItemID      uuid.UUID `json:"item_id" db:"item_id"`
+	Name        string    `json:"name" db:"name"`
+	Quantity    int       `json:"quantity" db:"quantity"`
+	Price       Money     `json:"price" db:"price"`
+	Discount    Money     `json:"discount" db:"discount"`
+	TaxCategory string    `json:"tax_category" db:"tax_category"`
+	TaxRate     string    `json:"tax_rate" db:"tax_rate"`
+	TaxAmount   Money     `json:"tax_amount" db:"tax_amount"`
+	// RefundedQuantity is how many of the line were cancelled and refunded
+	RefundedQuantity int `json:"refunded_quantity" db:"refunded_quantity"`
+}
+
+// TaxSummary is the tax an order was charged at one rate of a category
+type TaxSummary struct {
+	Category string `json:"category"`
+	Rate     string `json:"rate"`
+	Amount   Money  `json:"amount"`
+}
+
+type OrderResponse struct {
+	ID                   uuid.UUID           `json:"id"`
+	CustomerID           uuid.UUID           `json:"customer_id"`
+	VendorID             uuid.UUID           `json:"vendor_id"`
+	Status               string              `json:"status"`
+	OrderTotalCost       Money               `json:"order_total_cost"`
+	Currency             string              `json:"currency"`
+	DeliveryFee          Money               `json:"delivery_fee"`
+	CouponCode           *string             `json:"coupon_code"`
+	DiscountTotal        Money               `json:"discount_total"`
+	DeliveryDiscount     Money               `json:"delivery_discount"`
+	PricesIncludeTax     bool                `json:"prices_include_tax"`
+	TaxTotal             Money               `json:"tax_total"`
+	Taxes                []TaxSummary        `json:"taxes"`
+	DeliveryAddress      string              `json:"delivery_address,omitempty"`
+	DeliveryInstructions string              `json:"delivery_instructions,omitempty"`
+	PaymentType          string              `json:"payment_type"`
+	CashDue              Money               `json:"cash_due"`
+	WalletPaid           Money               `json:"wallet_paid"`
+	RefundedTotal        Money               `json:"refunded_total"`
+	NetTotal             Money               `json:"net_total"`
+	Items                []OrderItemResponse `json:"items"`
+	Payments             []PaymentIntent     `json:"payments"`
+	CreatedAt            time.Time           `json:"created_at"`
+}
+
+func NewOrderResponse(order Order, items []OrderItemResponse, payments []PaymentIntent) OrderResponse {
+	return OrderResponse{
+		ID:                   order.ID,
+		CustomerID:           order.CustomerID,
+		VendorID:             order.VendorID,
+		Status:               order.Status,
+		OrderTotalCost:       order.OrderTotalCost,
+		Currency:             order.Currency,
+		DeliveryFee:          order.DeliveryFee,
+		CouponCode:           order.CouponCode,
+		DiscountTotal:        order.DiscountTotal,
+		DeliveryDiscount:     order.DeliveryDiscount,
+		PricesIncludeTax:     order.PricesIncludeTax,
+		TaxTotal:             order.TaxTotal,
+		Taxes:                orderTaxes(order, items),
+		DeliveryAddress:      order.DeliveryAddress,
+		DeliveryInstructions: order.DeliveryInstructions,
+		PaymentType:          order.PaymentType,
+		CashDue:              order.CashDue,
+		WalletPaid:           order.WalletPaid,
+		RefundedTotal:        order.RefundedTotal,
+		NetTotal:             order.OrderTotalCost.Sub(order.RefundedTotal),
+		Items:                items,
+		Payments:             payments,
+		CreatedAt:            order.CreatedAt,
+	}
+}
+
+// orderTaxes sums the tax of the order lines and of the delivery fee per
+// category and rate, untaxed categories are left out
+func orderTaxes(order Order, items []OrderItemResponse) []TaxSummary {
+	taxes := []TaxSummary{}
+	add := func(category, rate string, amount Money) {
+		if amount.IsZero() {
+			return
+		}
+		for i := range taxes {
+			if taxes[i].Category == category && taxes[i].Rate == rate {
+				taxes[i].Amount = taxes[i].Amount.Add(amount)
+				return
+			}
+		}
+		taxes = append(taxes, TaxSummary{Category: category, Rate: rate, Amount: amount})
+	}
+	for _, item := range items {
+		add(item.TaxCategory, item.TaxRate, item.TaxAmount)
+	}
+	add(TaxCategoryDelivery, order.DeliveryTaxRate, order.DeliveryTax)
+	return taxes
+}
+
+// Payment statuses of an order balance
+const (
+	BalanceUnpaid        = "unpaid"
+	BalancePartiallyPaid = "partially_paid"
+	BalancePaid          = "paid"
+	BalanceOverpaid      = "overpaid"
+)
+
+// OrderBalanceResponse reconciles what was paid for an order with what it
+// owes, the order_total_cost less the refunds or nothing once cancelled or
+// when its payment failed. CardAuthorized is held on the card and not
+// captured yet, CardPaid was captured less the refunds and CashReceived was
+// collected less the cash handed back. WalletPaid came from the customer's
+// wallet and WalletRefunded went back to it, however the order was paid.
+// Balance is what the order still owes, negative when too much was paid.
+type OrderBalanceResponse struct {
+	OrderID        uuid.UUID     `json:"order_id" db:"order_id"`
+	Status         string        `json:"status" db:"status"`
+	PaymentType    string        `json:"payment_type" db:"payment_type"`
+	Currency       string        `json:"currency" db:"currency"`
+	OrderTotalCost Money         `json:"order_total_cost" db:"order_total_cost"`
+	RefundedTotal  Money         `json:"refunded_total" db:"refunded_total"`
+	CardAuthorized Money         `json:"card_authorized" db:"card_authorized"`
+	CardPaid       Money         `json:"card_paid" db:"card_paid"`
+	CashDue        Money         `json:"cash_due" db:"cash_due"`
+	CashReceived   Money         `json:"cash_received" db:"cash_received"`
+	WalletPaid     Money         `json:"wallet_paid" db:"wallet_paid"`
+	WalletRefunded Money         `json:"wallet_refunded" db:"wallet_refunded"`
+	Paid           Money         `json:"paid" db:"-"`
+	Balance        Money         `json:"balance" db:"-"`
+	PaymentStatus  string        `json:"payment_status" db:"-"`
+	CashPayments   []CashPayment `json:"cash_payments,omitempty" db:"-"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+}
+
+// Reconcile works out Paid, Balance and PaymentStatus from the payments
+func (b *OrderBalanceResponse) Reconcile() {
+	owed := b.OrderTotalCost.Sub(b.RefundedTotal)
+	if b.Status == OrderStatusCancelled || b.Status == OrderStatusPaymentFailed {
+		owed = NewMoney(0, b.Currency)
+	}
+	b.Paid = b.CardPaid.Add(b.CashReceived).Add(b.WalletPaid).Sub(b.WalletRefunded)
+	b.Balance = owed.Sub(b.Paid)
+	switch {
+	case b.Balance.IsNegative():
+		b.PaymentStatus = BalanceOverpaid
+	case b.Balance.IsZero():
+		b.PaymentStatus = BalancePaid
+	case b.Paid.IsZero():
+		b.PaymentStatus = BalanceUnpaid
+	default:
+		b.PaymentStatus = BalancePartiallyPaid
+	}
+}
+
+// CashOutstanding is the cash the order still has to collect
+func (b OrderBalanceResponse) CashOutstanding() Money {
+	return b.CashDue.Sub(b.CashReceived)
+}
+
+// CashPaymentResponse is recorded cash with the order balance it leaves
+type CashPaymentResponse struct {
+	Payment CashPayment          `json:"payment"`
+	Balance OrderBalanceResponse `json:"balance"`
+}
+
+// RefundResponse is a refund with the order it leaves
+type RefundResponse struct {
+	Refund Refund        `json:"refund"`
+	Order  OrderResponse `json:"order"`
+}
+
+// ReconciliationReportResponse lists the completed and cancelled orders of a
+// period whose payments don't match what they owe
+type ReconciliationReportResponse struct {
+	From       *time.Time             `json:"from,omitempty"`
+	To         *time.Time             `json:"to,omitempty"`
+	Orders     int                    `json:"orders"`
+	Mismatches []OrderBalanceResponse `json:"mismatches"`
+}
+
+type ExchangeRateResponse struct {
+	Currency     string    `json:"currency" db:"currency"`
+	BaseCurrency string    `json:"base_currency" db:"base_currency"`
+	Rate         string    `json:"rate" db:"rate"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SalesReportResponse sums the orders of a period per currency and in the base
+// currency. Currencies without an exchange rate are left out of Total and
+// listed in Unconverted.
+type SalesReportResponse struct {
+	From         *time.Time            `json:"from,omitempty"`
+	To           *time.Time            `json:"to,omitempty"`
+	BaseCurrency string                `json:"base_currency"`
+	Currencies   []CurrencySalesReport `json:"currencies"`
+	Total        Money                 `json:"total"`
+	Unconverted  []string              `json:"unconverted"`
+}
+
+type CurrencySalesReport struct {
+	Currency string  `json:"currency"`
+	Orders   int     `json:"orders"`
+	Total    Money   `json:"total"`
+	Rate     *string `json:"rate"`
+	// BaseTotal is Total in the base currency, nil without a rate
+	BaseTotal *Money `json:"base_total"`
+}
+
+type RoleResponse struct {
+	ID          int            `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Scope       string         `json:"scope" db:"scope"`
+	VendorID    *uuid.UUID     `json:"vendor_id,omitempty" db:"vendor_id"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+}
+
+// AccountPostingResponse is a posting of an account with the entry it belongs to
+type AccountPostingResponse struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	EntryID     uuid.UUID  `json:"entry_id" db:"entry_id"`
+	Kind        string     `json:"kind" db:"kind"`
+	OrderID     *uuid.UUID `json:"order_id" db:"order_id"`
+	ReferenceID *uuid.UUID `json:"reference_id" db:"reference_id"`
+	Description string     `json:"description" db:"description"`
+	Amount      Money      `json:"amount" db:"amount"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// LedgerCheckResponse lists what breaks the ledger invariants, nothing when it is sound
+type LedgerCheckResponse struct {
+	Entries  int      `json:"entries"`
+	Postings int      `json:"postings"`
+	Problems []string `json:"problems"`
+}
+
+// PaymentSettlementResponse counts what settle-payments did: the pending
+// checkouts it gave up on, the pending operations it settled and what is left
+// pending because the provider still can't be reached
+type PaymentSettlementResponse struct {
+	Abandoned int `json:"abandoned"`
+	Settled   int `json:"settled"`
+	Pending   int `json:"pending"`
+}
+
+// VendorCommissionResponse is the commission a vendor pays, Percent is nil
+// when it is the platform's PlatformPercent
+type VendorCommissionResponse struct {
+	VendorID        uuid.UUID `json:"vendor_id" db:"vendor_id"`
+	Percent         *string   `json:"percent" db:"percent"`
+	PlatformPercent string    `json:"platform_percent" db:"-"`
+	FixedFee        Money     `json:"fixed_fee" db:"fixed_fee"`
+}
+
+// WalletTransactionResponse is a wallet transaction with the wallet it leaves
+type WalletTransactionResponse struct {
+	Transaction WalletTransaction `json:"transaction"`
+	Wallet      Wallet            `json:"wallet"`
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fill sets every field of v to a non-zero value so that omitempty fields are
+// marshalled too
+func fill(v reflect.Value, depth int) {
+	if depth > 6 || !v.CanSet() {
+		return
+	}
+	switch v.Type() {
+	case reflect.TypeOf(Money{}):
+		v.Set(reflect.ValueOf(NewMoney(1250, "USD")))
+		return
+	case reflect.TypeOf(time.Time{}):
+		v.Set(reflect.ValueOf(time.Now()))
+		return
+	case reflect.TypeOf(json.Number("")):
+		v.SetString("1")
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), depth+1)
+		}
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), depth+1)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0), depth+1)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key, depth+1)
+		fill(value, depth+1)
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fill(v.Field(i), depth+1)
+		}
+	}
+}
+
+// sensitiveKeys lists the keys of a decoded JSON value that look like secrets
+func sensitiveKeys(v any, path string) []string {
+	var found []string
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			name := strings.ToLower(key)
+			if strings.Contains(name, "password") || strings.HasSuffix(name, "_hash") || name == "totp_secret" {
+				found = append(found, path+"."+key)
+			}
+			found = append(found, sensitiveKeys(value, path+"."+key)...)
+		}
+	case []any:
+		for _, value := range v {
+			found = append(found, sensitiveKeys(value, path+"[]")...)
+		}
+	}
+	return found
+}
+
+// checkedResponses are marshalled by TestResponsesHaveNoSecrets, pointers to
+// the zero value are filled first. TestEveryResponseTypeIsChecked fails when a
+// response type or a model sent by a handler is missing.
+var checkedResponses = []any{
+	&UserResponse{},
+	&AdminResponse{},
+	&VendorResponse{},
+	&NearbyVendorResponse{},
+	&DeliveryQuoteResponse{},
+	&SearchResponse{},
+	&ItemSearchResult{},
+	&VendorSearchResult{},
+	&OpeningHoursResponse{},
+	&VendorApplicationResponse{},
+	&SessionResponse{},
+	&UserLoginResponse{},
+	&AdminInvitationResponse{},
+	&StaffResponse{},
+	&StaffInvitationResponse{},
+	&AdminLoginResponse{},
+	&VendorLoginResponse{},
+	&TwoFactorChallengeResponse{},
+	&TwoFactorEnrollmentResponse{},
+	&RecoveryCodesResponse{},
+	&CartItemResponse{},
+	&CartResponse{},
+	&CartCouponResponse{},
+	&OrderItemResponse{},
+	&TaxSummary{},
+	&OrderResponse{},
+	&OrderBalanceResponse{},
+	&CashPaymentResponse{},
+	&RefundResponse{},
+	&ReconciliationReportResponse{},
+	&ExchangeRateResponse{},
+	&SalesReportResponse{},
+	&CurrencySalesReport{},
+	&RoleResponse{},
+	&AccountPostingResponse{},
+	&LedgerCheckResponse{},
+	&PaymentSettlementResponse{},
+	&VendorCommissionResponse{},
+	&WalletTransactionResponse{},
+	// Models handlers send as they are
+	&Item{},
+	&Permission{},
+	&OpeningInterval{},
+	&VendorClosure{},
+	&CustomerAddress{},
+	&DeliveryZone{},
+	&TaxJurisdiction{},
+	&Promotion{},
+	&Refund{},
+	&LedgerAccount{},
+	&JournalEntry{},
+	&Payout{},
+	&Wallet{},
+	&WalletTransaction{},
+}
+
+func TestResponsesHaveNoSecrets(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	user := User{Name: "Jo", Email: "jo@example.com", Password: "$2a$10$hash", TOTPSecret: &secret}
+	vendor := Vendor{Name: "Diner", Email: "diner@example.com"}
+
+	tests := []struct {
+		name     string
+		response any
+	}{
+		{"NewUserResponse", NewUserResponse(user)},
+		{"NewUserResponses", NewUserResponses([]User{user})},
+		{"NewAdminResponse", NewAdminResponse(user)},
+		{"NewAdminResponses", NewAdminResponses([]User{user})},
+		{"NewVendorResponse", NewVendorResponse(vendor)},
+		{"NewVendorResponses", NewVendorResponses([]Vendor{vendor})},
+	}
+	for _, response := range checkedResponses {
+		tests = append(tests, struct {
+			name     string
+			response any
+		}{reflect.TypeOf(response).Elem().Name(), response})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v := reflect.ValueOf(tt.response); v.Kind() == reflect.Pointer {
+				fill(v.Elem(), 0)
+			}
+			body, err := json.Marshal(tt.response)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if strings.Contains(string(body), user.Password) || strings.Contains(string(body), secret) {
+				t.Errorf("response carries the password hash or TOTP secret: %s", body)
+			}
+			var decoded any
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			for _, key := range sensitiveKeys(decoded, "$") {
+				t.Errorf("response has sensitive key %s", key)
+			}
+		})
+	}
+}
+
+// TestEveryResponseTypeIsChecked fails when checkedResponses misses a type
+// declared in responses.go or a models type that a handler passes to
+// utils.SendJSONResponse, found by type checking the controllers package
+func TestEveryResponseTypeIsChecked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("type checks the controllers package")
+	}
+	checked := map[string]bool{}
+	for _, response := range checkedResponses {
+		checked[reflect.TypeOf(response).Elem().Name()] = true
+	}
+
+	required := map[string]string{}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "responses.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, object := range file.Scope.Objects {
+		if object.Kind == ast.Typ && ast.IsExported(name) {
+			required[name] = "declared in responses.go"
+		}
+	}
+
+	sent, err := sentTypes(fset, filepath.Join("..", "controllers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, where := range sent {
+		if _, ok := required[name]; !ok {
+			required[name] = "sent at " + where
+		}
+	}
+
+	var missing []string
+	for name, why := range required {
+		if !checked[name] {
+			missing = append(missing, name+" ("+why+")")
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		t.Errorf("checkedResponses is missing %s", name)
+	}
+}
+
+// sentTypes type checks the package in dir and returns the named types passed
+// to utils.SendJSONResponse, with the position of one call sending them
+func sentTypes(fset *token.FileSet, dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := config.Check("resturant/controllers", fset, files, info); err != nil {
+		return nil, err
+	}
+
+	sent := map[string]string{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) != 3 {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || selector.Sel.Name != "SendJSONResponse" {
+				return true
+			}
+			typ := info.TypeOf(call.Args[2])
+			for {
+				switch t := typ.(type) {
+				case *types.Pointer:
+					typ = t.Elem()
+					continue
+				case *types.Slice:
+					typ = t.Elem()
+					continue
+				}
+				break
+			}
+			// Types of other packages are never in checkedResponses, handlers
+			// have to send models types
+			if named, ok := typ.(*types.Named); ok && named.Obj().Pkg() != nil {
+				name := named.Obj().Name()
+				if path := named.Obj().Pkg().Path(); path != "resturant/models" {
+					name = path + "." + name
+				}
+				sent[name] = fset.Position(call.Pos()).String()
+			}
+			return true
+		})
+	}
+	return sent, nil
+}
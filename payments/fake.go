@@ -0,0 +1,86 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"resturant/models"
+	"strings"
+)
+
+// Payment methods the fake provider treats specially, any other method
+// starting with "tok_" is authorized
+const (
+	FakeMethodDeclined          = "tok_declined"
+	FakeMethodInsufficientFunds = "tok_insufficient_funds"
+	FakeMethodUnavailable       = "tok_unavailable"
+)
+
+// ErrUnavailable is returned by the fake provider for FakeMethodUnavailable,
+// to try out how callers deal with an unreachable provider
+var ErrUnavailable = errors.New("payment provider unavailable")
+
+// FakeProvider is a deterministic local provider that moves no money, for
+// development and tests. Payment IDs derive from the idempotency key and the
+// outcome only depends on the payment method, so the same request always gets
+// the same answer. It keeps no state: capturing, refunding and voiding always
+// succeed, callers check amounts against the payments they stored.
+//
+// Webhooks are signed with the hex HMAC-SHA256 of the payload under
+// WebhookSecret, see Sign.
+type FakeProvider struct {
+	WebhookSecret string
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(req AuthorizeRequest) (Result, error) {
+	sum := sha256.Sum256([]byte(req.IdempotencyKey))
+	result := Result{PaymentID: "fake_" + hex.EncodeToString(sum[:12]), Status: StatusAuthorized}
+	switch {
+	case req.PaymentMethod == FakeMethodUnavailable:
+		return Result{}, ErrUnavailable
+	case req.PaymentMethod == FakeMethodDeclined:
+		result.Status, result.DeclineReason = StatusDeclined, "card_declined"
+	case req.PaymentMethod == FakeMethodInsufficientFunds:
+		result.Status, result.DeclineReason = StatusDeclined, "insufficient_funds"
+	case !strings.HasPrefix(req.PaymentMethod, "tok_"):
+		result.Status, result.DeclineReason = StatusDeclined, "invalid_payment_method"
+	case req.Amount.IsNegative() || req.Amount.IsZero():
+		result.Status, result.DeclineReason = StatusDeclined, "invalid_amount"
+	}
+	return result, nil
+}
+
+func (p *FakeProvider) Capture(paymentID string, amount models.Money, idempotencyKey string) (Result, error) {
+	return Result{PaymentID: paymentID, Status: StatusCaptured}, nil
+}
+
+func (p *FakeProvider) Refund(paymentID string, amount models.Money, idempotencyKey string) (Result, error) {
+	return Result{PaymentID: paymentID, Status: StatusRefunded}, nil
+}
+
+func (p *FakeProvider) Void(paymentID string, idempotencyKey string) (Result, error) {
+	return Result{PaymentID: paymentID, Status: StatusVoided}, nil
+}
+
+// Sign returns the signature of a webhook payload, to send fake webhooks
+func (p *FakeProvider) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.WebhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	var event Event
+	// Without a secret anyone could sign, so nothing is accepted
+	if p.WebhookSecret == "" || !hmac.Equal([]byte(p.Sign(payload)), []byte(strings.ToLower(signature))) {
+		return event, ErrInvalidSignature
+	}
+	err := json.Unmarshal(payload, &event)
+	return event, err
+}
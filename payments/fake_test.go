@@ -0,0 +1,81 @@
+package payments_test
+
+import (
+	"errors"
+	"resturant/models"
+	"resturant/payments"
+	"testing"
+)
+
+func TestFakeProviderAuthorize(t *testing.T) {
+	amount, err := models.ParseMoney("12.50", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &payments.FakeProvider{}
+
+	tests := []struct {
+		method     string
+		wantStatus string
+		wantReason string
+	}{
+		{"tok_visa", payments.StatusAuthorized, ""},
+		{payments.FakeMethodDeclined, payments.StatusDeclined, "card_declined"},
+		{payments.FakeMethodInsufficientFunds, payments.StatusDeclined, "insufficient_funds"},
+		{"4242424242424242", payments.StatusDeclined, "invalid_payment_method"},
+	}
+	for _, tt := range tests {
+		result, err := provider.Authorize(payments.AuthorizeRequest{Amount: amount, PaymentMethod: tt.method, IdempotencyKey: "order-1"})
+		if err != nil {
+			t.Fatalf("Authorize(%s) error = %v", tt.method, err)
+		}
+		if result.Status != tt.wantStatus || result.DeclineReason != tt.wantReason {
+			t.Errorf("Authorize(%s) = %s %q, want %s %q", tt.method, result.Status, result.DeclineReason, tt.wantStatus, tt.wantReason)
+		}
+	}
+
+	if _, err := provider.Authorize(payments.AuthorizeRequest{Amount: amount, PaymentMethod: payments.FakeMethodUnavailable, IdempotencyKey: "order-1"}); !errors.Is(err, payments.ErrUnavailable) {
+		t.Errorf("Authorize(%s) error = %v, want %v", payments.FakeMethodUnavailable, err, payments.ErrUnavailable)
+	}
+
+	// Retries with the same key get the same payment
+	first, _ := provider.Authorize(payments.AuthorizeRequest{Amount: amount, PaymentMethod: "tok_visa", IdempotencyKey: "order-1"})
+	again, _ := provider.Authorize(payments.AuthorizeRequest{Amount: amount, PaymentMethod: "tok_visa", IdempotencyKey: "order-1"})
+	other, _ := provider.Authorize(payments.AuthorizeRequest{Amount: amount, PaymentMethod: "tok_visa", IdempotencyKey: "order-2"})
+	if first.PaymentID != again.PaymentID {
+		t.Errorf("retry got payment %s, want %s", again.PaymentID, first.PaymentID)
+	}
+	if first.PaymentID == other.PaymentID {
+		t.Errorf("another key got the same payment %s", other.PaymentID)
+	}
+}
+
+func TestFakeProviderVerifyWebhook(t *testing.T) {
+	provider := &payments.FakeProvider{WebhookSecret: "test-secret"}
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","payment_id":"fake_1"}`)
+
+	event, err := provider.VerifyWebhook(payload, provider.Sign(payload))
+	if err != nil {
+		t.Fatalf("VerifyWebhook() error = %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != payments.EventCaptured || event.PaymentID != "fake_1" {
+		t.Errorf("VerifyWebhook() = %+v", event)
+	}
+
+	tests := []struct {
+		name      string
+		provider  *payments.FakeProvider
+		payload   []byte
+		signature string
+	}{
+		{"no signature", provider, payload, ""},
+		{"other secret", provider, payload, (&payments.FakeProvider{WebhookSecret: "other-secret"}).Sign(payload)},
+		{"payload changed", provider, []byte(`{"id":"evt_1","type":"payment.voided","payment_id":"fake_1"}`), provider.Sign(payload)},
+		{"no secret", &payments.FakeProvider{}, payload, (&payments.FakeProvider{}).Sign(payload)},
+	}
+	for _, tt := range tests {
+		if _, err := tt.provider.VerifyWebhook(tt.payload, tt.signature); !errors.Is(err, payments.ErrInvalidSignature) {
+			t.Errorf("%s: VerifyWebhook() error = %v, want %v", tt.name, err, payments.ErrInvalidSignature)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"resturant/models"
+)
+
+// Statuses of a payment at the provider
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusDeclined   = "declined"
+)
+
+// Types of the events providers send to the webhook
+const (
+	EventCaptured = "payment.captured"
+	EventVoided   = "payment.voided"
+	EventRefunded = "payment.refunded"
+	EventFailed   = "payment.failed"
+)
+
+// ErrInvalidSignature is returned by VerifyWebhook when the payload was not
+// signed by the provider
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// AuthorizeRequest asks to hold an amount on the customer's payment method.
+// Retrying with the same idempotency key returns the same payment.
+type AuthorizeRequest struct {
+	Amount         models.Money
+	PaymentMethod  string
+	IdempotencyKey string
+}
+
+// Result is the state of a payment after an operation. A declined operation
+// is not an error, Status is StatusDeclined and DeclineReason tells why.
+type Result struct {
+	PaymentID     string
+	Status        string
+	DeclineReason string
+}
+
+// Event is a change of a payment the provider notifies through the webhook.
+// Reference is the idempotency key of the operation the event answers, empty
+// for changes the provider made on its own such as an expired authorization.
+// Reason tells why a payment.failed operation was declined.
+type Event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	PaymentID string `json:"payment_id"`
+	Reference string `json:"reference,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// PaymentProvider moves money through a payment gateway, the provider is
+// picked from the environment by FromEnv. Errors mean the provider could not
+// be reached or did not answer, the operation may be retried with the same
+// idempotency key: the provider does it once and answers the same again.
+type PaymentProvider interface {
+	// Name identifies the provider on the payments it made
+	Name() string
+	// Authorize holds the amount without charging it
+	Authorize(req AuthorizeRequest) (Result, error)
+	// Capture charges an authorized payment, up to the authorized amount
+	Capture(paymentID string, amount models.Money, idempotencyKey string) (Result, error)
+	// Refund gives back part or all of a captured payment
+	Refund(paymentID string, amount models.Money, idempotencyKey string) (Result, error)
+	// Void releases an authorization that was not captured
+	Void(paymentID string, idempotencyKey string) (Result, error)
+	// VerifyWebhook checks the signature of a webhook payload and decodes it
+	VerifyWebhook(payload []byte, signature string) (Event, error)
+}
+
+// FromEnv builds the provider selected by PAYMENT_PROVIDER, only "fake"
+// exists so far and it must be asked for. PAYMENT_WEBHOOK_SECRET is required,
+// anyone knowing the secret can sign webhooks that mark orders paid.
+func FromEnv() (PaymentProvider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET not set in .env file")
+	}
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "fake":
+		return &FakeProvider{WebhookSecret: secret}, nil
+	case "":
+		return nil, errors.New("PAYMENT_PROVIDER not set in .env file")
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+}
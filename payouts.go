@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"resturant/controllers"
+	"resturant/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// generatePayoutsCommand writes the pending payout statements up to the end
+// of a day, yesterday by default, so they can be generated from cron
+func generatePayoutsCommand(args []string) {
+	flags := flag.NewFlagSet("generate-payouts", flag.ExitOnError)
+	until := flags.String("until", time.Now().AddDate(0, 0, -1).Format(time.DateOnly), "last day included, YYYY-MM-DD")
+	vendor := flags.String("vendor", "", "only the statement of this vendor ID")
+	flags.Parse(args)
+
+	date, err := time.ParseInLocation(time.DateOnly, *until, time.Local)
+	if err != nil {
+		log.Fatalf("-until %q is not a date in YYYY-MM-DD format", *until)
+	}
+	var vendorID *uuid.UUID
+	if *vendor != "" {
+		id, err := uuid.Parse(*vendor)
+		if err != nil {
+			log.Fatalf("-vendor %q is not a UUID", *vendor)
+		}
+		vendorID = &id
+	}
+
+	payouts, err := controllers.GeneratePayouts(date, vendorID)
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	for _, payout := range payouts {
+		fmt.Printf("Payout %s to vendor %s from %s to %s: %s net, %s due\n",
+			payout.ID, payout.VendorID, payout.PeriodStart, payout.PeriodEnd, payout.NetPayout, payout.AmountDue)
+	}
+	fmt.Printf("%d payouts generated\n", len(payouts))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/http"
+	"resturant/controllers"
+	"resturant/docs"
+	"strings"
+
+	"github.com/go-michi/michi"
+)
+
+// routes holds every API route registered through group.handle
+var routes []docs.Route
+
+// group is a router with the prefix it is mounted on and the guard its
+// middlewares enforce, so each route can be checked against the OpenAPI spec
+type group struct {
+	router     *michi.Router
+	prefix     string
+	auth       bool
+	permission string
+}
+
+// requireAuth returns the group behind controllers.RequireAuth
+func (g group) requireAuth() group {
+	g.router = g.router.With(controllers.RequireAuth)
+	g.auth = true
+	return g
+}
+
+// requirePermission returns the group behind controllers.RequirePermission,
+// it must come after requireAuth
+func (g group) requirePermission(permission string) group {
+	g.router = g.router.With(controllers.RequirePermission(permission))
+	g.permission = permission
+	return g
+}
+
+// with returns the group behind middlewares that the spec doesn't describe as
+// auth, like the role and email checks
+func (g group) with(middlewares ...func(http.Handler) http.Handler) group {
+	g.router = g.router.With(middlewares...)
+	return g
+}
+
+// handle registers the handler on the router and records its full pattern
+// (e.g. "POST /customer/signup") and guard
+func (g group) handle(pattern string, handler http.HandlerFunc) {
+	g.router.HandleFunc(pattern, handler)
+	method, path, _ := strings.Cut(pattern, " ")
+	routes = append(routes, docs.Route{
+		Pattern:    method + " " + g.prefix + "/" + strings.TrimPrefix(path, "/"),
+		Auth:       g.auth,
+		Permission: g.permission,
+	})
+}
+
+// newRouter registers every API route, recording their patterns in routes
+func newRouter() *michi.Router {
+	routes = nil
+	r := michi.NewRouter()
+	r.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
+	r.Route("/customer", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/customer"}
+		sub.handle("POST signup", controllers.Signup)
+		sub.handle("POST login", controllers.Login)
+		authed := sub.requireAuth()
+		authed.handle("PUT update/{id}", controllers.UpdateUser)
+		authed.handle("DELETE delete/{id}", controllers.DeleteUser)
+		authed.requirePermission("users:manage").handle("GET users", controllers.GetAllUsers)
+
+		customer := authed.with(controllers.RequireCustomer)
+		customer.handle("GET cart", controllers.GetCart)
+		customer.handle("POST cart/items", controllers.SetCartItem)
+		customer.handle("DELETE cart/items/{item_id}", controllers.RemoveCartItem)
+		customer.handle("POST cart/coupon", controllers.ApplyCoupon)
+		customer.handle("DELETE cart/coupon", controllers.RemoveCoupon)
+		customer.handle("GET addresses", controllers.GetAddresses)
+		customer.handle("POST addresses", controllers.CreateAddress)
+		customer.handle("PUT addresses/{id}", controllers.UpdateAddress)
+		customer.handle("PUT addresses/{id}/default", controllers.SetDefaultAddress)
+		customer.handle("DELETE addresses/{id}", controllers.DeleteAddress)
+		customer.with(controllers.RequireVerifiedEmail).handle("POST checkout", controllers.Checkout)
+		customer.handle("GET wallet", controllers.GetWallets)
+		customer.handle("GET wallet/transactions", controllers.GetWalletTransactions)
+		customer.with(controllers.RequireVerifiedEmail).handle("POST wallet/top-ups", controllers.TopUpWallet)
+
+	})
+
+	r.Route("/admin", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/admin"}
+		sub.handle("POST login", controllers.AdminLogin)
+		sub.handle("POST accept-invitation", controllers.AcceptAdminInvitation)
+
+		// Every other admin route needs a permission granted by the caller's roles
+		can := sub.requireAuth().requirePermission
+		can("vendors:manage").handle("POST add-vendor", controllers.AddVendor)
+		can("vendors:manage").handle("PUT update-vendor/{id}", controllers.UpdateVendor)
+		can("vendors:manage").handle("DELETE delete/{id}", controllers.DeleteVendor)
+		can("vendors:read").handle("GET list-vendors", controllers.GetAllVendors)
+		can("vendors:read").handle("GET vendor/{id}", controllers.GetVendorById)
+		can("vendors:manage").handle("GET vendor-applications", controllers.GetVendorApplications)
+		can("vendors:manage").handle("GET vendor-applications/{id}", controllers.GetVendorApplication)
+		can("vendors:manage").handle("GET vendor-applications/{id}/documents/{document_id}", controllers.GetVendorApplicationDocument)
+		can("vendors:manage").handle("POST vendor-applications/{id}/approve", controllers.ApproveVendorApplication)
+		can("vendors:manage").handle("POST vendor-applications/{id}/reject", controllers.RejectVendorApplication)
+		can("admins:manage").handle("POST signup", controllers.AdminSignup)
+		can("admins:manage").handle("POST invitations", controllers.InviteAdmin)
+		can("admins:manage").handle("GET admins", controllers.GetAllAdmins)
+		can("admins:manage").handle("DELETE admins/{id}/role", controllers.RevokeAdmin)
+		can("users:manage").handle("PUT users/{id}/require-2fa", controllers.RequireTwoFactor)
+		can("roles:manage").handle("GET permissions", controllers.GetPermissions)
+		can("roles:manage").handle("GET roles", controllers.GetRoles)
+		can("roles:manage").handle("PUT roles/{id}/permissions", controllers.UpdateRolePermissions)
+		can("finance:manage").handle("GET exchange-rates", controllers.GetExchangeRates)
+		can("finance:manage").handle("PUT exchange-rates/{currency}", controllers.SetExchangeRate)
+		can("finance:manage").handle("DELETE exchange-rates/{currency}", controllers.DeleteExchangeRate)
+		can("finance:manage").handle("GET reports/sales", controllers.GetSalesReport)
+		can("finance:manage").handle("GET reports/reconciliation", controllers.GetReconciliationReport)
+		can("finance:manage").handle("GET ledger/accounts", controllers.GetLedgerAccounts)
+		can("finance:manage").handle("GET ledger/accounts/{id}/postings", controllers.GetLedgerAccountPostings)
+		can("finance:manage").handle("GET ledger/entries", controllers.GetJournalEntries)
+		can("finance:manage").handle("GET ledger/check", controllers.GetLedgerCheck)
+		can("finance:manage").handle("GET vendors/{id}/commission", controllers.GetVendorCommission)
+		can("finance:manage").handle("PUT vendors/{id}/commission", controllers.SetVendorCommission)
+		can("finance:manage").handle("PUT vendors/{id}/currency", controllers.SetVendorCurrency)
+		can("finance:manage").handle("GET payouts", controllers.GetPayouts)
+		can("finance:manage").handle("POST payouts", controllers.CreatePayouts)
+		can("finance:manage").handle("GET payouts/{id}", controllers.GetPayout)
+		can("finance:manage").handle("POST payouts/{id}/approve", controllers.ApprovePayout)
+		can("finance:manage").handle("POST payouts/{id}/paid", controllers.MarkPayoutPaid)
+		can("finance:manage").handle("GET customers/{id}/wallet", controllers.GetWallets)
+		can("finance:manage").handle("GET customers/{id}/wallet/transactions", controllers.GetWalletTransactions)
+		can("finance:manage").handle("GET tax-jurisdictions", controllers.GetTaxJurisdictions)
+		can("finance:manage").handle("POST tax-jurisdictions", controllers.CreateTaxJurisdiction)
+		can("finance:manage").handle("PUT tax-jurisdictions/{id}", controllers.UpdateTaxJurisdiction)
+		can("finance:manage").handle("DELETE tax-jurisdictions/{id}", controllers.DeleteTaxJurisdiction)
+		can("finance:manage").handle("PUT vendors/{id}/tax-jurisdiction", controllers.SetVendorTaxJurisdiction)
+		can("promotions:manage").handle("GET promotions", controllers.GetPromotions)
+		can("promotions:manage").handle("POST promotions", controllers.CreatePromotion)
+		can("promotions:manage").handle("PUT promotions/{id}", controllers.UpdatePromotion)
+		can("promotions:manage").handle("DELETE promotions/{id}", controllers.DeletePromotion)
+		can("promotions:manage").handle("POST customers/{id}/wallet/credits", controllers.CreateWalletPromotion)
+		can("refunds:manage").handle("GET orders/{id}/refunds", controllers.GetRefunds)
+		can("refunds:manage").handle("POST orders/{id}/refunds", controllers.CreateRefund)
+	})
+
+	r.Route("/vendor", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/vendor"}
+		sub.handle("POST login", controllers.VendorLogin)
+		sub.handle("POST staff/accept-invitation", controllers.AcceptStaffInvitation)
+		sub.handle("POST apply", controllers.ApplyAsVendor)
+
+		vendor := sub.requireAuth().with(controllers.RequireVendorMember)
+		can := vendor.requirePermission
+		vendor.handle("GET profile", controllers.GetVendorProfile)
+		can("profile:manage").handle("PUT profile", controllers.UpdateVendorProfile)
+		vendor.handle("GET hours", controllers.GetOpeningHours)
+		can("profile:manage").handle("PUT hours", controllers.UpdateOpeningHours)
+		vendor.handle("GET closures", controllers.GetClosures)
+		can("profile:manage").handle("POST closures", controllers.CreateClosure)
+		can("profile:manage").handle("DELETE closures/{id}", controllers.DeleteClosure)
+		vendor.handle("GET delivery-zones", controllers.GetDeliveryZones)
+		can("profile:manage").handle("POST delivery-zones", controllers.CreateDeliveryZone)
+		can("profile:manage").handle("PUT delivery-zones/{id}", controllers.UpdateDeliveryZone)
+		can("profile:manage").handle("DELETE delivery-zones/{id}", controllers.DeleteDeliveryZone)
+		vendor.handle("GET items", controllers.GetVendorItems)
+		can("menu:manage").handle("POST items", controllers.CreateItem)
+		can("menu:manage").handle("PUT items/{id}", controllers.UpdateItem)
+		can("menu:manage").handle("DELETE items/{id}", controllers.DeleteItem)
+		vendor.handle("GET promotions", controllers.GetPromotions)
+		can("menu:manage").handle("POST promotions", controllers.CreatePromotion)
+		can("menu:manage").handle("PUT promotions/{id}", controllers.UpdatePromotion)
+		can("menu:manage").handle("DELETE promotions/{id}", controllers.DeletePromotion)
+		can("orders:read").handle("GET orders", controllers.GetVendorOrders)
+		can("orders:read").handle("GET orders/{id}", controllers.GetVendorOrder)
+		can("orders:update").handle("PUT orders/{id}/status", controllers.UpdateOrderStatus)
+		can("orders:read").handle("GET orders/{id}/balance", controllers.GetOrderBalance)
+		can("payments:collect").handle("POST orders/{id}/cash", controllers.RecordCashPayment)
+		can("orders:read").handle("GET orders/{id}/refunds", controllers.GetRefunds)
+		can("orders:refund").handle("POST orders/{id}/refunds", controllers.CreateRefund)
+		can("payouts:read").handle("GET commission", controllers.GetVendorCommission)
+		can("payouts:read").handle("GET payouts", controllers.GetPayouts)
+		can("payouts:read").handle("GET payouts/{id}", controllers.GetPayout)
+		can("staff:manage").handle("GET staff", controllers.GetStaff)
+		can("staff:manage").handle("POST staff/invitations", controllers.InviteStaff)
+		can("staff:manage").handle("PUT staff/{id}/role", controllers.UpdateStaffRole)
+		can("staff:manage").handle("DELETE staff/{id}", controllers.RemoveStaff)
+		can("staff:manage").handle("GET roles", controllers.GetVendorRoles)
+		can("staff:manage").handle("POST roles", controllers.CreateVendorRole)
+		can("staff:manage").handle("PUT roles/{id}", controllers.UpdateVendorRole)
+		can("staff:manage").handle("DELETE roles/{id}", controllers.DeleteVendorRole)
+	})
+
+	group{router: r}.handle("GET /search", controllers.Search)
+
+	r.Route("/vendors", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/vendors"}
+		sub.handle("GET nearby", controllers.GetNearbyVendors)
+		sub.handle("GET {id}/delivery", controllers.GetDeliveryQuote)
+	})
+
+	r.Route("/payments", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/payments"}
+		sub.handle("POST webhook", controllers.PaymentWebhook)
+	})
+
+	r.Route("/auth", func(router *michi.Router) {
+		sub := group{router: router, prefix: "/auth"}
+		sub.handle("POST forgot-password", controllers.ForgotPassword)
+		sub.handle("POST reset-password", controllers.ResetPassword)
+		sub.handle("POST verify-email", controllers.VerifyEmail)
+		sub.handle("POST 2fa/verify", controllers.VerifyLogin)
+
+		authed := sub.requireAuth()
+		authed.handle("POST logout", controllers.Logout)
+		authed.handle("POST change-password", controllers.ChangePassword)
+		authed.handle("POST resend-verification", controllers.ResendVerification)
+		authed.handle("POST 2fa/enroll", controllers.EnrollTwoFactor)
+		authed.handle("POST 2fa/confirm", controllers.ConfirmTwoFactor)
+		authed.handle("POST 2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+		authed.handle("POST 2fa/disable", controllers.DisableTwoFactor)
+	})
+	return r
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"resturant/docs"
+	"testing"
+)
+
+// TestRoutesAreDocumented fails when a route is registered without an
+// OpenAPI spec entry or behind another guard than the entry documents, or the
+// spec describes a route that doesn't exist
+func TestRoutesAreDocumented(t *testing.T) {
+	newRouter()
+	if len(routes) == 0 {
+		t.Fatal("no routes were registered")
+	}
+
+	seen := map[string]bool{}
+	for _, route := range routes {
+		if seen[route.Pattern] {
+			t.Errorf("route %s is registered twice", route.Pattern)
+		}
+		seen[route.Pattern] = true
+	}
+
+	if err := docs.Check(routes); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"resturant/controllers"
+	"resturant/utils"
+)
+
+// settlePaymentsCommand settles the checkouts and payment operations the
+// provider could not be asked for while serving the request, so it can run
+// from cron. It exits with status 1 when some are still pending.
+func settlePaymentsCommand() {
+	settlement, err := controllers.SettlePayments()
+	if err != nil {
+		log.Fatal(utils.ErrorWithTrace(err, err.Error()))
+	}
+	fmt.Printf("%d checkouts given up, %d payment operations settled\n", settlement.Abandoned, settlement.Settled)
+	if settlement.Pending > 0 {
+		fmt.Printf("%d still pending, the payment provider can't be reached\n", settlement.Pending)
+		os.Exit(1)
+	}
+}
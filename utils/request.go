@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxMemory is the part of a multipart body kept in memory, the rest goes to temporary files
+const maxMemory = 10 << 20 // 10 MB
+
+// maxJSONBody is the largest JSON body accepted, no request DTO comes close
+const maxJSONBody = 1 << 20 // 1 MB
+
+// DecodeRequest fills dst (a pointer to a request DTO) from the request body.
+// JSON bodies are decoded with the json tags, multipart and urlencoded forms
+// are mapped through the form tags. Uploaded files stay available through r.FormFile.
+func DecodeRequest(r *http.Request, dst interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		// Without a ResponseWriter the limit only fails the read, the
+		// handler answers as for any other invalid body
+		r.Body = http.MaxBytesReader(nil, r.Body, maxJSONBody)
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return fmt.Errorf("JSON body is larger than %d bytes", tooLarge.Limit)
+			}
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return nil
+	}
+
+	if err := r.ParseMultipartForm(maxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return fmt.Errorf("invalid form data: %w", err)
+	}
+	return decodeForm(r, dst)
+}
+
+// decodeForm copies form values into the fields of dst that carry a form tag
+func decodeForm(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("decode target must be a pointer to a struct")
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("form")
+		if name == "" || name == "-" {
+			continue
+		}
+		values, ok := r.Form[name]
+		if !ok {
+			continue
+		}
+		// Repeated fields (permissions=a&permissions=b) fill slices
+		if field := v.Field(i); field.Kind() == reflect.Slice {
+			field.Set(reflect.MakeSlice(field.Type(), len(values), len(values)))
+			for j, value := range values {
+				if err := setField(field.Index(j), strings.TrimSpace(value)); err != nil {
+					return fmt.Errorf("invalid value for %s: %w", name, err)
+				}
+			}
+			continue
+		}
+		if err := setField(v.Field(i), strings.TrimSpace(r.FormValue(name))); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Pointer {
+		if value == "" {
+			return nil
+		}
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if value == "" {
+			return nil
+		}
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
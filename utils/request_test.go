@@ -0,0 +1,115 @@
+package utils_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"resturant/models"
+	"resturant/utils"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type decodeTarget struct {
+	Name     string        `json:"name" form:"name"`
+	Quantity int           `json:"quantity" form:"quantity"`
+	Ratio    float64       `json:"ratio" form:"ratio"`
+	Active   *bool         `json:"active" form:"active"`
+	ItemID   uuid.UUID     `json:"item_id" form:"item_id"`
+	Price    *models.Money `json:"price" form:"price"`
+	Tags     []string      `json:"tags" form:"tags"`
+	Hidden   string        `json:"hidden" form:"-"`
+}
+
+func TestDecodeRequest(t *testing.T) {
+	itemID := uuid.MustParse("7f0d6b5e-2f0a-4a8e-9a49-0c5a2b3c4d5e")
+	active := true
+	// Amounts are decoded before their currency is known, with the most
+	// decimals a currency has
+	price := models.NewMoney(12500, "")
+	want := decodeTarget{
+		Name:     "Pizza",
+		Quantity: 2,
+		Ratio:    0.5,
+		Active:   &active,
+		ItemID:   itemID,
+		Price:    &price,
+		Tags:     []string{"hot", "vegan"},
+	}
+
+	jsonBody := `{"name":"Pizza","quantity":2,"ratio":0.5,"active":true,"item_id":"` + itemID.String() + `","price":"12.50","tags":["hot","vegan"]}`
+	form := url.Values{
+		"name":     {" Pizza "},
+		"quantity": {"2"},
+		"ratio":    {"0.5"},
+		"active":   {"true"},
+		"item_id":  {itemID.String()},
+		"price":    {"12.50"},
+		"tags":     {"hot", "vegan"},
+		"hidden":   {"x"},
+	}
+	var multipartBody bytes.Buffer
+	writer := multipart.NewWriter(&multipartBody)
+	for name, values := range form {
+		for _, value := range values {
+			writer.WriteField(name, value)
+		}
+	}
+	writer.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json; charset=utf-8", jsonBody},
+		{"urlencoded", "application/x-www-form-urlencoded", form.Encode()},
+		{"multipart", writer.FormDataContentType(), multipartBody.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			var got decodeTarget
+			if err := utils.DecodeRequest(r, &got); err != nil {
+				t.Fatalf("DecodeRequest() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("DecodeRequest() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"malformed json", "application/json", `{"name":`, "invalid JSON body"},
+		{"json of the wrong type", "application/json", `{"quantity":"two"}`, "invalid JSON body"},
+		{"json too large", "application/json", `{"name":"` + strings.Repeat("a", 2<<20) + `"}`, "JSON body is larger than 1048576 bytes"},
+		{"form number", "application/x-www-form-urlencoded", "quantity=two", "invalid value for quantity"},
+		{"form uuid", "application/x-www-form-urlencoded", "item_id=nope", "invalid value for item_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			var got decodeTarget
+			err := utils.DecodeRequest(r, &got)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeRequest() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
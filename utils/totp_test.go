@@ -0,0 +1,96 @@
+package utils_test
+
+import (
+	"resturant/utils"
+	"testing"
+	"time"
+)
+
+// The SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := utils.TOTPCode(rfcSecret, utils.TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := utils.TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode() accepted an invalid secret")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := utils.TOTPStep(now)
+	code := func(step int64) string {
+		c, err := utils.TOTPCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(current), 0, current, true},
+		{"spaces typed", code(current)[:3] + " " + code(current)[3:], 0, current, true},
+		{"one step behind", code(current - 1), 0, current - 1, true},
+		{"one step ahead", code(current + 1), 0, current + 1, true},
+		{"two steps behind", code(current - 2), 0, 0, false},
+		{"two steps ahead", code(current + 2), 0, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"replayed code", code(current), current, 0, false},
+		{"older code after a newer one", code(current - 1), current, 0, false},
+		{"newer code after an older one", code(current + 1), current, current + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := utils.ValidateTOTP(rfcSecret, tt.code, now, tt.lastStep)
+			if step != tt.wantStep || ok != tt.wantOK {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := utils.GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Errorf("GenerateRecoveryCode() = %q, want xxxxx-xxxxx", code)
+	}
+	if utils.NormalizeRecoveryCode(code) != code {
+		t.Errorf("NormalizeRecoveryCode(%q) changed a generated code", code)
+	}
+
+	for _, typed := range []string{"abcde-fghij", "ABCDE-FGHIJ", " abcdefghij ", "abcde fghij"} {
+		if got := utils.NormalizeRecoveryCode(typed); got != "abcde-fghij" {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want abcde-fghij", typed, got)
+		}
+	}
+}
@@ -33,8 +33,18 @@ func HandleError(w http.ResponseWriter, status int, message string) {
 
 // SaveImageFile saves the uploaded image file to the specified directory with a new name
 func SaveImageFile(file io.Reader, table string, filename string) (string, error) {
+	return saveFile("uploads", file, table, filename)
+}
+
+// SavePrivateFile saves an uploaded file under storage/, which unlike uploads/
+// is not served publicly. Handlers that check access serve it back.
+func SavePrivateFile(file io.Reader, folder string, filename string) (string, error) {
+	return saveFile("storage", file, folder, filename)
+}
+
+func saveFile(root string, file io.Reader, table string, filename string) (string, error) {
 	// Create directory structure if it doesn't exist
-	fullPath := filepath.Join("uploads", table)
+	fullPath := filepath.Join(root, table)
 	if err := os.MkdirAll(fullPath, os.ModePerm); err != nil {
 		return "", err
 	}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldErrors maps a request field (by its json name) to what is wrong with it
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, message := range e {
+		fields = append(fields, field+": "+message)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+var (
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Validate checks every field of a request DTO against the rules in its
+// validate tag and returns nil when all of them pass. Structs nested in the
+// DTO, directly or in slices, are validated the same way and their errors are
+// named after the path to the field, e.g. items[0].quantity.
+//
+// Supported rules: required, omitempty, email, e164, currency, password, min=N
+// and max=N (length for strings, value for numbers) and oneof=a b c. Zero
+// values are checked like any other value, omitempty skips the remaining rules
+// for them. A nil pointer is a field that was not sent, it only fails required.
+func Validate(v interface{}) FieldErrors {
+	errs := FieldErrors{}
+	validateStruct(reflect.ValueOf(v), "", errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateStruct adds the errors of the fields of rv to errs, prefixing their
+// names with prefix
+func validateStruct(rv reflect.Value, prefix string, errs FieldErrors) {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		name = prefix + name
+
+		value := rv.Field(i)
+		for value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				value = reflect.Value{}
+				break
+			}
+			value = value.Elem()
+		}
+
+		if message := checkRules(field.Tag.Get("validate"), value); message != "" {
+			errs[name] = message
+			continue
+		}
+		if !value.IsValid() {
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.Struct:
+			validateStruct(value, name+".", errs)
+		case reflect.Slice, reflect.Array:
+			element := value.Type().Elem()
+			for element.Kind() == reflect.Pointer {
+				element = element.Elem()
+			}
+			if element.Kind() != reflect.Struct {
+				continue
+			}
+			for j := 0; j < value.Len(); j++ {
+				validateStruct(value.Index(j), fmt.Sprintf("%s[%d].", name, j), errs)
+			}
+		}
+	}
+}
+
+// checkRules returns the message of the first rule the value breaks
+func checkRules(rules string, value reflect.Value) string {
+	if rules == "" {
+		return ""
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == "omitempty" {
+			if !value.IsValid() || value.IsZero() {
+				return ""
+			}
+			continue
+		}
+		if message := checkRule(rule, value); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+func checkRule(rule string, value reflect.Value) string {
+	rule, arg, _ := strings.Cut(rule, "=")
+	if rule == "required" {
+		if !value.IsValid() || value.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	if !value.IsValid() {
+		return ""
+	}
+
+	switch rule {
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "e164":
+		if !e164Pattern.MatchString(value.String()) {
+			return "must be a phone number in E.164 format, e.g. +218911234567"
+		}
+	case "currency":
+		if !currencyPattern.MatchString(value.String()) {
+			return "must be an ISO 4217 currency code, e.g. USD"
+		}
+	case "password":
+		return checkPasswordStrength(value.String())
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(arg, 64)
+		size, unit := measure(value)
+		if rule == "min" && size < limit {
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		}
+		if rule == "max" && size > limit {
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+// measure returns the length of strings and slices or the value of numbers,
+// including number types such as models.Money that expose a Float64 method
+func measure(value reflect.Value) (float64, string) {
+	if number, ok := value.Interface().(interface{ Float64() float64 }); ok {
+		return number.Float64(), ""
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	return 0, ""
+}
+
+// checkPasswordStrength requires at least 8 characters mixing upper case,
+// lower case letters and digits
+func checkPasswordStrength(password string) string {
+	if utf8.RuneCountInString(password) < 8 {
+		return "must be at least 8 characters"
+	}
+	var upper, lower, digit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	if !upper || !lower || !digit {
+		return "must contain upper case and lower case letters and a digit"
+	}
+	return ""
+}
+
+// HandleValidationError sends the per-field validation errors of a request
+func HandleValidationError(w http.ResponseWriter, errs FieldErrors) {
+	SendJSONResponse(w, http.StatusBadRequest, map[string]interface{}{
+		"massage": "Invalid request",
+		"errors":  errs,
+	})
+}
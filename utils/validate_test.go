@@ -0,0 +1,116 @@
+package utils_test
+
+import (
+	"reflect"
+	"resturant/models"
+	"resturant/utils"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	one := 1
+	zero := 0
+	price := models.NewMoney(0, "USD")
+
+	tests := []struct {
+		name string
+		req  interface{}
+		want utils.FieldErrors
+	}{
+		{"required string missing", struct {
+			Name string `json:"name" validate:"required"`
+		}{}, utils.FieldErrors{"name": "is required"}},
+		{"min rejects zero", struct {
+			Quantity int `json:"quantity" validate:"min=1"`
+		}{}, utils.FieldErrors{"quantity": "must be at least 1"}},
+		{"min accepts the limit", struct {
+			Quantity int `json:"quantity" validate:"min=1"`
+		}{1}, nil},
+		{"max on numbers", struct {
+			Quantity int `json:"quantity" validate:"max=100"`
+		}{101}, utils.FieldErrors{"quantity": "must be at most 100"}},
+		{"max on string length", struct {
+			Name string `json:"name" validate:"max=3"`
+		}{"abcd"}, utils.FieldErrors{"name": "must be at most 3 characters"}},
+		{"zero money fails min", struct {
+			Price models.Money `json:"price" validate:"min=0.01"`
+		}{}, utils.FieldErrors{"price": "must be at least 0.01"}},
+		{"money above min", struct {
+			Price models.Money `json:"price" validate:"min=0.01"`
+		}{models.NewMoney(1, "USD")}, nil},
+		{"nil pointer is not sent", struct {
+			Quantity *int `json:"quantity" validate:"min=1"`
+		}{}, nil},
+		{"pointer to zero is checked", struct {
+			Quantity *int `json:"quantity" validate:"min=1"`
+		}{&zero}, utils.FieldErrors{"quantity": "must be at least 1"}},
+		{"pointer to money is checked", struct {
+			Price *models.Money `json:"price" validate:"min=0.01"`
+		}{&price}, utils.FieldErrors{"price": "must be at least 0.01"}},
+		{"required pointer", struct {
+			Quantity *int `json:"quantity" validate:"required"`
+		}{}, utils.FieldErrors{"quantity": "is required"}},
+		{"required pointer set", struct {
+			Quantity *int `json:"quantity" validate:"required"`
+		}{&one}, nil},
+		{"omitempty skips zero", struct {
+			Phone string `json:"phone" validate:"omitempty,e164"`
+		}{}, nil},
+		{"omitempty checks values", struct {
+			Phone string `json:"phone" validate:"omitempty,e164"`
+		}{"0911234567"}, utils.FieldErrors{"phone": "must be a phone number in E.164 format, e.g. +218911234567"}},
+		{"empty oneof without omitempty", struct {
+			Kind string `json:"kind" validate:"oneof=a b"`
+		}{}, utils.FieldErrors{"kind": "must be one of a, b"}},
+		{"email", struct {
+			Email string `json:"email" validate:"required,email"`
+		}{"Jo <jo@example.com>"}, utils.FieldErrors{"email": "must be a valid email address"}},
+		{"currency", struct {
+			Currency string `json:"currency" validate:"currency"`
+		}{"usd"}, utils.FieldErrors{"currency": "must be an ISO 4217 currency code, e.g. USD"}},
+		{"weak password", struct {
+			Password string `json:"password" validate:"required,password"`
+		}{"password1"}, utils.FieldErrors{"password": "must contain upper case and lower case letters and a digit"}},
+		{"strong password", struct {
+			Password string `json:"password" validate:"required,password"`
+		}{"Password1"}, nil},
+		{"field name without json tag", struct {
+			Name string `validate:"required"`
+		}{}, utils.FieldErrors{"Name": "is required"}},
+		{"slice elements", models.RefundRequest{
+			Reason: "wrong order",
+			Items:  []models.RefundItemRequest{{ItemID: [16]byte{1}, Quantity: 1}, {ItemID: [16]byte{2}}},
+		}, utils.FieldErrors{"items[1].quantity": "is required"}},
+		{"slice of struct pointers", struct {
+			Items []*models.RefundItemRequest `json:"items"`
+		}{[]*models.RefundItemRequest{nil, {Quantity: 101}}}, utils.FieldErrors{
+			"items[1].item_id":  "is required",
+			"items[1].quantity": "must be at most 100",
+		}},
+		{"slice rules come first", struct {
+			Items []models.RefundItemRequest `json:"items" validate:"max=1"`
+		}{make([]models.RefundItemRequest, 2)}, utils.FieldErrors{"items": "must be at most 1 items"}},
+		{"nested struct", struct {
+			Hours models.OpeningInterval `json:"hours"`
+		}{models.OpeningInterval{Weekday: 7, OpensAt: "09:00"}}, utils.FieldErrors{
+			"hours.weekday":   "must be at most 6",
+			"hours.closes_at": "is required",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utils.Validate(tt.req)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAcceptsPointers(t *testing.T) {
+	req := &models.CartItemRequest{Quantity: -1}
+	want := utils.FieldErrors{"item_id": "is required", "quantity": "must be at least 0"}
+	if got := utils.Validate(req); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() = %v, want %v", got, want)
+	}
+}